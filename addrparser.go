@@ -0,0 +1,80 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// addrCacheKey identifies the addresses of a public key script on a network.
+type addrCacheKey struct {
+	pkScript string
+	net      *chaincfg.Params
+}
+
+// AddressParser extracts the addresses paid to by standard public key scripts.
+// Parsers created with NewAddressParser cache the addresses of the scripts they
+// parse, which avoids reparsing scripts that are seen repeatedly, such as those
+// of the outputs of a busy wallet.  The zero value is a parser which doesn't
+// cache.
+//
+// It is safe for concurrent access.
+type AddressParser struct {
+	mtx        sync.Mutex
+	cache      map[addrCacheKey][]Address
+	maxEntries int
+}
+
+// NewAddressParser returns a new address parser which caches the addresses of
+// up to maxEntries scripts.  When the cache is full, a random entry is evicted
+// to make room for a new one.  A maxEntries of zero disables caching.
+func NewAddressParser(maxEntries int) *AddressParser {
+	return &AddressParser{
+		cache:      make(map[addrCacheKey][]Address, maxEntries),
+		maxEntries: maxEntries,
+	}
+}
+
+// Parse returns the addresses paid to by the passed public key script on the
+// given network.  Only standard scripts have addresses, so the result is empty
+// for all others.  ErrMalformedScript is returned when the script does not
+// parse.
+//
+// The returned slice is shared with the cache and MUST NOT be modified.
+func (p *AddressParser) Parse(script []byte, net *chaincfg.Params) ([]Address, error) {
+	if p.maxEntries <= 0 {
+		_, addrs, err := extractPkScriptAddrs(script, net)
+		return addrs, err
+	}
+
+	key := addrCacheKey{pkScript: string(script), net: net}
+	p.mtx.Lock()
+	addrs, ok := p.cache[key]
+	p.mtx.Unlock()
+	if ok {
+		return addrs, nil
+	}
+
+	_, addrs, err := extractPkScriptAddrs(script, net)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	// Evict a random entry when the cache is full.  Go's map iteration
+	// order is randomized, so the first entry is effectively random.
+	if len(p.cache) >= p.maxEntries {
+		for k := range p.cache {
+			delete(p.cache, k)
+			break
+		}
+	}
+	p.cache[key] = addrs
+	return addrs, nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestAddressParser ensures the addresses of standard scripts are extracted and
+// that caching parsers return the same results as uncached ones.
+func TestAddressParser(t *testing.T) {
+	t.Parallel()
+
+	net := &chaincfg.MainNetParams
+	hash := hexToBytes("6edbc6c4d31bae9f1ccc38538a114bf42de65e86")
+	pkHashAddr, _ := btcutil.NewAddressPubKeyHash(hash, net)
+	wpkhAddr, _ := btcutil.NewAddressWitnessPubKeyHash(hash, net)
+	shAddr, _ := btcutil.NewAddressScriptHashFromHash(hash, net)
+	wshAddr, _ := btcutil.NewAddressWitnessScriptHash(p2wshScript[2:], net)
+	pubKeyAddr1, _ := btcutil.NewAddressPubKey(p2pkScript[1:34], net)
+	pubKeyAddr2, _ := btcutil.NewAddressPubKey(multiSigScript[36:69], net)
+
+	tests := []struct {
+		name   string
+		script []byte
+		addrs  []btcutil.Address
+		err    error
+	}{
+		{"p2pkh", p2pkhScript, []btcutil.Address{pkHashAddr}, nil},
+		{"p2wpkh", p2wpkhScript, []btcutil.Address{wpkhAddr}, nil},
+		{"p2sh", p2shScript, []btcutil.Address{shAddr}, nil},
+		{"p2wsh", p2wshScript, []btcutil.Address{wshAddr}, nil},
+		{"p2pk", p2pkScript, []btcutil.Address{pubKeyAddr1}, nil},
+		{"multisig", multiSigScript, []btcutil.Address{pubKeyAddr1,
+			pubKeyAddr2}, nil},
+		{"nulldata", nullDataScript, nil, nil},
+		{"nonstandard", hexToBytes("51"), nil, nil},
+		{"malformed", hexToBytes("4c"), nil, btcutil.ErrMalformedScript},
+	}
+
+	uncached := &btcutil.AddressParser{}
+	cached := btcutil.NewAddressParser(len(tests))
+	for _, test := range tests {
+		// Parse with the caching parser twice so the second parse is
+		// served from the cache.
+		for i, parser := range []*btcutil.AddressParser{uncached,
+			cached, cached} {
+
+			addrs, err := parser.Parse(test.script, net)
+			if err != test.err {
+				t.Errorf("%s (parse %d): got error %v, want %v",
+					test.name, i, err, test.err)
+				continue
+			}
+			if !reflect.DeepEqual(addrs, test.addrs) {
+				t.Errorf("%s (parse %d): got addresses %v, want "+
+					"%v", test.name, i, addrs, test.addrs)
+			}
+		}
+	}
+
+	// The same script on a different network must not be served from the
+	// cache of the original network.
+	addrs, err := cached.Parse(p2pkhScript, &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if len(addrs) != 1 || !addrs[0].IsForNet(&chaincfg.TestNet3Params) {
+		t.Errorf("Parse: got addresses %v for the wrong network", addrs)
+	}
+
+	// A full cache keeps working by evicting entries.
+	small := btcutil.NewAddressParser(1)
+	for _, script := range [][]byte{p2pkhScript, p2wpkhScript, p2pkhScript} {
+		want, _ := uncached.Parse(script, net)
+		got, err := small.Parse(script, net)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Parse: got %v, %v, want %v", got, err, want)
+		}
+	}
+}
+
+// benchmarkAddressParser benchmarks parsing a small set of repeated scripts
+// with the passed parser.
+func benchmarkAddressParser(b *testing.B, parser *btcutil.AddressParser) {
+	scripts := [][]byte{p2pkhScript, p2wpkhScript, p2shScript, p2wshScript,
+		multiSigScript}
+	net := &chaincfg.MainNetParams
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := parser.Parse(scripts[i%len(scripts)], net)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAddressParserUncached benchmarks parsing scripts without a cache.
+func BenchmarkAddressParserUncached(b *testing.B) {
+	benchmarkAddressParser(b, &btcutil.AddressParser{})
+}
+
+// BenchmarkAddressParserCached benchmarks parsing scripts which are served
+// from the cache.
+func BenchmarkAddressParserCached(b *testing.B) {
+	benchmarkAddressParser(b, btcutil.NewAddressParser(100))
+}
@@ -0,0 +1,585 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// baseSubsidy is the starting subsidy amount for mined blocks.  This
+	// value is halved every subsidyHalvingInterval blocks.
+	baseSubsidy = 50 * SatoshiPerBitcoin
+
+	// subsidyHalvingInterval is the number of blocks between each halving
+	// of the subsidy on the main network.
+	subsidyHalvingInterval = 210000
+
+	// medianTimeBlocks is the number of previous blocks whose timestamps
+	// make up the median time past.  It mirrors the value used by
+	// blockchain, which can't be referenced from here without creating an
+	// import cycle.
+	medianTimeBlocks = 11
+)
+
+var (
+	// ErrNoTransactions describes an error where a block doesn't have any
+	// transactions, not even a coinbase.
+	ErrNoTransactions = errors.New("block has no transactions")
+
+	// ErrBadCoinbaseValue describes an error where the outputs of a
+	// coinbase transaction claim more than the block subsidy plus the
+	// fees paid by the other transactions in the block.
+	ErrBadCoinbaseValue = errors.New("coinbase pays more than the " +
+		"block subsidy and fees")
+
+	// ErrMerkleMismatch describes an error where the merkle root of the
+	// transactions of a block doesn't match the one in its header.
+	ErrMerkleMismatch = errors.New("merkle root of transactions doesn't " +
+		"match the block header")
+
+	// ErrNoHeaders describes an error where a median time past is
+	// requested for an empty sequence of block headers.
+	ErrNoHeaders = errors.New("no block headers")
+)
+
+// BlockNew defines a bitcoin block in the new experimental format that
+// provides easier and more efficient manipulation of raw blocks.  Much like
+// TxNew does for transactions, it keeps the legacy wire.MsgBlock form of the
+// block alongside the underlying wire.MsgBlockNew, and its transactions are
+// wrapped as TxNew.  It also memoizes hashes for the block and its
+// transactions on their first access so subsequent accesses don't have to
+// repeat the relatively expensive hashing operations.
+type BlockNew struct {
+	msgBlockNew   *wire.MsgBlockNew // Underlying MsgBlockNew
+	msgBlock      *wire.MsgBlock    // Legacy form of the block
+	blockHash     *chainhash.Hash   // Cached block hash
+	merkleRoot    *chainhash.Hash   // Cached merkle root of transactions
+	blockHeight   int32             // Height in the main block chain
+	transactions  []*TxNew          // Transactions
+	txnsGenerated bool              // ALL wrapped transactions generated
+}
+
+// MsgBlockNew returns the underlying wire.MsgBlockNew for the block.
+func (b *BlockNew) MsgBlockNew() *wire.MsgBlockNew {
+	return b.msgBlockNew
+}
+
+// MsgBlock returns the legacy wire.MsgBlock form of the block.
+func (b *BlockNew) MsgBlock() *wire.MsgBlock {
+	return b.msgBlock
+}
+
+// Hash returns the block identifier hash for the block.  This is equivalent to
+// calling BlockHash on the legacy wire.MsgBlock, however it caches the result
+// so subsequent calls are more efficient.
+func (b *BlockNew) Hash() *chainhash.Hash {
+	// Return the cached block hash if it has already been generated.
+	if b.blockHash != nil {
+		return b.blockHash
+	}
+
+	// Cache the block hash and return it.
+	hash := b.msgBlock.BlockHash()
+	b.blockHash = &hash
+	return &hash
+}
+
+// newTx returns a wrapped transaction for the transaction at the passed index,
+// which must be in range, sharing the legacy form already held by the block.
+func (b *BlockNew) newTx(txNum int) *TxNew {
+	return &TxNew{
+		msgTxNew: b.msgBlockNew.Transactions[txNum],
+		msgTx:    b.msgBlock.Transactions[txNum],
+		txIndex:  txNum,
+	}
+}
+
+// Tx returns a wrapped transaction (btcutil.TxNew) for the transaction at the
+// specified index in the block.  The supplied index is 0 based.  That is to
+// say, the first transaction in the block is txNum 0.
+func (b *BlockNew) Tx(txNum int) (*TxNew, error) {
+	// Ensure the requested transaction is in range.
+	numTx := len(b.msgBlock.Transactions)
+	if txNum < 0 || txNum >= numTx {
+		str := fmt.Sprintf("transaction index %d is out of range - max %d",
+			txNum, numTx-1)
+		return nil, OutOfRangeError(str)
+	}
+
+	// Generate slice to hold all of the wrapped transactions if needed.
+	if len(b.transactions) == 0 {
+		b.transactions = make([]*TxNew, numTx)
+	}
+
+	// Return the wrapped transaction if it has already been generated.
+	if b.transactions[txNum] != nil {
+		return b.transactions[txNum], nil
+	}
+
+	// Generate and cache the wrapped transaction and return it.
+	newTx := b.newTx(txNum)
+	b.transactions[txNum] = newTx
+	return newTx, nil
+}
+
+// Coinbase returns the wrapped coinbase transaction of the block, which must
+// be its first transaction.  ErrNoTransactions is returned when the block has
+// no transactions and ErrNotCoinBase is returned when the first one isn't a
+// coinbase.
+func (b *BlockNew) Coinbase() (*TxNew, error) {
+	if len(b.msgBlock.Transactions) == 0 {
+		return nil, ErrNoTransactions
+	}
+	tx, err := b.Tx(0)
+	if err != nil {
+		return nil, err
+	}
+	if !tx.IsCoinBase() {
+		return nil, ErrNotCoinBase
+	}
+	return tx, nil
+}
+
+// Transactions returns a slice of wrapped transactions (btcutil.TxNew) for all
+// transactions in the block.
+func (b *BlockNew) Transactions() []*TxNew {
+	// Return transactions if they have ALL already been generated.  This
+	// flag is necessary because the wrapped transactions are lazily
+	// generated in a sparse fashion.
+	if b.txnsGenerated {
+		return b.transactions
+	}
+
+	// Generate slice to hold all of the wrapped transactions if needed.
+	if len(b.transactions) == 0 {
+		b.transactions = make([]*TxNew, len(b.msgBlock.Transactions))
+	}
+
+	// Generate and cache the wrapped transactions for all that haven't
+	// already been done.
+	for i, tx := range b.transactions {
+		if tx == nil {
+			b.transactions[i] = b.newTx(i)
+		}
+	}
+
+	b.txnsGenerated = true
+	return b.transactions
+}
+
+// ScriptTypeHistogram returns the number of outputs of each class of public
+// key script across all transactions in the block.  Classes without any outputs
+// are omitted.
+func (b *BlockNew) ScriptTypeHistogram() map[ScriptClass]int {
+	histogram := make(map[ScriptClass]int)
+	for _, msgTx := range b.msgBlock.Transactions {
+		for _, txOut := range msgTx.TxOut {
+			histogram[ClassifyScript(txOut.PkScript)]++
+		}
+	}
+	return histogram
+}
+
+// FindOutputs returns the outpoints of all outputs in the block which pay to
+// exactly the passed public key script, such as for watching an address.  They
+// are ordered by their position in the block.
+func (b *BlockNew) FindOutputs(pkScript []byte) []wire.OutPoint {
+	var outPoints []wire.OutPoint
+	for i, msgTx := range b.msgBlock.Transactions {
+		for j, txOut := range msgTx.TxOut {
+			if !bytes.Equal(txOut.PkScript, pkScript) {
+				continue
+			}
+
+			tx, _ := b.Tx(i)
+			outPoints = append(outPoints, wire.OutPoint{
+				Hash:  *tx.Hash(),
+				Index: uint32(j),
+			})
+		}
+	}
+	return outPoints
+}
+
+// TouchedAddresses returns the addresses on the passed network paid by the
+// outputs of the block along with those paid by the outputs spent by its
+// inputs, such as for indexing the blocks which touch an address.  The fetch
+// function returns the public key script of the output referenced by an
+// outpoint, and outputs it can't find, such as those pruned by the caller, are
+// skipped.  Each address is only returned once, in the order it first
+// appears, and scripts without addresses, such as null data scripts, are
+// skipped along with those which don't parse.  Pay-to-pubkey scripts touch the
+// pay-to-pubkey-hash address of the key, as encoded by AddressPubKey.
+//
+// An error is returned when no network or fetch function is passed, or when
+// the addresses of a script which parses can't be extracted.
+func (b *BlockNew) TouchedAddresses(net *chaincfg.Params,
+	fetch func(wire.OutPoint) ([]byte, bool)) ([]Address, error) {
+
+	if net == nil {
+		return nil, errors.New("no network")
+	}
+	if fetch == nil {
+		return nil, errors.New("no fetch function")
+	}
+
+	var addrs []Address
+	seen := make(map[string]struct{})
+	addScriptAddrs := func(pkScript []byte) error {
+		// Scripts which don't parse are allowed by consensus, so they
+		// are skipped like any other script without an address.
+		_, scriptAddrs, err := extractPkScriptAddrs(pkScript, net)
+		if err == ErrMalformedScript {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, addr := range scriptAddrs {
+			encoded := addr.EncodeAddress()
+			if _, ok := seen[encoded]; ok {
+				continue
+			}
+			seen[encoded] = struct{}{}
+			addrs = append(addrs, addr)
+		}
+		return nil
+	}
+
+	for i, msgTx := range b.msgBlock.Transactions {
+		if i != 0 {
+			for _, txIn := range msgTx.TxIn {
+				pkScript, ok := fetch(txIn.PreviousOutPoint)
+				if !ok {
+					continue
+				}
+				if err := addScriptAddrs(pkScript); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, txOut := range msgTx.TxOut {
+			if err := addScriptAddrs(txOut.PkScript); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// IsTopologicallyOrdered returns whether every transaction in the block which
+// spends an output created by another transaction in the block comes after
+// it, as required by consensus.  The coinbase doesn't spend any outputs, so it
+// is never out of order.
+func (b *BlockNew) IsTopologicallyOrdered() bool {
+	txns := b.Transactions()
+	positions := make(map[chainhash.Hash]int, len(txns))
+	for i, tx := range txns {
+		positions[*tx.Hash()] = i
+	}
+
+	for i, tx := range txns {
+		if i == 0 {
+			continue
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			pos, ok := positions[txIn.PreviousOutPoint.Hash]
+			if ok && pos >= i {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// OpReturnCount returns the number of outputs across all transactions in the
+// block whose public key scripts start with OP_RETURN, such as data carrier
+// outputs and the witness commitment.  See OpReturnBytes.
+func (b *BlockNew) OpReturnCount() int {
+	var count int
+	for _, msgTx := range b.msgBlock.Transactions {
+		for _, txOut := range msgTx.TxOut {
+			if isOpReturn(txOut.PkScript) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// OpReturnBytes returns the total number of bytes of data pushed after the
+// OP_RETURN by the outputs counted by OpReturnCount, that is their payload
+// excluding the opcodes.  The data pushed before a malformed push is included.
+func (b *BlockNew) OpReturnBytes() int {
+	var size int
+	for _, msgTx := range b.msgBlock.Transactions {
+		for _, txOut := range msgTx.TxOut {
+			if !isOpReturn(txOut.PkScript) {
+				continue
+			}
+			ops, _ := parseScript(txOut.PkScript[1:])
+			for _, op := range ops {
+				size += len(op.data)
+			}
+		}
+	}
+	return size
+}
+
+// UtxoDelta returns the number of outputs the block adds to the unspent
+// transaction output set, which excludes provably unspendable outputs as in
+// TxNew.SpendableOutputs, and the number it removes, which is the number of
+// inputs of its transactions other than the coinbase.  Outputs created and
+// spent within the block are counted as both.  The set grows by created minus
+// spent entries when the block is connected.
+func (b *BlockNew) UtxoDelta() (created, spent int) {
+	for i, msgTx := range b.msgBlock.Transactions {
+		if i != 0 {
+			spent += len(msgTx.TxIn)
+		}
+		for _, txOut := range msgTx.TxOut {
+			if !isUnspendable(txOut.PkScript) {
+				created++
+			}
+		}
+	}
+	return created, spent
+}
+
+// ToLegacyMsgBlock returns a new legacy wire.MsgBlock converted from the
+// underlying wire.MsgBlockNew, such as for passing the block to code which
+// only handles the legacy format.  Unlike MsgBlock, the returned block doesn't
+// share any transactions with the block, so it may be freely modified.
+//
+// ErrMerkleMismatch is returned when the merkle root of the converted
+// transactions doesn't match the one in the header, such as when transactions
+// were appended without updating it, and an error is also returned when a
+// transaction can't be converted.
+func (b *BlockNew) ToLegacyMsgBlock() (*wire.MsgBlock, error) {
+	for i, msgTxNew := range b.msgBlockNew.Transactions {
+		if msgTxNew == nil {
+			return nil, fmt.Errorf("transaction %d of block %v has no "+
+				"underlying MsgTxNew", i, b.Hash())
+		}
+	}
+
+	msgBlock := b.msgBlockNew.CreateMsgBlock()
+	leaves := make([]chainhash.Hash, len(msgBlock.Transactions))
+	for i, msgTx := range msgBlock.Transactions {
+		leaves[i] = msgTx.TxHash()
+	}
+	if calcMerkleRoot(leaves) != msgBlock.Header.MerkleRoot {
+		return nil, ErrMerkleMismatch
+	}
+	return msgBlock, nil
+}
+
+// AppendTx appends the passed transaction to the block, such as when
+// assembling a block template, and sets its index to its position in the
+// block.  The cached merkle root and block hash are discarded, however the
+// merkle root in the header is left unchanged, so callers must update it, such
+// as with CalcMerkleRoot, once all transactions have been appended.
+func (b *BlockNew) AppendTx(tx *TxNew) {
+	// Generate slice to hold all of the wrapped transactions if needed so
+	// the passed transaction is the one returned for its index.
+	numTx := len(b.msgBlock.Transactions)
+	if len(b.transactions) == 0 {
+		b.transactions = make([]*TxNew, numTx)
+	}
+
+	b.msgBlockNew.Transactions = append(b.msgBlockNew.Transactions,
+		tx.MsgTxNew())
+	b.msgBlock.Transactions = append(b.msgBlock.Transactions, tx.MsgTx())
+	b.transactions = append(b.transactions, tx)
+	tx.SetIndex(numTx)
+
+	b.merkleRoot = nil
+	b.blockHash = nil
+}
+
+// WarmCaches eagerly generates the wrapped transactions of the block along
+// with their memoized hashes, and computes the block hash and merkle root.  It
+// is intended to be called, such as by a worker, before the block is validated
+// so accesses on the hot path only read cached values.
+//
+// Once it returns, Hash, CalcMerkleRoot, Tx, Transactions, and the hash
+// accessors of the transactions only read the caches, so they are safe for
+// concurrent use provided nothing modifies the block.
+func (b *BlockNew) WarmCaches() {
+	for _, tx := range b.Transactions() {
+		tx.Hash()
+		tx.WitnessHash()
+	}
+	b.Hash()
+	b.CalcMerkleRoot()
+}
+
+// SerializeBase encodes the block to w in the base format, that is without
+// the witness data of its transactions, as expected by peers which don't
+// support segregated witness.
+func (b *BlockNew) SerializeBase(w io.Writer) error {
+	return b.msgBlock.SerializeNoWitness(w)
+}
+
+// SerializeWitness encodes the block to w including the witness data of its
+// transactions.
+func (b *BlockNew) SerializeWitness(w io.Writer) error {
+	return b.msgBlock.Serialize(w)
+}
+
+// calcBlockSubsidy returns the subsidy amount a block at the provided height
+// should have on the main network.  It mirrors blockchain.CalcBlockSubsidy,
+// which can't be referenced from here without creating an import cycle.
+func calcBlockSubsidy(height int32) int64 {
+	halvings := uint(height / subsidyHalvingInterval)
+	if halvings >= 64 {
+		return 0
+	}
+	return baseSubsidy >> halvings
+}
+
+// TotalFees returns the total fee paid by the non-coinbase transactions of the
+// block, as it would be connected at the given height, using the passed view
+// for the outputs they spend.  Outputs created earlier in the block may also be
+// spent.  The view is not modified.
+//
+// The coinbase is also checked to not claim more than the block subsidy plus
+// the total fee, in which case ErrBadCoinbaseValue is returned.  The subsidy
+// follows the halving schedule of the main network, which test networks other
+// than the regression test network share.  ErrMissingTxOut is returned when
+// a spent output can't be found, and ErrSpendTooHigh when a transaction spends
+// more than its inputs.
+func (b *BlockNew) TotalFees(v *UtxoView, height int32) (int64, error) {
+	coinbase, err := b.Coinbase()
+	if err != nil {
+		return 0, err
+	}
+
+	// Track the outputs created by the block separately so transactions
+	// may spend the outputs of those before them without modifying the
+	// passed view.
+	blockView := NewUtxoView()
+	blockView.AddTxOuts(coinbase, height)
+	totalFees, err := sumFees(b.Transactions()[1:], v, blockView, height)
+	if err != nil {
+		return 0, err
+	}
+
+	// Ensure the coinbase doesn't claim more than it is allowed to.
+	var coinbaseOut int64
+	for _, txOut := range coinbase.MsgTx().TxOut {
+		coinbaseOut += txOut.Value
+	}
+	if coinbaseOut > calcBlockSubsidy(height)+totalFees {
+		return 0, ErrBadCoinbaseValue
+	}
+
+	return totalFees, nil
+}
+
+// InvVect returns the inventory vector which announces the block.
+func (b *BlockNew) InvVect() *wire.InvVect {
+	return wire.NewInvVect(wire.InvTypeBlock, b.Hash())
+}
+
+// TxInvVects returns the inventory vectors which announce each transaction in
+// the block, in the order of the transactions, such as for building an inv
+// message.  See TxNew.InvVect.
+func (b *BlockNew) TxInvVects() []*wire.InvVect {
+	txns := b.Transactions()
+	invVects := make([]*wire.InvVect, 0, len(txns))
+	for _, tx := range txns {
+		invVects = append(invVects, tx.InvVect())
+	}
+	return invVects
+}
+
+// Height returns the saved height of the block in the block chain.  This value
+// will be BlockHeightUnknown if it hasn't already explicitly been set.
+func (b *BlockNew) Height() int32 {
+	return b.blockHeight
+}
+
+// SetHeight sets the height of the block in the block chain.
+func (b *BlockNew) SetHeight(height int32) {
+	b.blockHeight = height
+}
+
+// NewBlockNew returns a new instance of a bitcoin block given an underlying
+// wire.MsgBlockNew.  See BlockNew.
+func NewBlockNew(msgBlockNew *wire.MsgBlockNew) *BlockNew {
+	return &BlockNew{
+		msgBlockNew: msgBlockNew,
+		msgBlock:    msgBlockNew.CreateMsgBlock(),
+		blockHeight: BlockHeightUnknown,
+	}
+}
+
+// AssembleBlock returns a new block made of the passed header and
+// transactions, such as when reconstructing a block relayed as a compact
+// block.  The indices of the transactions are set to their positions in the
+// block once their merkle root has been checked, so they are left untouched on
+// error.  ErrMerkleMismatch is returned when the merkle root of the
+// transactions doesn't match the one committed to by the header, and
+// ErrNoTransactions when there are no transactions.
+func AssembleBlock(header *wire.BlockHeaderNew, txs []*TxNew) (*BlockNew, error) {
+	if len(txs) == 0 {
+		return nil, ErrNoTransactions
+	}
+
+	// Check the merkle root before adding the transactions to the block,
+	// since doing so sets their indices.
+	leaves := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		leaves[i] = *tx.Hash()
+	}
+	merkleRoot := calcMerkleRoot(leaves)
+	if merkleRoot != header.MerkleRoot {
+		return nil, ErrMerkleMismatch
+	}
+
+	b := NewBlockNew(&wire.MsgBlockNew{Header: *header})
+	for _, tx := range txs {
+		b.AppendTx(tx)
+	}
+	b.merkleRoot = &merkleRoot
+	return b, nil
+}
+
+// MedianTimePast returns the median of the timestamps, as Unix times, of the
+// last medianTimeBlocks (11) of the passed block headers, which must be
+// ordered by height, or of all of them when there are fewer.  This is the
+// time against which time-based lock times are evaluated since BIP0113.
+//
+// As in the block chain, the timestamps are sorted and the one at the middle
+// index is taken, so the later of the two middle timestamps is returned when
+// there is an even number of them, as happens near the genesis block.
+// ErrNoHeaders is returned when there are no headers.
+func MedianTimePast(headers []*wire.BlockHeaderNew) (int64, error) {
+	if len(headers) == 0 {
+		return 0, ErrNoHeaders
+	}
+	if len(headers) > medianTimeBlocks {
+		headers = headers[len(headers)-medianTimeBlocks:]
+	}
+
+	timestamps := make([]int64, len(headers))
+	for i, header := range headers {
+		timestamps[i] = header.Timestamp.Unix()
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return timestamps[len(timestamps)/2], nil
+}
@@ -0,0 +1,754 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newTestBlockNew returns the passed legacy block as a BlockNew by decoding its
+// serialization.
+func newTestBlockNew(t *testing.T, msgBlock *wire.MsgBlock) *btcutil.BlockNew {
+	var buf bytes.Buffer
+	if err := msgBlock.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	var msgBlockNew wire.MsgBlockNew
+	if err := msgBlockNew.Deserialize(&buf); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	return btcutil.NewBlockNew(&msgBlockNew)
+}
+
+// TestBlockNew tests the API for BlockNew.
+func TestBlockNew(t *testing.T) {
+	b := newTestBlockNew(t, &Block100000)
+
+	// Ensure we get the same data back out.
+	if b.MsgBlockNew() == nil {
+		t.Errorf("MsgBlockNew: unexpected nil MsgBlockNew")
+	}
+	if height := b.Height(); height != btcutil.BlockHeightUnknown {
+		t.Errorf("Height: got %d, want %d", height,
+			btcutil.BlockHeightUnknown)
+	}
+	b.SetHeight(100000)
+	if height := b.Height(); height != 100000 {
+		t.Errorf("Height: got %d, want 100000", height)
+	}
+
+	// Hash for block 100,000.
+	wantHash := Block100000.BlockHash()
+	for i := 0; i < 2; i++ {
+		if hash := b.Hash(); !hash.IsEqual(&wantHash) {
+			t.Errorf("Hash #%d: got %v, want %v", i, hash, wantHash)
+		}
+	}
+
+	// Ensure the wrapped transactions match the block, are indexed by
+	// their position, and are cached.
+	txs := b.Transactions()
+	if len(txs) != len(Block100000.Transactions) {
+		t.Fatalf("Transactions: got %d transactions, want %d", len(txs),
+			len(Block100000.Transactions))
+	}
+	for i, tx := range txs {
+		wantTxHash := Block100000.Transactions[i].TxHash()
+		if !tx.Hash().IsEqual(&wantTxHash) {
+			t.Errorf("Transactions #%d: got hash %v, want %v", i,
+				tx.Hash(), wantTxHash)
+		}
+		if tx.Index() != i {
+			t.Errorf("Transactions #%d: got index %d", i, tx.Index())
+		}
+		if tx.MsgTxNew() == nil {
+			t.Errorf("Transactions #%d: unexpected nil MsgTxNew", i)
+		}
+		cached, err := b.Tx(i)
+		if err != nil || cached != tx {
+			t.Errorf("Tx #%d: got %p (%v), want cached %p", i,
+				cached, err, tx)
+		}
+	}
+
+	// Ensure out of range transaction indices are rejected.
+	for _, txNum := range []int{-1, len(txs)} {
+		_, err := b.Tx(txNum)
+		if _, ok := err.(btcutil.OutOfRangeError); !ok {
+			t.Errorf("Tx #%d: got error %v, want OutOfRangeError",
+				txNum, err)
+		}
+	}
+}
+
+// TestInvVect ensures blocks and transactions produce the expected inventory
+// vectors.
+func TestInvVect(t *testing.T) {
+	b := newTestBlockNew(t, &Block100000)
+	iv := b.InvVect()
+	if iv.Type != wire.InvTypeBlock || iv.Hash != *b.Hash() {
+		t.Errorf("BlockNew.InvVect: got %v, want type %v hash %v", iv,
+			wire.InvTypeBlock, b.Hash())
+	}
+
+	tests := []struct {
+		name    string
+		tx      *btcutil.TxNew
+		invType wire.InvType
+	}{
+		{"legacy", btcutil.TstNewTxNew(Block100000.Transactions[1]),
+			wire.InvTypeTx},
+		{"witness", btcutil.TstNewTxNew(newMixedWitnessMsgTx()),
+			wire.InvTypeWitnessTx},
+	}
+	for _, test := range tests {
+		iv := test.tx.InvVect()
+		if iv.Type != test.invType {
+			t.Errorf("TxNew.InvVect (%s): got type %v, want %v",
+				test.name, iv.Type, test.invType)
+		}
+		if iv.Hash != *test.tx.Hash() {
+			t.Errorf("TxNew.InvVect (%s): got hash %v, want %v",
+				test.name, iv.Hash, test.tx.Hash())
+		}
+	}
+}
+
+// TestBlockNewTxInvVects ensures the transactions of a block are announced
+// with witness inventory vectors when they have witness data.
+func TestBlockNewTxInvVects(t *testing.T) {
+	// Only the transaction appended to block 100,000 has witness data.
+	b := newTestBlockNew(t, newMixedWitnessMsgBlock())
+	invVects := b.TxInvVects()
+	if len(invVects) != 5 {
+		t.Fatalf("TxInvVects: got %d vectors, want 5", len(invVects))
+	}
+	for i, iv := range invVects {
+		tx, _ := b.Tx(i)
+		wantType := wire.InvTypeTx
+		if i == 4 {
+			wantType = wire.InvTypeWitnessTx
+		}
+		if iv.Type != wantType || iv.Hash != *tx.Hash() {
+			t.Errorf("TxInvVects #%d: got type %v hash %v, want "+
+				"type %v hash %v", i, iv.Type, iv.Hash, wantType,
+				tx.Hash())
+		}
+	}
+}
+
+// newMixedWitnessMsgBlock returns a copy of block 100,000 with a transaction
+// paying to a P2WPKH output appended, so the block has a mix of output script
+// types.
+func newMixedWitnessMsgBlock() *wire.MsgBlock {
+	msgBlock := &wire.MsgBlock{Header: Block100000.Header}
+	for _, msgTx := range Block100000.Transactions {
+		msgBlock.AddTransaction(msgTx.Copy())
+	}
+	msgBlock.AddTransaction(newMixedWitnessMsgTx())
+	return msgBlock
+}
+
+// TestBlockNewScriptTypeHistogram ensures the output scripts of a block are
+// counted by class.
+func TestBlockNewScriptTypeHistogram(t *testing.T) {
+	// Block 100,000 has a pay-to-pubkey coinbase output and five
+	// pay-to-pubkey-hash outputs, and the appended transaction has a
+	// single P2WPKH output.
+	b := newTestBlockNew(t, newMixedWitnessMsgBlock())
+	want := map[btcutil.ScriptClass]int{
+		btcutil.PubKeyTy:              1,
+		btcutil.PubKeyHashTy:          5,
+		btcutil.WitnessV0PubKeyHashTy: 1,
+	}
+	got := b.ScriptTypeHistogram()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScriptTypeHistogram: got %v, want %v", got, want)
+	}
+}
+
+// TestBlockNewFindOutputs ensures the outputs paying to a watched script are
+// found across the transactions of a block.
+func TestBlockNewFindOutputs(t *testing.T) {
+	// Pay the watched script, which is the second output of the second
+	// transaction of block 100,000, from the appended transaction too.
+	msgBlock := newMixedWitnessMsgBlock()
+	watched := msgBlock.Transactions[1].TxOut[1].PkScript
+	witnessTx := msgBlock.Transactions[4]
+	witnessTx.AddTxOut(wire.NewTxOut(1000, watched))
+	b := newTestBlockNew(t, msgBlock)
+
+	want := []wire.OutPoint{
+		{Hash: msgBlock.Transactions[1].TxHash(), Index: 1},
+		{Hash: witnessTx.TxHash(), Index: 1},
+	}
+	got := b.FindOutputs(watched)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindOutputs: got %v, want %v", got, want)
+	}
+
+	// Scripts which aren't paid in the block have no outputs.
+	if got := b.FindOutputs([]byte{0x51}); len(got) != 0 {
+		t.Errorf("FindOutputs: got %v, want no outputs", got)
+	}
+}
+
+// TestBlockNewTouchedAddresses ensures the addresses paid by the outputs of a
+// block and by the outputs its inputs spend are returned once each.
+func TestBlockNewTouchedAddresses(t *testing.T) {
+	// The first input of the appended transaction spends a P2WPKH output,
+	// and the second spends an output paying the same address as the
+	// second output of the second transaction.  The outputs spent by block
+	// 100,000 are unknown.
+	msgBlock := newMixedWitnessMsgBlock()
+	dupScript := msgBlock.Transactions[1].TxOut[1].PkScript
+	fetch := func(outPoint wire.OutPoint) ([]byte, bool) {
+		switch outPoint {
+		case wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 0}:
+			return p2wpkhScript, true
+		case wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 1}:
+			return dupScript, true
+		case wire.OutPoint{Hash: chainhash.Hash{}, Index: 0xffffffff}:
+			t.Errorf("TouchedAddresses: fetched coinbase outpoint")
+		}
+		return nil, false
+	}
+	b := newTestBlockNew(t, msgBlock)
+	addrs, err := b.TouchedAddresses(&chaincfg.MainNetParams, fetch)
+	if err != nil {
+		t.Fatalf("TouchedAddresses: unexpected error: %v", err)
+	}
+
+	want := []string{
+		"1HWqMzw1jfpXb3xyuUZ4uWXY4tqL2cW47J",
+		"1JqDybm2nWTENrHvMyafbSXXtTk5Uv5QAn",
+		"1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx",
+		"1H8ANdafjpqYntniT3Ddxh4xPBMCSz33pj",
+		"1Am9UTGfdnxabvcywYG2hvzr6qK8T3oUZT",
+		"16FuTPaeRSPVxxCnwQmdyx2PQWxX6HWzhQ",
+		"bc1qdmdud3xnrwhf78xv8pfc5y2t7sk7vh5xcsej79",
+		"bc1q42424242424242424242424242424242ty9ll3",
+	}
+	got := make([]string, len(addrs))
+	for i, addr := range addrs {
+		got[i] = addr.EncodeAddress()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TouchedAddresses: got %v, want %v", got, want)
+	}
+
+	// Spent outputs whose scripts don't parse are skipped like those which
+	// can't be fetched.
+	noFetch := func(wire.OutPoint) ([]byte, bool) {
+		return nil, false
+	}
+	badFetch := func(wire.OutPoint) ([]byte, bool) {
+		return []byte{0x4c}, true
+	}
+	addrs, err = b.TouchedAddresses(&chaincfg.MainNetParams, badFetch)
+	if err != nil {
+		t.Fatalf("TouchedAddresses: unexpected error: %v", err)
+	}
+	wantAddrs, err := b.TouchedAddresses(&chaincfg.MainNetParams, noFetch)
+	if err != nil {
+		t.Fatalf("TouchedAddresses: unexpected error: %v", err)
+	}
+	if len(wantAddrs) == 0 || !reflect.DeepEqual(addrs, wantAddrs) {
+		t.Errorf("TouchedAddresses: got %v, want %v", addrs, wantAddrs)
+	}
+
+	// A network and fetch function are required.
+	if _, err := b.TouchedAddresses(nil, fetch); err == nil {
+		t.Errorf("TouchedAddresses: accepted nil network")
+	}
+	_, err = b.TouchedAddresses(&chaincfg.MainNetParams, nil)
+	if err == nil {
+		t.Errorf("TouchedAddresses: accepted nil fetch function")
+	}
+}
+
+// TestBlockNewIsTopologicallyOrdered ensures blocks whose transactions spend
+// outputs created later in the block are detected.
+func TestBlockNewIsTopologicallyOrdered(t *testing.T) {
+	parent := spendMsgTx(Block100000.Transactions[1])
+	child := spendMsgTx(parent, Block100000.Transactions[2])
+	unrelated := spendMsgTx(Block100000.Transactions[3])
+
+	tests := []struct {
+		name    string
+		txns    []*wire.MsgTx
+		ordered bool
+	}{
+		{"block 100000", Block100000.Transactions, true},
+		{"parent first", []*wire.MsgTx{Block100000.Transactions[0],
+			parent, unrelated, child}, true},
+		{"child first", []*wire.MsgTx{Block100000.Transactions[0],
+			child, unrelated, parent}, false},
+		{"coinbase only", Block100000.Transactions[:1], true},
+	}
+
+	for _, test := range tests {
+		msgBlock := &wire.MsgBlock{Header: Block100000.Header}
+		for _, msgTx := range test.txns {
+			msgBlock.AddTransaction(msgTx)
+		}
+		b := newTestBlockNew(t, msgBlock)
+		if got := b.IsTopologicallyOrdered(); got != test.ordered {
+			t.Errorf("IsTopologicallyOrdered #%s: got %v, want %v",
+				test.name, got, test.ordered)
+		}
+	}
+}
+
+// TestBlockNewWarmCaches ensures warming the caches of a block populates the
+// hashes of the block and its transactions, and that they may then be read
+// concurrently.  Run with -race to detect any writes during the reads.
+func TestBlockNewWarmCaches(t *testing.T) {
+	b := newTestBlockNew(t, newMixedWitnessMsgBlock())
+	b.WarmCaches()
+
+	wantHash := Block100000.BlockHash()
+	wantMerkleRoot := b.CalcMerkleRoot()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if hash := b.Hash(); !hash.IsEqual(&wantHash) {
+				t.Errorf("Hash: got %v, want %v", hash, wantHash)
+			}
+			if root := b.CalcMerkleRoot(); root != wantMerkleRoot {
+				t.Errorf("CalcMerkleRoot: got %v, want %v", root,
+					wantMerkleRoot)
+			}
+			for i, tx := range b.Transactions() {
+				msgTx := b.MsgBlock().Transactions[i]
+				wantTxHash := msgTx.TxHash()
+				if !tx.Hash().IsEqual(&wantTxHash) {
+					t.Errorf("Hash #%d: got %v, want %v", i,
+						tx.Hash(), wantTxHash)
+				}
+				wantWitnessHash := msgTx.WitnessHash()
+				if !tx.WitnessHash().IsEqual(&wantWitnessHash) {
+					t.Errorf("WitnessHash #%d: got %v, want %v",
+						i, tx.WitnessHash(), wantWitnessHash)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestBlockNewSerializeBase ensures the base serialization of a block strips
+// the witness data of its transactions without changing their hashes, while
+// the witness serialization keeps it.
+func TestBlockNewSerializeBase(t *testing.T) {
+	msgBlock := newMixedWitnessMsgBlock()
+	b := newTestBlockNew(t, msgBlock)
+
+	var base, witness bytes.Buffer
+	if err := b.SerializeBase(&base); err != nil {
+		t.Fatalf("SerializeBase: %v", err)
+	}
+	if err := b.SerializeWitness(&witness); err != nil {
+		t.Fatalf("SerializeWitness: %v", err)
+	}
+	var want bytes.Buffer
+	if err := msgBlock.Serialize(&want); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if !bytes.Equal(witness.Bytes(), want.Bytes()) {
+		t.Errorf("SerializeWitness: got %x, want %x", witness.Bytes(),
+			want.Bytes())
+	}
+	if base.Len() >= witness.Len() {
+		t.Errorf("SerializeBase: got %d bytes, want fewer than the %d "+
+			"of the witness serialization", base.Len(), witness.Len())
+	}
+
+	var baseBlock wire.MsgBlock
+	if err := baseBlock.Deserialize(&base); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if baseBlock.BlockHash() != msgBlock.BlockHash() {
+		t.Errorf("SerializeBase: got block hash %v, want %v",
+			baseBlock.BlockHash(), msgBlock.BlockHash())
+	}
+	for i, msgTx := range baseBlock.Transactions {
+		if msgTx.HasWitness() {
+			t.Errorf("SerializeBase: transaction %d has witness", i)
+		}
+		if msgTx.TxHash() != msgBlock.Transactions[i].TxHash() {
+			t.Errorf("SerializeBase: got hash %v for transaction "+
+				"%d, want %v", msgTx.TxHash(), i,
+				msgBlock.Transactions[i].TxHash())
+		}
+	}
+}
+
+// TestBlockNewAppendTx ensures appended transactions are indexed by their
+// position and the cached hashes of the block are recomputed.
+func TestBlockNewAppendTx(t *testing.T) {
+	b := newTestBlockNew(t, &Block100000)
+	oldHash := *b.Hash()
+	oldMerkleRoot := b.CalcMerkleRoot()
+
+	txns := []*btcutil.TxNew{
+		btcutil.TstNewTxNew(newMixedWitnessMsgTx()),
+		btcutil.TstNewTxNew(spendMsgTx(Block100000.Transactions[3])),
+	}
+	for i, tx := range txns {
+		b.AppendTx(tx)
+		wantIndex := len(Block100000.Transactions) + i
+		if tx.Index() != wantIndex {
+			t.Errorf("AppendTx #%d: got index %d, want %d", i,
+				tx.Index(), wantIndex)
+		}
+		if got, err := b.Tx(wantIndex); err != nil || got != tx {
+			t.Errorf("Tx #%d: got %p (%v), want %p", wantIndex, got,
+				err, tx)
+		}
+	}
+	if got := len(b.Transactions()); got != len(Block100000.Transactions)+2 {
+		t.Errorf("Transactions: got %d transactions, want %d", got,
+			len(Block100000.Transactions)+2)
+	}
+	if got := len(b.MsgBlockNew().Transactions); got != len(b.Transactions()) {
+		t.Errorf("MsgBlockNew: got %d transactions, want %d", got,
+			len(b.Transactions()))
+	}
+
+	// The merkle root must cover the appended transactions, and the block
+	// hash must reflect the header once it commits to them.
+	merkleRoot := b.CalcMerkleRoot()
+	if merkleRoot == oldMerkleRoot {
+		t.Errorf("CalcMerkleRoot: merkle root was not recomputed")
+	}
+	b.MsgBlock().Header.MerkleRoot = merkleRoot
+	wantHash := b.MsgBlock().BlockHash()
+	if hash := b.Hash(); hash.IsEqual(&oldHash) || !hash.IsEqual(&wantHash) {
+		t.Errorf("Hash: got %v, want %v", hash, wantHash)
+	}
+}
+
+// TestBlockNewCoinbase ensures the coinbase transaction of a block is returned
+// and blocks without one are rejected.
+func TestBlockNewCoinbase(t *testing.T) {
+	b := newTestBlockNew(t, &Block100000)
+	coinbase, err := b.Coinbase()
+	if err != nil {
+		t.Fatalf("Coinbase: unexpected error: %v", err)
+	}
+	if first, _ := b.Tx(0); coinbase != first {
+		t.Errorf("Coinbase: got %v, want first transaction %v",
+			coinbase.Hash(), first.Hash())
+	}
+
+	// Blocks without any transactions have no coinbase.
+	b = newTestBlockNew(t, &wire.MsgBlock{Header: Block100000.Header})
+	if _, err := b.Coinbase(); err != btcutil.ErrNoTransactions {
+		t.Errorf("Coinbase: got error %v, want %v", err,
+			btcutil.ErrNoTransactions)
+	}
+
+	// Blocks whose first transaction isn't a coinbase are rejected.
+	msgBlock := &wire.MsgBlock{Header: Block100000.Header}
+	msgBlock.AddTransaction(Block100000.Transactions[1])
+	b = newTestBlockNew(t, msgBlock)
+	if _, err := b.Coinbase(); err != btcutil.ErrNotCoinBase {
+		t.Errorf("Coinbase: got error %v, want %v", err,
+			btcutil.ErrNotCoinBase)
+	}
+}
+
+// TestBlockNewTotalFees ensures the fees of a block are totaled and coinbases
+// claiming more than the subsidy and fees are rejected.
+func TestBlockNewTotalFees(t *testing.T) {
+	// Create a block at height 100,000, which has a subsidy of 50 BTC,
+	// with a transaction paying a fee of 1000 satoshi and another spending
+	// it that pays a fee of 500 satoshi.
+	const height = 100000
+	confirmed := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	parent := wire.NewMsgTx(wire.TxVersion)
+	parent.AddTxIn(wire.NewTxIn(&confirmed, nil, nil))
+	parent.AddTxOut(wire.NewTxOut(9000, p2pkhScript))
+	child := spendMsgTx(parent)
+	child.TxOut[0].Value = 8500
+
+	newBlock := func(coinbaseValue int64) *btcutil.BlockNew {
+		coinbase := Block100000.Transactions[0].Copy()
+		coinbase.TxOut[0].Value = coinbaseValue
+		msgBlock := &wire.MsgBlock{Header: Block100000.Header}
+		msgBlock.AddTransaction(coinbase)
+		msgBlock.AddTransaction(parent)
+		msgBlock.AddTransaction(child)
+		return newTestBlockNew(t, msgBlock)
+	}
+
+	view := btcutil.NewUtxoView()
+	view.AddEntry(confirmed, btcutil.NewUtxoEntry(
+		wire.NewTxOut(10000, p2pkhScript), 99000, false))
+
+	tests := []struct {
+		name          string
+		coinbaseValue int64
+		view          *btcutil.UtxoView
+		fees          int64
+		err           error
+	}{
+		{"exact claim", 5000001500, view, 1500, nil},
+		{"under claim", 5000000000, view, 1500, nil},
+		{"over claim", 5000001501, view, 0, btcutil.ErrBadCoinbaseValue},
+		{"missing input", 5000000000, btcutil.NewUtxoView(), 0,
+			btcutil.ErrMissingTxOut},
+	}
+
+	for _, test := range tests {
+		b := newBlock(test.coinbaseValue)
+		fees, err := b.TotalFees(test.view, height)
+		if err != test.err {
+			t.Errorf("TotalFees #%s: got error %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if fees != test.fees {
+			t.Errorf("TotalFees #%s: got %d, want %d", test.name,
+				fees, test.fees)
+		}
+	}
+
+	// The view must not be modified.
+	if entries := view.Entries(); len(entries) != 1 {
+		t.Errorf("TotalFees: view has %d entries, want 1", len(entries))
+	}
+}
+
+// TestAssembleBlock ensures blocks are only assembled from transactions which
+// match the merkle root of the header.
+func TestAssembleBlock(t *testing.T) {
+	header := wire.BlockHeaderNew(Block100000.Header)
+	var txns []*btcutil.TxNew
+	for _, msgTx := range Block100000.Transactions {
+		var buf bytes.Buffer
+		if err := msgTx.Serialize(&buf); err != nil {
+			t.Fatalf("Serialize: %v", err)
+		}
+		tx, err := btcutil.NewTxNewFromBytes(buf.Bytes())
+		if err != nil {
+			t.Fatalf("NewTxNewFromBytes: %v", err)
+		}
+		txns = append(txns, tx)
+	}
+
+	b, err := btcutil.AssembleBlock(&header, txns)
+	if err != nil {
+		t.Fatalf("AssembleBlock: unexpected error: %v", err)
+	}
+	if hash, want := b.Hash(), Block100000.BlockHash(); !hash.IsEqual(&want) {
+		t.Errorf("Hash: got %v, want %v", hash, want)
+	}
+	for i, tx := range b.Transactions() {
+		if tx != txns[i] || tx.Index() != i {
+			t.Errorf("Transactions #%d: got %p at index %d, want %p",
+				i, tx, tx.Index(), txns[i])
+		}
+	}
+	var buf bytes.Buffer
+	if err := b.SerializeWitness(&buf); err != nil {
+		t.Fatalf("SerializeWitness: %v", err)
+	}
+	var want bytes.Buffer
+	if err := Block100000.Serialize(&want); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Errorf("SerializeWitness: assembled block differs")
+	}
+
+	// Reordering, omitting, or replacing transactions must be detected.
+	tampered := [][]*btcutil.TxNew{
+		{txns[0], txns[2], txns[1], txns[3]},
+		txns[:3],
+		{txns[0], txns[1], txns[2],
+			btcutil.TstNewTxNew(spendMsgTx(Block100000.Transactions[3]))},
+	}
+	for i, txs := range tampered {
+		_, err := btcutil.AssembleBlock(&header, txs)
+		if err != btcutil.ErrMerkleMismatch {
+			t.Errorf("AssembleBlock #%d: got error %v, want %v", i,
+				err, btcutil.ErrMerkleMismatch)
+		}
+	}
+
+	// The transactions must be left untouched by a failed assembly.
+	for i, tx := range txns {
+		if tx.Index() != i {
+			t.Errorf("Index #%d: got %d after failed assembly", i,
+				tx.Index())
+		}
+	}
+
+	_, err = btcutil.AssembleBlock(&header, nil)
+	if err != btcutil.ErrNoTransactions {
+		t.Errorf("AssembleBlock: got error %v, want %v", err,
+			btcutil.ErrNoTransactions)
+	}
+}
+
+// TestBlockNewOpReturn ensures OP_RETURN outputs and their payloads are
+// counted.
+func TestBlockNewOpReturn(t *testing.T) {
+	// Block 100,000 doesn't have any OP_RETURN outputs.
+	b := newTestBlockNew(t, &Block100000)
+	if got := b.OpReturnCount(); got != 0 {
+		t.Errorf("OpReturnCount: got %d, want 0", got)
+	}
+	if got := b.OpReturnBytes(); got != 0 {
+		t.Errorf("OpReturnBytes: got %d, want 0", got)
+	}
+
+	// Add two transactions carrying data, one of which carries it in two
+	// outputs, along with a bare OP_RETURN output and a 40 byte push.
+	msgBlock := newMixedWitnessMsgBlock()
+	dataTx1 := spendMsgTx(msgBlock.Transactions[1])
+	dataTx1.AddTxOut(wire.NewTxOut(0, nullDataScript))
+	dataTx2 := spendMsgTx(msgBlock.Transactions[2])
+	dataTx2.AddTxOut(wire.NewTxOut(0, []byte{0x6a}))
+	dataTx2.AddTxOut(wire.NewTxOut(0, append([]byte{0x6a, 0x28},
+		bytes.Repeat([]byte{0xaa}, 40)...)))
+	msgBlock.AddTransaction(dataTx1)
+	msgBlock.AddTransaction(dataTx2)
+	b = newTestBlockNew(t, msgBlock)
+
+	if got := b.OpReturnCount(); got != 3 {
+		t.Errorf("OpReturnCount: got %d, want 3", got)
+	}
+	if got := b.OpReturnBytes(); got != 4+40 {
+		t.Errorf("OpReturnBytes: got %d, want %d", got, 4+40)
+	}
+}
+
+// TestBlockNewUtxoDelta ensures the outputs a block adds to the unspent
+// transaction output set and the inputs removing entries from it are counted.
+func TestBlockNewUtxoDelta(t *testing.T) {
+	// The spending transaction spends two outputs and creates one
+	// spendable output along with a provably unspendable one.  The inputs
+	// of the coinbase don't spend anything.
+	spending := spendMsgTx(Block100000.Transactions[1],
+		Block100000.Transactions[2])
+	spending.AddTxOut(wire.NewTxOut(0, nullDataScript))
+	msgBlock := &wire.MsgBlock{Header: Block100000.Header}
+	msgBlock.AddTransaction(Block100000.Transactions[0])
+	msgBlock.AddTransaction(spending)
+	b := newTestBlockNew(t, msgBlock)
+
+	created, spent := b.UtxoDelta()
+	if created != 2 || spent != 2 {
+		t.Errorf("UtxoDelta: got %d created and %d spent, want 2 and 2",
+			created, spent)
+	}
+}
+
+// TestBlockNewToLegacyMsgBlock ensures blocks survive a round trip through the
+// legacy format, including witness data, and that blocks whose transactions
+// don't match the merkle root in their header are rejected.
+func TestBlockNewToLegacyMsgBlock(t *testing.T) {
+	// The header of the block with the appended witness transaction
+	// commits to the transactions of block 100,000 until it's updated.
+	mismatched := newMixedWitnessMsgBlock()
+	witnessBlock := newMixedWitnessMsgBlock()
+	witnessBlock.Header.MerkleRoot = newTestBlockNew(t,
+		witnessBlock).CalcMerkleRoot()
+
+	for _, msgBlock := range []*wire.MsgBlock{&Block100000, witnessBlock} {
+		b := newTestBlockNew(t, msgBlock)
+		legacy, err := b.ToLegacyMsgBlock()
+		if err != nil {
+			t.Fatalf("ToLegacyMsgBlock: unexpected error: %v", err)
+		}
+		if legacy.Header.MerkleRoot != msgBlock.Header.MerkleRoot {
+			t.Errorf("ToLegacyMsgBlock: got merkle root %v, "+
+				"want %v", legacy.Header.MerkleRoot,
+				msgBlock.Header.MerkleRoot)
+		}
+		if legacy.Transactions[0] == b.MsgBlock().Transactions[0] {
+			t.Errorf("ToLegacyMsgBlock: transactions shared with " +
+				"MsgBlock")
+		}
+
+		var got, want bytes.Buffer
+		if err := legacy.Serialize(&got); err != nil {
+			t.Fatalf("Serialize: %v", err)
+		}
+		if err := msgBlock.Serialize(&want); err != nil {
+			t.Fatalf("Serialize: %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("ToLegacyMsgBlock: got %x, want %x",
+				got.Bytes(), want.Bytes())
+		}
+	}
+
+	b := newTestBlockNew(t, mismatched)
+	if _, err := b.ToLegacyMsgBlock(); err != btcutil.ErrMerkleMismatch {
+		t.Errorf("ToLegacyMsgBlock: got error %v, want %v", err,
+			btcutil.ErrMerkleMismatch)
+	}
+}
+
+// TestMedianTimePast ensures the median time past is the median of the
+// timestamps of the last 11 headers regardless of their order.
+func TestMedianTimePast(t *testing.T) {
+	newHeaders := func(timestamps ...int64) []*wire.BlockHeaderNew {
+		headers := make([]*wire.BlockHeaderNew, len(timestamps))
+		for i, timestamp := range timestamps {
+			headers[i] = &wire.BlockHeaderNew{
+				Timestamp: time.Unix(timestamp, 0),
+			}
+		}
+		return headers
+	}
+
+	tests := []struct {
+		name    string
+		headers []*wire.BlockHeaderNew
+		want    int64
+	}{
+		{"single", newHeaders(1000), 1000},
+		{"odd count", newHeaders(1300, 1100, 1200), 1200},
+		{"even count", newHeaders(1000, 1400, 1200, 1300), 1300},
+		// Only the last 11 of the 12 timestamps count, so the median
+		// is 1006 rather than the 1007 including the first one.
+		{"more than 11", newHeaders(2000, 1011, 1002, 1010, 1003, 1009,
+			1004, 1008, 1005, 1007, 1006, 1001), 1006},
+	}
+
+	for _, test := range tests {
+		got, err := btcutil.MedianTimePast(test.headers)
+		if err != nil {
+			t.Errorf("MedianTimePast #%s: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("MedianTimePast #%s: got %d, want %d",
+				test.name, got, test.want)
+		}
+	}
+
+	if _, err := btcutil.MedianTimePast(nil); err != btcutil.ErrNoHeaders {
+		t.Errorf("MedianTimePast: got error %v, want %v", err,
+			btcutil.ErrNoHeaders)
+	}
+}
@@ -76,6 +76,14 @@ func NewFilter(elements, tweak uint32, fprate float64, flags wire.BloomUpdateTyp
 	}
 }
 
+// NewBloomFilter creates a new bloom filter instance like NewFilter which adds
+// the outpoints of all matched outputs to the filter, as with
+// wire.BloomUpdateAll, so transactions spending them are matched too.  This
+// is what SPV clients watching their own addresses typically need.
+func NewBloomFilter(elements, tweak uint32, fprate float64) *Filter {
+	return NewFilter(elements, tweak, fprate, wire.BloomUpdateAll)
+}
+
 // LoadFilter creates a new Filter instance with the given underlying
 // wire.MsgFilterLoad.
 func LoadFilter(filter *wire.MsgFilterLoad) *Filter {
@@ -265,15 +273,16 @@ func (bf *Filter) maybeAddOutpoint(pkScript []byte, outHash *chainhash.Hash, out
 }
 
 // matchTxAndUpdate returns true if the bloom filter matches data within the
-// passed transaction, otherwise false is returned.  If the filter does match
-// the passed transaction, it will also update the filter depending on the bloom
-// update flags set via the loaded filter if needed.
+// passed transaction, which has the passed hash, otherwise false is returned.
+// If the filter does match the passed transaction, it will also update the
+// filter depending on the bloom update flags set via the loaded filter if
+// needed.
 //
 // This function MUST be called with the filter lock held.
-func (bf *Filter) matchTxAndUpdate(tx *btcutil.Tx) bool {
+func (bf *Filter) matchTxAndUpdate(txHash *chainhash.Hash, msgTx *wire.MsgTx) bool {
 	// Check if the filter matches the hash of the transaction.
 	// This is useful for finding transactions when they appear in a block.
-	matched := bf.matches(tx.Hash()[:])
+	matched := bf.matches(txHash[:])
 
 	// Check if the filter matches any data elements in the public key
 	// scripts of any of the outputs.  When it does, add the outpoint that
@@ -283,7 +292,7 @@ func (bf *Filter) matchTxAndUpdate(tx *btcutil.Tx) bool {
 	// on the network since it avoids the need for another filteradd message
 	// from the client and avoids some potential races that could otherwise
 	// occur.
-	for i, txOut := range tx.MsgTx().TxOut {
+	for i, txOut := range msgTx.TxOut {
 		pushedData, err := txscript.PushedData(txOut.PkScript)
 		if err != nil {
 			continue
@@ -295,7 +304,7 @@ func (bf *Filter) matchTxAndUpdate(tx *btcutil.Tx) bool {
 			}
 
 			matched = true
-			bf.maybeAddOutpoint(txOut.PkScript, tx.Hash(), uint32(i))
+			bf.maybeAddOutpoint(txOut.PkScript, txHash, uint32(i))
 			break
 		}
 	}
@@ -310,7 +319,7 @@ func (bf *Filter) matchTxAndUpdate(tx *btcutil.Tx) bool {
 
 	// Check if the filter matches any outpoints this transaction spends or
 	// any any data elements in the signature scripts of any of the inputs.
-	for _, txin := range tx.MsgTx().TxIn {
+	for _, txin := range msgTx.TxIn {
 		if bf.matchesOutPoint(&txin.PreviousOutPoint) {
 			return true
 		}
@@ -337,7 +346,21 @@ func (bf *Filter) matchTxAndUpdate(tx *btcutil.Tx) bool {
 // This function is safe for concurrent access.
 func (bf *Filter) MatchTxAndUpdate(tx *btcutil.Tx) bool {
 	bf.mtx.Lock()
-	match := bf.matchTxAndUpdate(tx)
+	match := bf.matchTxAndUpdate(tx.Hash(), tx.MsgTx())
+	bf.mtx.Unlock()
+	return match
+}
+
+// MatchTxNewAndUpdate returns true if the bloom filter matches data within
+// the passed transaction in the new experimental format, otherwise false is
+// returned.  It is the same as MatchTxAndUpdate, including updating the filter
+// with the outpoints of matched outputs as described by BIP0037 depending on
+// the bloom update flags.
+//
+// This function is safe for concurrent access.
+func (bf *Filter) MatchTxNewAndUpdate(tx *btcutil.TxNew) bool {
+	bf.mtx.Lock()
+	match := bf.matchTxAndUpdate(tx.Hash(), tx.MsgTx())
 	bf.mtx.Unlock()
 	return match
 }
@@ -9,7 +9,9 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcutil/bloom"
@@ -658,3 +660,70 @@ func TestFilterReload(t *testing.T) {
 		t.Errorf("TestFilterReload Reload test failed")
 	}
 }
+
+// TestFilterMatchTxNewAndUpdate ensures transactions in the new experimental
+// format paying a watched address are matched, and that the outpoints of the
+// matched outputs are added to the filter so transactions spending them are
+// matched too.
+func TestFilterMatchTxNewAndUpdate(t *testing.T) {
+	watched, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{0x01},
+		20), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: %v", err)
+	}
+	other, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{0x02},
+		20), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: %v", err)
+	}
+	watchedScript, err := txscript.PayToAddrScript(watched)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+	otherScript, err := txscript.PayToAddrScript(other)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+	newTx := func(prevOut *wire.OutPoint, pkScript []byte) *btcutil.TxNew {
+		msgTx := wire.NewMsgTx(1)
+		msgTx.AddTxIn(wire.NewTxIn(prevOut, []byte{0x51}, nil))
+		msgTx.AddTxOut(wire.NewTxOut(1000, pkScript))
+		msgTx.AddTxOut(wire.NewTxOut(2000, otherScript))
+		tx, err := btcutil.TxNewFromLegacy(msgTx)
+		if err != nil {
+			t.Fatalf("TxNewFromLegacy: %v", err)
+		}
+		return tx
+	}
+
+	f := bloom.NewBloomFilter(10, 0, 0.000001)
+	f.Add(watched.ScriptAddress())
+
+	// A transaction which doesn't pay the watched address isn't matched.
+	unrelated := newTx(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		otherScript)
+	if f.MatchTxNewAndUpdate(unrelated) {
+		t.Errorf("MatchTxNewAndUpdate: matched unrelated transaction")
+	}
+
+	// The first output of the funding transaction pays the watched
+	// address, so only its outpoint is added.
+	funding := newTx(&wire.OutPoint{Hash: chainhash.Hash{0x02}},
+		watchedScript)
+	if !f.MatchTxNewAndUpdate(funding) {
+		t.Errorf("MatchTxNewAndUpdate: funding transaction not matched")
+	}
+	if !f.MatchesOutPoint(wire.NewOutPoint(funding.Hash(), 0)) {
+		t.Errorf("MatchTxNewAndUpdate: matched outpoint not added")
+	}
+	if f.MatchesOutPoint(wire.NewOutPoint(funding.Hash(), 1)) {
+		t.Errorf("MatchTxNewAndUpdate: unmatched outpoint added")
+	}
+
+	// A transaction spending the matched output is matched even though it
+	// doesn't pay the watched address.
+	spending := newTx(wire.NewOutPoint(funding.Hash(), 0), otherScript)
+	if !f.MatchTxNewAndUpdate(spending) {
+		t.Errorf("MatchTxNewAndUpdate: spending transaction not matched")
+	}
+}
@@ -7,7 +7,9 @@ package coinset
 import (
 	"container/list"
 	"errors"
+	"math/rand"
 	"sort"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
@@ -141,6 +143,199 @@ func NewMsgTxWithInputCoins(txVersion int32, inputCoins Coins) *wire.MsgTx {
 	return msgTx
 }
 
+// maxFundingIterations is the maximum number of times BuildFundedTxNew will
+// reselect coins after finding the fee of the previous selection uncovered.
+const maxFundingIterations = 10
+
+// changeDustThreshold returns the value below which an output paying to the
+// passed script is considered dust, using the same calculation as the
+// reference implementation with its default minimum relay fee of 1000
+// satoshi per kilobyte.  That is, an output is dust when it costs more than
+// a third of its value to create and later spend it.
+func changeDustThreshold(pkScript []byte) btcutil.Amount {
+	txOut := wire.TxOut{PkScript: pkScript}
+	totalSize := txOut.SerializeSize()
+
+	// Spending a witness program output only needs a discounted
+	// witness, otherwise assume a typical p2pkh signature script.
+	if isWitnessProgram(pkScript) {
+		totalSize += 67
+	} else {
+		totalSize += 148
+	}
+	return btcutil.Amount(3 * totalSize)
+}
+
+// isWitnessProgram returns whether the passed script is a segregated witness
+// program, that is a version opcode followed by a single 2 to 40 byte push.
+func isWitnessProgram(pkScript []byte) bool {
+	if len(pkScript) < 4 || len(pkScript) > 42 {
+		return false
+	}
+	if pkScript[0] != 0x00 && (pkScript[0] < 0x51 || pkScript[0] > 0x60) {
+		return false
+	}
+	return int(pkScript[1]) == len(pkScript)-2
+}
+
+// BuildFundedTxNew creates an unsigned transaction paying the recipients,
+// funded by coins chosen by the selector from the passed coins.  Any change
+// is paid to changeScript unless it would be dust, in which case it is left
+// to the fee instead.  The transaction is returned along with the fee it
+// pays.
+//
+// The fee is computed at the given fee rate from the estimated virtual size
+// of the transaction once signed, as by btcutil.TxNew.EstimateSignedVSize,
+// assuming the coins are P2WPKH outputs when they pay to witness programs
+// and P2PKH outputs otherwise, as in inputVSize.  Since adding inputs and the
+// change output grows the transaction, selection is repeated with the updated
+// fee until the selected coins cover it.
+func BuildFundedTxNew(recipients []wire.TxOut, coins []Coin, changeScript []byte,
+	feeRate btcutil.FeeRate, selector CoinSelector) (*btcutil.TxNew, btcutil.Amount, error) {
+
+	var targetValue btcutil.Amount
+	for _, txOut := range recipients {
+		targetValue += btcutil.Amount(txOut.Value)
+	}
+	dustThreshold := changeDustThreshold(changeScript)
+
+	var fee btcutil.Amount
+	for i := 0; i < maxFundingIterations; i++ {
+		selected, err := selector.CoinSelect(targetValue+fee, coins)
+		if err != nil {
+			return nil, 0, err
+		}
+		selectedValue := NewCoinSet(selected.Coins()).TotalValue()
+
+		msgTx := NewMsgTxWithInputCoins(wire.TxVersion, selected)
+		for _, txOut := range recipients {
+			txOut := txOut
+			msgTx.AddTxOut(&txOut)
+		}
+		inputTypes := make([]btcutil.ScriptClass, len(msgTx.TxIn))
+		for j, coin := range selected.Coins() {
+			inputTypes[j] = inputClass(coin.PkScript())
+		}
+
+		// Reselect when the coins don't cover the fee of the
+		// transaction without change.
+		tx, err := btcutil.TxNewFromLegacy(msgTx)
+		if err != nil {
+			return nil, 0, err
+		}
+		signedVSize, err := tx.EstimateSignedVSize(inputTypes)
+		if err != nil {
+			return nil, 0, err
+		}
+		changelessFee := feeRate.FeeForVSize(signedVSize)
+		if selectedValue < targetValue+changelessFee {
+			fee = changelessFee
+			continue
+		}
+
+		// Add a change output when what is left after paying for it
+		// isn't dust, otherwise leave the excess to the fee.
+		changeOut := wire.NewTxOut(0, changeScript)
+		changeFee := feeRate.FeeForVSize(signedVSize +
+			int64(changeOut.SerializeSize()))
+		change, drop, err := btcutil.ComputeChange(selectedValue,
+			targetValue, changeFee, dustThreshold)
+		if err != nil || drop || change == 0 {
+			return tx, selectedValue - targetValue, nil
+		}
+		changeOut.Value = int64(change)
+		msgTx.AddTxOut(changeOut)
+
+		tx, err = btcutil.TxNewFromLegacy(msgTx)
+		if err != nil {
+			return nil, 0, err
+		}
+		return tx, changeFee, nil
+	}
+
+	return nil, 0, ErrCoinsNoSelectionAvailable
+}
+
+// inputClass returns the class of the output paying to the passed script as
+// assumed by inputVSize, that is P2WPKH for witness programs and P2PKH for
+// anything else.
+func inputClass(pkScript []byte) btcutil.ScriptClass {
+	if isWitnessProgram(pkScript) {
+		return btcutil.WitnessV0PubKeyHashTy
+	}
+	return btcutil.PubKeyHashTy
+}
+
+// inputVSize returns the estimated virtual size of an input spending an output
+// paying to the passed script, assuming a witness program is a P2WPKH output
+// and anything else is a P2PKH output.
+func inputVSize(pkScript []byte) int64 {
+	if isWitnessProgram(pkScript) {
+		return 68
+	}
+	return 148
+}
+
+// CoinSelectWithPreselected returns a selection of coins which always includes
+// the preselected coins, such as specific outputs being consolidated, and
+// covers the target value along with the fee for spending all of the selected
+// coins at the passed fee rate.  Additional coins are chosen by the selector
+// from the candidates only when the value of the preselected coins left after
+// paying for their inputs doesn't already cover the target.  Candidates which
+// are also preselected are never chosen twice.
+func CoinSelectWithPreselected(preselected []Coin, targetValue btcutil.Amount,
+	feeRate btcutil.FeeRate, candidates []Coin, selector CoinSelector) (Coins, error) {
+
+	// The preselected coins are used regardless, so only their value
+	// after paying for their inputs contributes to the target.
+	var preselectedValue btcutil.Amount
+	isPreselected := make(map[wire.OutPoint]struct{}, len(preselected))
+	for _, coin := range preselected {
+		preselectedValue += btcutil.Amount(btcutil.EffectiveValue(
+			int64(coin.Value()), inputVSize(coin.PkScript()), feeRate))
+		op := wire.OutPoint{Hash: *coin.Hash(), Index: coin.Index()}
+		isPreselected[op] = struct{}{}
+	}
+	if preselectedValue >= targetValue {
+		return NewCoinSet(preselected), nil
+	}
+
+	remaining := make([]Coin, 0, len(candidates))
+	for _, coin := range candidates {
+		op := wire.OutPoint{Hash: *coin.Hash(), Index: coin.Index()}
+		if _, ok := isPreselected[op]; !ok {
+			remaining = append(remaining, coin)
+		}
+	}
+
+	// Since the additional coins must also pay for their inputs, select
+	// them again with the fee of the previous selection added until it
+	// is covered.
+	var fee btcutil.Amount
+	for i := 0; i < maxFundingIterations; i++ {
+		selected, err := selector.CoinSelect(targetValue-preselectedValue+fee,
+			remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		var selectedFee btcutil.Amount
+		for _, coin := range selected.Coins() {
+			selectedFee += feeRate.FeeForVSize(inputVSize(coin.PkScript()))
+		}
+		if selectedFee <= fee {
+			cs := NewCoinSet(preselected)
+			for _, coin := range selected.Coins() {
+				cs.PushCoin(coin)
+			}
+			return cs, nil
+		}
+		fee = selectedFee
+	}
+
+	return nil, ErrCoinsNoSelectionAvailable
+}
+
 var (
 	// ErrCoinsNoSelectionAvailable is returned when a CoinSelector believes there is no
 	// possible combination of coins which can meet the requirements provided to the selector.
@@ -330,6 +525,157 @@ func (s MinPriorityCoinSelector) CoinSelect(targetValue btcutil.Amount, coins []
 	return nil, ErrCoinsNoSelectionAvailable
 }
 
+// defaultKnapsackIterations is the number of randomized passes the
+// KnapsackCoinSelector makes when no explicit number is configured.
+const defaultKnapsackIterations = 1000
+
+// KnapsackCoinSelector is a CoinSelector that attempts to construct a
+// selection of coins whose total value is at least targetValue using the
+// knapsack approach of the reference client.  Coins exactly matching the
+// target are preferred, followed by the best of several randomized subsets of
+// the coins smaller than the target, and finally the smallest single coin
+// larger than the target.  Change, when there is any, must be at least
+// MinChangeAmount.
+//
+// The selection is randomized using Source, which makes it deterministic for
+// a given seed.  A time seeded source is used when it is nil.
+type KnapsackCoinSelector struct {
+	MinChangeAmount btcutil.Amount
+	Iterations      int
+	Source          rand.Source
+}
+
+// CoinSelect will attempt to select coins using the algorithm described
+// in the KnapsackCoinSelector struct.
+func (s KnapsackCoinSelector) CoinSelect(targetValue btcutil.Amount, coins []Coin) (Coins, error) {
+	source := s.Source
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+	rng := rand.New(source)
+	iterations := s.Iterations
+	if iterations <= 0 {
+		iterations = defaultKnapsackIterations
+	}
+
+	shuffledCoins := make([]Coin, 0, len(coins))
+	shuffledCoins = append(shuffledCoins, coins...)
+	for i := len(shuffledCoins) - 1; i > 0; i-- {
+		j := rng.Intn(i + 1)
+		shuffledCoins[i], shuffledCoins[j] = shuffledCoins[j], shuffledCoins[i]
+	}
+
+	// Return a coin exactly matching the target right away, otherwise
+	// split the coins into those too small to cover the target along with
+	// the minimum change and the smallest of the larger ones.
+	var applicable []Coin
+	var totalLower btcutil.Amount
+	var lowestLarger Coin
+	for _, coin := range shuffledCoins {
+		switch {
+		case coin.Value() == targetValue:
+			return NewCoinSet([]Coin{coin}), nil
+
+		case coin.Value() < targetValue+s.MinChangeAmount:
+			applicable = append(applicable, coin)
+			totalLower += coin.Value()
+
+		case lowestLarger == nil || coin.Value() < lowestLarger.Value():
+			lowestLarger = coin
+		}
+	}
+
+	if totalLower == targetValue {
+		return NewCoinSet(applicable), nil
+	}
+	if totalLower < targetValue {
+		if lowestLarger == nil {
+			return nil, ErrCoinsNoSelectionAvailable
+		}
+		return NewCoinSet([]Coin{lowestLarger}), nil
+	}
+
+	// Find the best subset of the smaller coins, first trying for an exact
+	// match and then for one leaving enough change.
+	sort.Sort(sort.Reverse(byAmount(applicable)))
+	best, bestValue := approximateBestSubset(rng, applicable, totalLower,
+		targetValue, iterations)
+	if bestValue != targetValue && totalLower >= targetValue+s.MinChangeAmount {
+		best, bestValue = approximateBestSubset(rng, applicable,
+			totalLower, targetValue+s.MinChangeAmount, iterations)
+	}
+
+	// Prefer the smallest larger coin when the subset leaves too little
+	// change or isn't any smaller.
+	if lowestLarger != nil &&
+		((bestValue != targetValue && bestValue < targetValue+s.MinChangeAmount) ||
+			lowestLarger.Value() <= bestValue) {
+
+		return NewCoinSet([]Coin{lowestLarger}), nil
+	}
+
+	cs := NewCoinSet(nil)
+	for i, coin := range applicable {
+		if best[i] {
+			cs.PushCoin(coin)
+		}
+	}
+	return cs, nil
+}
+
+// approximateBestSubset performs the randomized search of the knapsack
+// selection.  It returns which of the passed coins, whose values total
+// totalValue, make up the subset with the smallest total of at least
+// targetValue found within the given number of iterations, along with that
+// total.
+func approximateBestSubset(rng *rand.Rand, coins []Coin, totalValue,
+	targetValue btcutil.Amount, iterations int) ([]bool, btcutil.Amount) {
+
+	best := make([]bool, len(coins))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := totalValue
+
+	included := make([]bool, len(coins))
+	for rep := 0; rep < iterations && bestValue != targetValue; rep++ {
+		for i := range included {
+			included[i] = false
+		}
+		var total btcutil.Amount
+		reachedTarget := false
+
+		// The first pass randomly includes coins while the second one
+		// includes all remaining coins until the target is reached.
+		for pass := 0; pass < 2 && !reachedTarget; pass++ {
+			for i, coin := range coins {
+				var include bool
+				if pass == 0 {
+					include = rng.Intn(2) == 0
+				} else {
+					include = !included[i]
+				}
+				if !include {
+					continue
+				}
+
+				total += coin.Value()
+				included[i] = true
+				if total >= targetValue {
+					reachedTarget = true
+					if total < bestValue {
+						bestValue = total
+						copy(best, included)
+					}
+					total -= coin.Value()
+					included[i] = false
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
+
 type byValueAge []Coin
 
 func (a byValueAge) Len() int           { return len(a) }
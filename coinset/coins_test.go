@@ -9,6 +9,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -220,6 +221,86 @@ func TestMinPrioritySelector(t *testing.T) {
 	testCoinSelector(minPriorityTests, t)
 }
 
+var knapsackCoins = []coinset.Coin{
+	NewCoin(1, 100000000, 1),
+	NewCoin(2, 10000000, 20),
+	NewCoin(3, 50000000, 0),
+	NewCoin(4, 25000000, 6),
+	NewCoin(5, 3000000, 2),
+	NewCoin(6, 7000000, 3),
+	NewCoin(7, 1000000, 10),
+}
+
+func TestKnapsackSelector(t *testing.T) {
+	selector := coinset.KnapsackCoinSelector{
+		MinChangeAmount: 10000,
+		Source:          rand.NewSource(1),
+	}
+
+	// An exact match is always selected on its own.
+	tests := []coinSelectTest{
+		{selector, knapsackCoins, 25000000, []coinset.Coin{knapsackCoins[3]}, nil},
+		{selector, knapsackCoins, 200000000, nil, coinset.ErrCoinsNoSelectionAvailable},
+		{selector, nil, 1, nil, coinset.ErrCoinsNoSelectionAvailable},
+	}
+	testCoinSelector(tests, t)
+
+	// The selection must meet the target with either no change or at
+	// least the minimum change.
+	for _, target := range []btcutil.Amount{1, 8000000, 11000000, 40000000, 150000000, 196000000} {
+		cs, err := selector.CoinSelect(target, knapsackCoins)
+		if err != nil {
+			t.Errorf("target %v: unexpected error: %v", target, err)
+			continue
+		}
+		total := coinset.NewCoinSet(cs.Coins()).TotalValue()
+		if total != target && total < target+selector.MinChangeAmount {
+			t.Errorf("target %v: selection of %v does not satisfy "+
+				"target", target, total)
+		}
+	}
+
+	// The smaller coins exactly covering the target are preferred over
+	// the smallest larger coin.
+	cs, err := selector.CoinSelect(11000000, knapsackCoins)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total := coinset.NewCoinSet(cs.Coins()).TotalValue(); total != 11000000 {
+		t.Errorf("expected exact selection of 11000000, got %v", total)
+	}
+}
+
+func TestKnapsackSelectorDeterministic(t *testing.T) {
+	selectWithSeed := func(seed int64) []coinset.Coin {
+		selector := coinset.KnapsackCoinSelector{
+			MinChangeAmount: 10000,
+			Source:          rand.NewSource(seed),
+		}
+		cs, err := selector.CoinSelect(40000000, knapsackCoins)
+		if err != nil {
+			t.Fatalf("seed %d: unexpected error: %v", seed, err)
+		}
+		return cs.Coins()
+	}
+
+	for seed := int64(0); seed < 5; seed++ {
+		first := selectWithSeed(seed)
+		second := selectWithSeed(seed)
+		if len(first) != len(second) {
+			t.Errorf("seed %d: selections differ in size: %d != %d",
+				seed, len(first), len(second))
+			continue
+		}
+		for i := range first {
+			if first[i] != second[i] {
+				t.Errorf("seed %d: selections differ at index %d",
+					seed, i)
+			}
+		}
+	}
+}
+
 var (
 	// should be two outpoints, with 1st one having 0.035BTC value.
 	testSimpleCoinNumConfs            = int64(1)
@@ -258,3 +339,157 @@ func TestSimpleCoin(t *testing.T) {
 		t.Error("Different value of coin value * age than expected")
 	}
 }
+
+func TestBuildFundedTxNew(t *testing.T) {
+	p2pkhScript, _ := hex.DecodeString("76a914000102030405060708090a0b0c0d0e0f1011121388ac")
+	changeScript, _ := hex.DecodeString("76a914131211100f0e0d0c0b0a0908070605040302010088ac")
+	recipients := []wire.TxOut{{Value: 100000, PkScript: p2pkhScript}}
+	selector := coinset.MinIndexCoinSelector{MaxInputs: 10}
+	feeRate := btcutil.FeeRate(1000)
+
+	// A large coin results in a change output paying back the excess.
+	coins := []coinset.Coin{NewCoin(1, 1000000, 1)}
+	tx, fee, err := coinset.BuildFundedTxNew(recipients, coins,
+		changeScript, feeRate, selector)
+	if err != nil {
+		t.Fatalf("BuildFundedTxNew: unexpected error: %v", err)
+	}
+	msgTx := tx.MsgTx()
+	if len(msgTx.TxIn) != 1 || len(msgTx.TxOut) != 2 {
+		t.Fatalf("expected 1 input and 2 outputs, got %d and %d",
+			len(msgTx.TxIn), len(msgTx.TxOut))
+	}
+	// The fee pays for the transaction once its p2pkh input is signed,
+	// not for the smaller unsigned transaction.
+	signedVSize, err := tx.EstimateSignedVSize([]btcutil.ScriptClass{
+		btcutil.PubKeyHashTy})
+	if err != nil {
+		t.Fatalf("EstimateSignedVSize: unexpected error: %v", err)
+	}
+	if signedVSize <= tx.VirtualSize() {
+		t.Errorf("signed size %d not larger than unsigned size %d",
+			signedVSize, tx.VirtualSize())
+	}
+	if want := feeRate.FeeForVSize(signedVSize); fee != want {
+		t.Errorf("unexpected fee: got %v, want %v", fee, want)
+	}
+	change := msgTx.TxOut[1]
+	if !bytes.Equal(change.PkScript, changeScript) {
+		t.Errorf("unexpected change script: %x", change.PkScript)
+	}
+	if got := btcutil.Amount(msgTx.TxOut[0].Value+change.Value) + fee; got != 1000000 {
+		t.Errorf("outputs and fee total %v, want %v", got, 1000000)
+	}
+
+	// A coin leaving only dust after the fee results in no change output,
+	// with the dust going to the fee.  The changeless transaction has a
+	// virtual size of 85 bytes, or 192 bytes once signed.
+	coins = []coinset.Coin{NewCoin(1, 100000+192+100, 1)}
+	tx, fee, err = coinset.BuildFundedTxNew(recipients, coins,
+		changeScript, feeRate, selector)
+	if err != nil {
+		t.Fatalf("BuildFundedTxNew: unexpected error: %v", err)
+	}
+	if tx.VirtualSize() != 85 {
+		t.Errorf("unexpected virtual size: got %d, want 85",
+			tx.VirtualSize())
+	}
+	if len(tx.MsgTx().TxOut) != 1 {
+		t.Errorf("expected 1 output, got %d", len(tx.MsgTx().TxOut))
+	}
+	if fee != 292 {
+		t.Errorf("unexpected fee: got %v, want 292", fee)
+	}
+
+	// Coins covering the fee of the unsigned transaction but not of the
+	// signed one can't fund it.
+	coins = []coinset.Coin{NewCoin(1, 100000+85+100, 1)}
+	_, _, err = coinset.BuildFundedTxNew(recipients, coins, changeScript,
+		feeRate, selector)
+	if err != coinset.ErrCoinsNoSelectionAvailable {
+		t.Errorf("unexpected error: got %v, want %v", err,
+			coinset.ErrCoinsNoSelectionAvailable)
+	}
+
+	// Coins covering the recipients but not the fee can't fund the
+	// transaction.
+	coins = []coinset.Coin{NewCoin(1, 100000, 1)}
+	_, _, err = coinset.BuildFundedTxNew(recipients, coins, changeScript,
+		feeRate, selector)
+	if err != coinset.ErrCoinsNoSelectionAvailable {
+		t.Errorf("unexpected error: got %v, want %v", err,
+			coinset.ErrCoinsNoSelectionAvailable)
+	}
+}
+
+func TestCoinSelectWithPreselected(t *testing.T) {
+	// Spending each test coin, which is assumed to be a p2pkh output,
+	// costs 1480 satoshi at this rate.
+	feeRate := btcutil.FeeRate(10000)
+	selector := coinset.MinIndexCoinSelector{MaxInputs: 10}
+
+	tests := []struct {
+		name          string
+		preselected   []coinset.Coin
+		targetValue   btcutil.Amount
+		expectedCoins []coinset.Coin
+		expectedError error
+	}{
+		{
+			name:          "preselected cover target",
+			preselected:   []coinset.Coin{coins[0]},
+			targetValue:   50000000,
+			expectedCoins: []coinset.Coin{coins[0]},
+		},
+		{
+			name:          "preselected cover target exactly",
+			preselected:   []coinset.Coin{coins[1]},
+			targetValue:   10000000 - 1480,
+			expectedCoins: []coinset.Coin{coins[1]},
+		},
+		{
+			name:          "preselected don't cover input fee",
+			preselected:   []coinset.Coin{coins[1]},
+			targetValue:   10000000,
+			expectedCoins: []coinset.Coin{coins[1], coins[0]},
+		},
+		{
+			name:          "preselected selected once",
+			preselected:   []coinset.Coin{coins[0], coins[2]},
+			targetValue:   159000000,
+			expectedCoins: []coinset.Coin{coins[0], coins[2], coins[1]},
+		},
+		{
+			name:          "insufficient candidates",
+			preselected:   []coinset.Coin{coins[0]},
+			targetValue:   200000000,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+	}
+
+	for _, test := range tests {
+		cs, err := coinset.CoinSelectWithPreselected(test.preselected,
+			test.targetValue, feeRate, coins, selector)
+		if err != test.expectedError {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.expectedError)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := cs.Coins()
+		if len(got) != len(test.expectedCoins) {
+			t.Errorf("%s: got %d coins, want %d", test.name,
+				len(got), len(test.expectedCoins))
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expectedCoins[i] {
+				t.Errorf("%s: coin %d mismatch - got %v, want %v",
+					test.name, i, got[i].Value(),
+					test.expectedCoins[i].Value())
+			}
+		}
+	}
+}
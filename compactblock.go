@@ -0,0 +1,37 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"encoding/binary"
+
+	"github.com/aead/siphash"
+)
+
+// shortIDMask is the mask which keeps the low 6 bytes of a SipHash-2-4 value
+// to form a BIP0152 short transaction id.
+const shortIDMask = 1<<48 - 1
+
+// ShortIDs returns the BIP0152 short transaction ids of the transactions of
+// the block, in order, for the SipHash key made of key0 and key1, which are
+// derived from the header of the block and a nonce when relaying it as a
+// compact block.  The ids are the low 6 bytes of the SipHash-2-4 of the witness
+// hashes of the transactions as used by version 2 compact blocks.  For
+// transactions without witness data, these are the same as their hashes.
+func (b *BlockNew) ShortIDs(key0, key1 uint64) []uint64 {
+	// The SipHash key is key0 followed by key1, both in little-endian
+	// order.
+	var key [16]byte
+	binary.LittleEndian.PutUint64(key[:8], key0)
+	binary.LittleEndian.PutUint64(key[8:], key1)
+
+	txns := b.Transactions()
+	shortIDs := make([]uint64, len(txns))
+	for i, tx := range txns {
+		shortIDs[i] = siphash.Sum64(tx.WitnessHash()[:], &key) &
+			shortIDMask
+	}
+	return shortIDs
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestBlockNewShortIDs ensures the BIP0152 short transaction ids of a block
+// are calculated from the witness hashes of its transactions.
+func TestBlockNewShortIDs(t *testing.T) {
+	// Block 100,000 with the mixed witness transaction appended, whose
+	// short id must come from its witness hash.
+	b := newTestBlockNew(t, newMixedWitnessMsgBlock())
+	want := []uint64{
+		0x4ebf5d8fa160,
+		0x02f8ef261b50,
+		0x294065227ecc,
+		0x2aaba5b82483,
+		0xa591f3f7cf26,
+	}
+
+	got := b.ShortIDs(0x0706050403020100, 0x0f0e0d0c0b0a0908)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ShortIDs: got %#x, want %#x", got, want)
+	}
+}
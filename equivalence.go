@@ -0,0 +1,125 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// compareMsgTx returns an error describing the first field in which the passed
+// transaction differs from the wanted one, or nil if they are identical.
+func compareMsgTx(got, want *wire.MsgTx) error {
+	if got.Version != want.Version {
+		return fmt.Errorf("version mismatch - got %d, want %d",
+			got.Version, want.Version)
+	}
+	if len(got.TxIn) != len(want.TxIn) {
+		return fmt.Errorf("input count mismatch - got %d, want %d",
+			len(got.TxIn), len(want.TxIn))
+	}
+	for i, txIn := range got.TxIn {
+		wantTxIn := want.TxIn[i]
+		if txIn.PreviousOutPoint != wantTxIn.PreviousOutPoint {
+			return fmt.Errorf("input %d: previous outpoint mismatch "+
+				"- got %v, want %v", i, txIn.PreviousOutPoint,
+				wantTxIn.PreviousOutPoint)
+		}
+		if !bytes.Equal(txIn.SignatureScript, wantTxIn.SignatureScript) {
+			return fmt.Errorf("input %d: signature script mismatch "+
+				"- got %x, want %x", i, txIn.SignatureScript,
+				wantTxIn.SignatureScript)
+		}
+		if len(txIn.Witness) != len(wantTxIn.Witness) {
+			return fmt.Errorf("input %d: witness item count "+
+				"mismatch - got %d, want %d", i,
+				len(txIn.Witness), len(wantTxIn.Witness))
+		}
+		for j, item := range txIn.Witness {
+			if !bytes.Equal(item, wantTxIn.Witness[j]) {
+				return fmt.Errorf("input %d: witness item %d "+
+					"mismatch - got %x, want %x", i, j, item,
+					wantTxIn.Witness[j])
+			}
+		}
+		if txIn.Sequence != wantTxIn.Sequence {
+			return fmt.Errorf("input %d: sequence mismatch - got "+
+				"%d, want %d", i, txIn.Sequence,
+				wantTxIn.Sequence)
+		}
+	}
+	if len(got.TxOut) != len(want.TxOut) {
+		return fmt.Errorf("output count mismatch - got %d, want %d",
+			len(got.TxOut), len(want.TxOut))
+	}
+	for i, txOut := range got.TxOut {
+		wantTxOut := want.TxOut[i]
+		if txOut.Value != wantTxOut.Value {
+			return fmt.Errorf("output %d: value mismatch - got %d, "+
+				"want %d", i, txOut.Value, wantTxOut.Value)
+		}
+		if !bytes.Equal(txOut.PkScript, wantTxOut.PkScript) {
+			return fmt.Errorf("output %d: public key script mismatch "+
+				"- got %x, want %x", i, txOut.PkScript,
+				wantTxOut.PkScript)
+		}
+	}
+	if got.LockTime != want.LockTime {
+		return fmt.Errorf("lock time mismatch - got %d, want %d",
+			got.LockTime, want.LockTime)
+	}
+	return nil
+}
+
+// VerifyFormatEquivalence converts the passed legacy transaction to the new
+// format and back again to ensure nothing is lost or altered in the process.
+// The transaction that results from the round trip must match the original
+// field by field, serialize to identical bytes, and have the same hashes.  The
+// returned error describes the first divergence found, such as the index of
+// the input and the field which differs.
+func VerifyFormatEquivalence(msgTx *wire.MsgTx) error {
+	var original bytes.Buffer
+	original.Grow(msgTx.SerializeSize())
+	if err := msgTx.Serialize(&original); err != nil {
+		return err
+	}
+
+	var msgTxNew wire.MsgTxNew
+	err := msgTxNew.Deserialize(bytes.NewReader(original.Bytes()))
+	if err != nil {
+		return fmt.Errorf("unable to convert to the new format: %v", err)
+	}
+	roundTrip := msgTxNew.CreateMsgTx()
+
+	if err := compareMsgTx(roundTrip, msgTx); err != nil {
+		return err
+	}
+
+	var converted bytes.Buffer
+	converted.Grow(roundTrip.SerializeSize())
+	if err := roundTrip.Serialize(&converted); err != nil {
+		return err
+	}
+	if !bytes.Equal(converted.Bytes(), original.Bytes()) {
+		return fmt.Errorf("serialized bytes mismatch - got %x, want %x",
+			converted.Bytes(), original.Bytes())
+	}
+
+	// Also ensure the new format hashes the same as the legacy one.
+	tx := NewTxNew(&msgTxNew)
+	wantHash := msgTx.TxHash()
+	if !tx.Hash().IsEqual(&wantHash) {
+		return fmt.Errorf("hash mismatch - got %v, want %v", tx.Hash(),
+			wantHash)
+	}
+	wantWitnessHash := msgTx.WitnessHash()
+	if !tx.WitnessHash().IsEqual(&wantWitnessHash) {
+		return fmt.Errorf("witness hash mismatch - got %v, want %v",
+			tx.WitnessHash(), wantWitnessHash)
+	}
+	return nil
+}
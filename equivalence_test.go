@@ -0,0 +1,104 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestVerifyFormatEquivalence ensures transactions survive the round trip
+// through the new format.
+func TestVerifyFormatEquivalence(t *testing.T) {
+	tests := []struct {
+		name  string
+		msgTx *wire.MsgTx
+	}{
+		{"coinbase", Block100000.Transactions[0]},
+		{"multi-output", Block100000.Transactions[1]},
+		{"multi-input", Block100000.Transactions[3]},
+		{"witness", newMixedWitnessMsgTx()},
+	}
+
+	for _, test := range tests {
+		if err := btcutil.VerifyFormatEquivalence(test.msgTx); err != nil {
+			t.Errorf("%s: VerifyFormatEquivalence: %v", test.name, err)
+		}
+	}
+}
+
+// TestCompareMsgTx ensures the first divergence between two transactions is
+// described.
+func TestCompareMsgTx(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*wire.MsgTx)
+		want   string
+	}{
+		{
+			name:   "identical",
+			modify: func(*wire.MsgTx) {},
+		},
+		{
+			name:   "version",
+			modify: func(msgTx *wire.MsgTx) { msgTx.Version = 2 },
+			want:   "version mismatch",
+		},
+		{
+			name: "witness item",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[0].Witness[1] = []byte{0x03}
+			},
+			want: "input 0: witness item 1 mismatch",
+		},
+		{
+			name: "signature script",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[1].SignatureScript = nil
+			},
+			want: "input 1: signature script mismatch",
+		},
+		{
+			name: "sequence",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[1].Sequence = 0
+			},
+			want: "input 1: sequence mismatch",
+		},
+		{
+			name: "output value",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxOut[0].Value++
+			},
+			want: "output 0: value mismatch",
+		},
+		{
+			name:   "lock time",
+			modify: func(msgTx *wire.MsgTx) { msgTx.LockTime = 1 },
+			want:   "lock time mismatch",
+		},
+	}
+
+	want := newMixedWitnessMsgTx()
+	for _, test := range tests {
+		got := newMixedWitnessMsgTx()
+		test.modify(got)
+
+		err := btcutil.TstCompareMsgTx(got, want)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want prefix %q", test.name,
+				err, test.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MinRelayFee returns the minimum fee, in satoshi, a transaction must pay in
+// order to be relayed given a relay fee rate expressed in satoshi per 1000
+// virtual bytes.  The result is rounded up so that a transaction paying it is
+// never below the rate, and it is capped at MaxSatoshi.
+func (t *TxNew) MinRelayFee(relayFeePerKvB Amount) Amount {
+	vsize := t.VirtualSize()
+	minFee := (int64(relayFeePerKvB)*vsize + 999) / 1000
+	if minFee > MaxSatoshi {
+		minFee = MaxSatoshi
+	}
+	return Amount(minFee)
+}
+
+// MeetsRelayFee returns whether paying paidFee is enough for the transaction
+// to be relayed at the given relay fee rate.  See MinRelayFee.
+func (t *TxNew) MeetsRelayFee(paidFee, relayFeePerKvB Amount) bool {
+	return paidFee >= t.MinRelayFee(relayFeePerKvB)
+}
+
+// IsEconomicalToSpend returns whether the value of the inputs of the
+// transaction covers both its outputs and the fee needed to pay for its
+// virtual size at the given fee rate, that is whether the transaction isn't a
+// net loss for the spender.  The fetch function returns the value of the
+// output referenced by an outpoint, and an error is returned when it can't be
+// found.
+func (t *TxNew) IsEconomicalToSpend(fetch func(wire.OutPoint) (int64, bool),
+	feeRate FeeRate) (bool, error) {
+
+	var totalIn int64
+	for _, txIn := range t.msgTx.TxIn {
+		value, ok := fetch(txIn.PreviousOutPoint)
+		if !ok {
+			return false, fmt.Errorf("unable to find output %v "+
+				"referenced from transaction %v", txIn.PreviousOutPoint,
+				t.Hash())
+		}
+		totalIn += value
+	}
+
+	var totalOut int64
+	for _, txOut := range t.msgTx.TxOut {
+		totalOut += txOut.Value
+	}
+
+	fee := int64(feeRate.FeeForVSize(t.VirtualSize()))
+	return totalIn > totalOut+fee, nil
+}
+
+// FeeRate describes a transaction fee rate in satoshi per 1000 virtual bytes.
+type FeeRate int64
+
+// NewFeeRate returns the fee rate of paying fee for a transaction of the given
+// virtual size.  A zero rate is returned for a non-positive size.
+func NewFeeRate(fee Amount, vsize int64) FeeRate {
+	if vsize <= 0 {
+		return 0
+	}
+	return FeeRate(int64(fee) * 1000 / vsize)
+}
+
+// FeeForVSize returns the fee, in satoshi, required to pay for the given
+// virtual size at the fee rate.  The result is rounded up.
+func (r FeeRate) FeeForVSize(vsize int64) Amount {
+	return Amount((int64(r)*vsize + 999) / 1000)
+}
+
+// String returns the fee rate as a human-readable string.
+func (r FeeRate) String() string {
+	return strconv.FormatInt(int64(r), 10) + " sat/kvB"
+}
+
+// EffectiveValue returns the value of a coin minus the fee required to spend
+// it at the given fee rate, where inputVSize is the virtual size of the input
+// spending it.  The result is negative for coins which cost more to spend than
+// they are worth, which coin selection uses to skip uneconomic coins.
+func EffectiveValue(value int64, inputVSize int64, feeRate FeeRate) int64 {
+	return value - int64(feeRate.FeeForVSize(inputVSize))
+}
+
+// ErrInsufficientFunds describes an error where the selected value doesn't
+// cover the target value plus the fee.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// ComputeChange returns the change left over after paying the target value
+// and fee from the selected value, and whether that change should be dropped
+// to the fee instead because it is below the dust threshold.  An exact match
+// results in zero change which is not dropped.  ErrInsufficientFunds is
+// returned when the selected value doesn't cover the target and fee.
+func ComputeChange(selected, target, fee, dustThreshold Amount) (change Amount, drop bool, err error) {
+	change = selected - target - fee
+	if change < 0 {
+		return 0, false, ErrInsufficientFunds
+	}
+	if change > 0 && change < dustThreshold {
+		return change, true, nil
+	}
+	return change, false, nil
+}
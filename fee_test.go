@@ -0,0 +1,234 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestMinRelayFee tests the relay fee calculations for TxNew.
+func TestMinRelayFee(t *testing.T) {
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	vsize := btcutil.Amount(tx.VirtualSize())
+
+	tests := []struct {
+		name    string
+		rate    btcutil.Amount // relay fee rate in satoshi per kvB
+		paid    btcutil.Amount // fee paid by the transaction
+		wantFee btcutil.Amount // expected minimum relay fee
+		meets   bool           // whether the paid fee is enough
+	}{
+		{
+			name:    "exactly meets threshold",
+			rate:    1000,
+			paid:    vsize,
+			wantFee: vsize,
+			meets:   true,
+		},
+		{
+			name:    "just under threshold",
+			rate:    1000,
+			paid:    vsize - 1,
+			wantFee: vsize,
+			meets:   false,
+		},
+		{
+			name:    "rounds up partial satoshi",
+			rate:    1,
+			paid:    0,
+			wantFee: 1,
+			meets:   false,
+		},
+		{
+			name:    "zero relay fee",
+			rate:    0,
+			paid:    0,
+			wantFee: 0,
+			meets:   true,
+		},
+	}
+
+	for _, test := range tests {
+		fee := tx.MinRelayFee(test.rate)
+		if fee != test.wantFee {
+			t.Errorf("MinRelayFee #%s: got %v, want %v", test.name,
+				fee, test.wantFee)
+			continue
+		}
+		meets := tx.MeetsRelayFee(test.paid, test.rate)
+		if meets != test.meets {
+			t.Errorf("MeetsRelayFee #%s: got %v, want %v", test.name,
+				meets, test.meets)
+		}
+	}
+}
+
+// TestIsEconomicalToSpend ensures transactions are only considered economical
+// when their inputs cover the outputs plus the fee.
+func TestIsEconomicalToSpend(t *testing.T) {
+	msgTx := Block100000.Transactions[1]
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	var totalOut int64
+	for _, txOut := range msgTx.TxOut {
+		totalOut += txOut.Value
+	}
+	feeRate := btcutil.FeeRate(1000)
+	fee := int64(feeRate.FeeForVSize(tx.VirtualSize()))
+
+	tests := []struct {
+		name    string
+		inValue int64
+		want    bool
+	}{
+		{name: "viable", inValue: totalOut + fee + 1, want: true},
+		{name: "fee exceeds value", inValue: totalOut + fee - 1, want: false},
+	}
+
+	for _, test := range tests {
+		fetch := func(wire.OutPoint) (int64, bool) {
+			return test.inValue, true
+		}
+		got, err := tx.IsEconomicalToSpend(fetch, feeRate)
+		if err != nil {
+			t.Errorf("IsEconomicalToSpend #%s: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("IsEconomicalToSpend #%s: got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+
+	// Missing previous outputs must be reported.
+	missing := func(wire.OutPoint) (int64, bool) { return 0, false }
+	if _, err := tx.IsEconomicalToSpend(missing, feeRate); err == nil {
+		t.Errorf("IsEconomicalToSpend: did not receive expected error " +
+			"for missing previous output")
+	}
+}
+
+// TestEffectiveValue ensures the effective value of a coin accounts for the
+// fee to spend it.
+func TestEffectiveValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      int64
+		inputVSize int64
+		feeRate    btcutil.FeeRate
+		want       int64
+	}{
+		{
+			name:       "zero fee rate",
+			value:      10000,
+			inputVSize: 68,
+			feeRate:    0,
+			want:       10000,
+		},
+		{
+			name:       "p2wpkh input at 1 sat/vB",
+			value:      10000,
+			inputVSize: 68,
+			feeRate:    1000,
+			want:       9932,
+		},
+		{
+			name:       "partial satoshi rounds up",
+			value:      10000,
+			inputVSize: 148,
+			feeRate:    1500,
+			want:       9778,
+		},
+		{
+			name:       "uneconomic at high fee rate",
+			value:      5000,
+			inputVSize: 148,
+			feeRate:    50000,
+			want:       -2400,
+		},
+	}
+
+	for _, test := range tests {
+		got := btcutil.EffectiveValue(test.value, test.inputVSize,
+			test.feeRate)
+		if got != test.want {
+			t.Errorf("EffectiveValue #%s: got %d, want %d", test.name,
+				got, test.want)
+		}
+	}
+}
+
+// TestComputeChange ensures the change amount and whether it's dropped as dust
+// are computed correctly.
+func TestComputeChange(t *testing.T) {
+	tests := []struct {
+		name                        string
+		selected, target, fee, dust btcutil.Amount
+		change                      btcutil.Amount
+		drop                        bool
+		err                         error
+	}{
+		{
+			name:     "normal change",
+			selected: 100000,
+			target:   60000,
+			fee:      1000,
+			dust:     546,
+			change:   39000,
+		},
+		{
+			name:     "dust change dropped",
+			selected: 100000,
+			target:   98000,
+			fee:      1500,
+			dust:     546,
+			change:   500,
+			drop:     true,
+		},
+		{
+			name:     "change at dust threshold kept",
+			selected: 100000,
+			target:   98000,
+			fee:      1454,
+			dust:     546,
+			change:   546,
+		},
+		{
+			name:     "exact match",
+			selected: 100000,
+			target:   99000,
+			fee:      1000,
+			dust:     546,
+			change:   0,
+		},
+		{
+			name:     "insufficient",
+			selected: 100000,
+			target:   99500,
+			fee:      1000,
+			dust:     546,
+			err:      btcutil.ErrInsufficientFunds,
+		},
+	}
+
+	for _, test := range tests {
+		change, drop, err := btcutil.ComputeChange(test.selected,
+			test.target, test.fee, test.dust)
+		if err != test.err {
+			t.Errorf("%s: unexpected error: got %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if change != test.change || drop != test.drop {
+			t.Errorf("%s: got change %v drop %v, want change %v "+
+				"drop %v", test.name, change, drop, test.change,
+				test.drop)
+		}
+	}
+}
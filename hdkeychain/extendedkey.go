@@ -96,6 +96,11 @@ var (
 	// key is not the expected length.
 	ErrInvalidKeyLen = errors.New("the provided serialized extended key " +
 		"length is invalid")
+
+	// ErrInvalidRange describes an error in which the provided range of
+	// child indices to derive is reversed or includes hardened indices.
+	ErrInvalidRange = errors.New("derivation range must not be reversed " +
+		"or include hardened indices")
 )
 
 // masterKey is the master key used along with a random seed used to generate
@@ -382,6 +387,22 @@ func (k *ExtendedKey) Address(net *chaincfg.Params) (*btcutil.AddressPubKeyHash,
 	return btcutil.NewAddressPubKeyHash(pkHash, net)
 }
 
+// AddressPubKeyHash converts the extended key to a pay-to-pubkey-hash address
+// for the passed network.  It is the same as Address, but returns the address
+// as a btcutil.Address so it may be used interchangeably with
+// AddressWitnessPubKeyHash.
+func (k *ExtendedKey) AddressPubKeyHash(net *chaincfg.Params) (btcutil.Address, error) {
+	return k.Address(net)
+}
+
+// AddressWitnessPubKeyHash converts the extended key to a version 0
+// pay-to-witness-pubkey-hash address for the passed network, such as for the
+// keys derived under BIP0084.
+func (k *ExtendedKey) AddressWitnessPubKeyHash(net *chaincfg.Params) (btcutil.Address, error) {
+	pkHash := btcutil.Hash160(k.pubKeyBytes())
+	return btcutil.NewAddressWitnessPubKeyHash(pkHash, net)
+}
+
 // paddedAppend appends the src byte slice to dst, returning the new slice.
 // If the length of the source is smaller than the passed size, leading zero
 // bytes are appended to the dst slice before appending src.
@@ -555,6 +576,43 @@ func NewKeyFromString(key string) (*ExtendedKey, error) {
 		childNum, isPrivate), nil
 }
 
+// ScanDerivationRange derives the normal children of the passed parent
+// extended key with indices in the range [start, end) and returns their
+// pay-to-witness-pubkey-hash addresses for the passed network in order of
+// their index, such as for scanning for used addresses up to a gap limit.
+//
+// Indices which don't derive to a usable child are skipped as recommended by
+// [BIP32], so fewer addresses than the size of the range may be returned.  The
+// ErrInvalidRange error will be returned if start is after end or if end is
+// after HardenedKeyStart.
+func ScanDerivationRange(parent *ExtendedKey, start, end uint32,
+	net *chaincfg.Params) ([]btcutil.Address, error) {
+
+	if start > end || end > HardenedKeyStart {
+		return nil, ErrInvalidRange
+	}
+
+	// The range is controlled by the caller and may span billions of
+	// indices, so the addresses are appended as they are derived rather
+	// than allocated up front.
+	var addrs []btcutil.Address
+	for i := start; i < end; i++ {
+		child, err := parent.Child(i)
+		if err == ErrInvalidChild {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		addr, err := child.AddressWitnessPubKeyHash(net)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
 // GenerateSeed returns a cryptographically secure random seed that can be used
 // as the input for the NewMaster function to generate a new master node.
 //
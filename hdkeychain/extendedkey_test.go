@@ -663,6 +663,173 @@ func TestExtendedKeyAPI(t *testing.T) {
 	}
 }
 
+// TestAddresses ensures the pay-to-pubkey-hash and pay-to-witness-pubkey-hash
+// addresses of extended keys match the BIP0032 and BIP0084 test vectors.
+func TestAddresses(t *testing.T) {
+	// The account key of the BIP0084 test vectors is serialized with the
+	// zpub version there, but the key itself is the same.
+	bip84Account := "xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V"
+
+	tests := []struct {
+		name           string
+		extKey         string
+		path           []uint32
+		addrPubKeyHash string
+		addrWitness    string
+	}{
+		{
+			name:           "test vector 1 master node private",
+			extKey:         "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			addrPubKeyHash: "15mKKb2eos1hWa6tisdPwwDC1a5J1y9nma",
+		},
+		{
+			name:           "test vector 1 chain m/0H/1/2H public",
+			extKey:         "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5",
+			addrPubKeyHash: "1NjxqbA9aZWnh17q1UW3rB4EPu79wDXj7x",
+		},
+		{
+			name:        "bip84 first receive address",
+			extKey:      bip84Account,
+			path:        []uint32{0, 0},
+			addrWitness: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+		},
+		{
+			name:        "bip84 second receive address",
+			extKey:      bip84Account,
+			path:        []uint32{0, 1},
+			addrWitness: "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g",
+		},
+		{
+			name:        "bip84 first change address",
+			extKey:      bip84Account,
+			path:        []uint32{1, 0},
+			addrWitness: "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el",
+		},
+	}
+
+	net := &chaincfg.MainNetParams
+	for _, test := range tests {
+		key, err := NewKeyFromString(test.extKey)
+		if err != nil {
+			t.Errorf("NewKeyFromString #%s: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		for _, i := range test.path {
+			key, err = key.Child(i)
+			if err != nil {
+				t.Fatalf("Child #%s: unexpected error: %v",
+					test.name, err)
+			}
+		}
+
+		if test.addrPubKeyHash != "" {
+			addr, err := key.AddressPubKeyHash(net)
+			if err != nil {
+				t.Errorf("AddressPubKeyHash #%s: unexpected "+
+					"error: %v", test.name, err)
+				continue
+			}
+			if addr.EncodeAddress() != test.addrPubKeyHash {
+				t.Errorf("AddressPubKeyHash #%s: mismatched "+
+					"address -- want %s, got %s", test.name,
+					test.addrPubKeyHash, addr.EncodeAddress())
+			}
+		}
+
+		if test.addrWitness != "" {
+			addr, err := key.AddressWitnessPubKeyHash(net)
+			if err != nil {
+				t.Errorf("AddressWitnessPubKeyHash #%s: "+
+					"unexpected error: %v", test.name, err)
+				continue
+			}
+			if addr.EncodeAddress() != test.addrWitness {
+				t.Errorf("AddressWitnessPubKeyHash #%s: "+
+					"mismatched address -- want %s, got %s",
+					test.name, test.addrWitness,
+					addr.EncodeAddress())
+			}
+		}
+	}
+}
+
+// TestScanDerivationRange ensures a range of child addresses is derived in
+// order and invalid ranges are rejected.
+func TestScanDerivationRange(t *testing.T) {
+	// The external chain of the BIP0084 test vector account, that is
+	// m/84'/0'/0'/0.
+	account, err := NewKeyFromString("xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V")
+	if err != nil {
+		t.Fatalf("NewKeyFromString: unexpected error: %v", err)
+	}
+	external, err := account.Child(0)
+	if err != nil {
+		t.Fatalf("Child: unexpected error: %v", err)
+	}
+
+	net := &chaincfg.MainNetParams
+	addrs, err := ScanDerivationRange(external, 0, 20, net)
+	if err != nil {
+		t.Fatalf("ScanDerivationRange: unexpected error: %v", err)
+	}
+	if len(addrs) != 20 {
+		t.Fatalf("ScanDerivationRange: got %d addresses, want 20",
+			len(addrs))
+	}
+	for i, addr := range addrs {
+		child, err := external.Child(uint32(i))
+		if err != nil {
+			t.Fatalf("Child: unexpected error: %v", err)
+		}
+		want, err := child.AddressWitnessPubKeyHash(net)
+		if err != nil {
+			t.Fatalf("AddressWitnessPubKeyHash: unexpected "+
+				"error: %v", err)
+		}
+		if addr.EncodeAddress() != want.EncodeAddress() {
+			t.Errorf("ScanDerivationRange #%d: mismatched address "+
+				"-- want %s, got %s", i, want.EncodeAddress(),
+				addr.EncodeAddress())
+		}
+	}
+	wantFirst := []string{
+		"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+		"bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g",
+	}
+	for i, want := range wantFirst {
+		if addrs[i].EncodeAddress() != want {
+			t.Errorf("ScanDerivationRange #%d: mismatched address "+
+				"-- want %s, got %s", i, want,
+				addrs[i].EncodeAddress())
+		}
+	}
+
+	// A sub-range must match the same children.
+	addrs, err = ScanDerivationRange(external, 1, 2, net)
+	if err != nil {
+		t.Fatalf("ScanDerivationRange: unexpected error: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].EncodeAddress() != wantFirst[1] {
+		t.Errorf("ScanDerivationRange: mismatched sub-range -- want "+
+			"[%s], got %v", wantFirst[1], addrs)
+	}
+
+	// Reversed ranges and those including hardened indices are invalid.
+	invalid := []struct{ start, end uint32 }{
+		{5, 4},
+		{0, HardenedKeyStart + 1},
+	}
+	for _, r := range invalid {
+		_, err := ScanDerivationRange(external, r.start, r.end, net)
+		if err != ErrInvalidRange {
+			t.Errorf("ScanDerivationRange(%d, %d): mismatched "+
+				"error -- want %v, got %v", r.start, r.end,
+				ErrInvalidRange, err)
+		}
+	}
+}
+
 // TestNet ensures the network related APIs work as intended.
 func TestNet(t *testing.T) {
 	tests := []struct {
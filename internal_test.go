@@ -13,6 +13,7 @@ package btcutil
 
 import (
 	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil/base58"
 	"github.com/btcsuite/btcutil/bech32"
 	"golang.org/x/crypto/ripemd160"
@@ -25,6 +26,27 @@ func (b *Block) SetBlockBytes(buf []byte) {
 	b.serializedBlock = buf
 }
 
+// TstNewTxNew makes a TxNew that only carries the legacy form of the
+// transaction so tests can build them from the legacy wire.MsgTx fixtures.
+func TstNewTxNew(msgTx *wire.MsgTx) *TxNew {
+	return &TxNew{
+		msgTx:   msgTx,
+		txIndex: TxIndexUnknown,
+	}
+}
+
+// TstCompareMsgTx makes the internal compareMsgTx function available to the
+// test package.
+func TstCompareMsgTx(got, want *wire.MsgTx) error {
+	return compareMsgTx(got, want)
+}
+
+// TstAddWeight makes the internal addWeight function available to the test
+// package.
+func TstAddWeight(total, weight int64) int64 {
+	return addWeight(total, weight)
+}
+
 // TstAppDataDir makes the internal appDataDir function available to the test
 // package.
 func TstAppDataDir(goos, appName string, roaming bool) string {
@@ -0,0 +1,101 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// hashMerkleBranches takes two hashes, treated as the left and right tree
+// nodes, and returns the hash of their concatenation.  It mirrors
+// blockchain.HashMerkleBranches, which can't be referenced from here without
+// creating an import cycle.
+func hashMerkleBranches(left, right *chainhash.Hash) chainhash.Hash {
+	var hash [chainhash.HashSize * 2]byte
+	copy(hash[:chainhash.HashSize], left[:])
+	copy(hash[chainhash.HashSize:], right[:])
+	return chainhash.DoubleHashH(hash[:])
+}
+
+// calcMerkleRoot returns the root of the merkle tree with the passed leaves,
+// reducing them in place.  As in the block chain, the last node of a level
+// with an odd number of nodes is paired with itself.  The zero hash is
+// returned when there are no leaves.
+func calcMerkleRoot(leaves []chainhash.Hash) chainhash.Hash {
+	if len(leaves) == 0 {
+		return chainhash.Hash{}
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		for i := 0; i < len(level); i += 2 {
+			level[i/2] = hashMerkleBranches(&level[i], &level[i+1])
+		}
+		level = level[:len(level)/2]
+	}
+	return level[0]
+}
+
+// CalcMerkleRoot returns the merkle root of the transactions in the block, that
+// is the value committed to by a valid block header.  It caches the result so
+// subsequent calls are more efficient.
+func (b *BlockNew) CalcMerkleRoot() chainhash.Hash {
+	// Return the cached merkle root if it has already been generated.
+	if b.merkleRoot != nil {
+		return *b.merkleRoot
+	}
+
+	txns := b.Transactions()
+	leaves := make([]chainhash.Hash, len(txns))
+	for i, tx := range txns {
+		leaves[i] = *tx.Hash()
+	}
+
+	// Cache the merkle root and return it.
+	merkleRoot := calcMerkleRoot(leaves)
+	b.merkleRoot = &merkleRoot
+	return merkleRoot
+}
+
+// CalcMerkleRootParallel returns the merkle root of the transactions in the
+// block and caches it like CalcMerkleRoot, however the transaction hashes
+// which make up the leaves of the tree are computed concurrently by the passed
+// number of workers.  Since hashing the transactions dominates the work for
+// blocks with many transactions, this speeds up computing the root of large
+// blocks whose transaction hashes aren't already cached.
+func (b *BlockNew) CalcMerkleRootParallel(workers int) chainhash.Hash {
+	txns := b.Transactions()
+	if workers > len(txns) {
+		workers = len(txns)
+	}
+	if b.merkleRoot != nil || workers <= 1 {
+		return b.CalcMerkleRoot()
+	}
+
+	// Each worker hashes an interleaved subset of the transactions, so
+	// no two workers touch the same transaction or leaf.
+	leaves := make([]chainhash.Hash, len(txns))
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(start int) {
+			defer wg.Done()
+			for i := start; i < len(txns); i += workers {
+				leaves[i] = *txns[i].Hash()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Cache the merkle root and return it.
+	merkleRoot := calcMerkleRoot(leaves)
+	b.merkleRoot = &merkleRoot
+	return merkleRoot
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newLargeMsgBlockNew returns a synthetic block with the passed number of
+// distinct transactions in the new format.
+func newLargeMsgBlockNew(tb testing.TB, numTxns int) *wire.MsgBlockNew {
+	msgBlock := &wire.MsgBlock{Header: Block100000.Header}
+	for i := 0; i < numTxns; i++ {
+		msgTx := Block100000.Transactions[1].Copy()
+		msgTx.LockTime = uint32(i)
+		msgBlock.AddTransaction(msgTx)
+	}
+
+	var buf bytes.Buffer
+	if err := msgBlock.Serialize(&buf); err != nil {
+		tb.Fatalf("Serialize: %v", err)
+	}
+	var msgBlockNew wire.MsgBlockNew
+	if err := msgBlockNew.Deserialize(&buf); err != nil {
+		tb.Fatalf("Deserialize: %v", err)
+	}
+	return &msgBlockNew
+}
+
+// TestCalcMerkleRoot ensures the merkle root of a block is calculated
+// correctly both sequentially and in parallel.
+func TestCalcMerkleRoot(t *testing.T) {
+	// The merkle root of block 100,000 is committed to by its header.
+	b := newTestBlockNew(t, &Block100000)
+	want := Block100000.Header.MerkleRoot
+	if got := b.CalcMerkleRoot(); got != want {
+		t.Errorf("CalcMerkleRoot: got %v, want %v", got, want)
+	}
+	for _, workers := range []int{-1, 0, 1, 2, 8} {
+		b := newTestBlockNew(t, &Block100000)
+		if got := b.CalcMerkleRootParallel(workers); got != want {
+			t.Errorf("CalcMerkleRootParallel(%d): got %v, want %v",
+				workers, got, want)
+		}
+	}
+
+	// The parallel root of a large block with an odd number of
+	// transactions must match the sequential one.
+	msgBlockNew := newLargeMsgBlockNew(t, 5001)
+	want = btcutil.NewBlockNew(msgBlockNew).CalcMerkleRoot()
+	for _, workers := range []int{2, 3, 16} {
+		b := btcutil.NewBlockNew(msgBlockNew)
+		if got := b.CalcMerkleRootParallel(workers); got != want {
+			t.Errorf("CalcMerkleRootParallel(%d): got %v, want %v",
+				workers, got, want)
+		}
+	}
+}
+
+// benchmarkCalcMerkleRoot benchmarks calculating the merkle root of a large
+// block whose transaction hashes aren't cached using the passed function.
+func benchmarkCalcMerkleRoot(b *testing.B, calc func(*btcutil.BlockNew)) {
+	msgBlockNew := newLargeMsgBlockNew(b, 20000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		block := btcutil.NewBlockNew(msgBlockNew)
+		b.StartTimer()
+		calc(block)
+	}
+}
+
+// BenchmarkCalcMerkleRoot benchmarks calculating the merkle root of a large
+// block sequentially.
+func BenchmarkCalcMerkleRoot(b *testing.B) {
+	benchmarkCalcMerkleRoot(b, func(block *btcutil.BlockNew) {
+		block.CalcMerkleRoot()
+	})
+}
+
+// BenchmarkCalcMerkleRootParallel benchmarks calculating the merkle root of a
+// large block in parallel.
+func BenchmarkCalcMerkleRootParallel(b *testing.B) {
+	benchmarkCalcMerkleRoot(b, func(block *btcutil.BlockNew) {
+		block.CalcMerkleRootParallel(8)
+	})
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrUnsignedTxMismatch describes an error where packets being merged are not
+// for the same unsigned transaction.
+var ErrUnsignedTxMismatch = errors.New("psbt unsigned transactions differ")
+
+// mergeUnknowns returns the passed unknown key-value pairs along with those
+// of other whose keys aren't among them.
+func mergeUnknowns(unknowns, other []*Unknown) []*Unknown {
+	for _, o := range other {
+		var found bool
+		for _, u := range unknowns {
+			if bytes.Equal(u.Key, o.Key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknowns = append(unknowns, o)
+		}
+	}
+	return unknowns
+}
+
+// merge adds the fields of the other input which are not set in the input,
+// along with the partial signatures by keys which haven't signed it yet.
+func (pi *PInput) merge(other *PInput) {
+	if pi.NonWitnessUtxo == nil {
+		pi.NonWitnessUtxo = other.NonWitnessUtxo
+	}
+	if pi.WitnessUtxo == nil {
+		pi.WitnessUtxo = other.WitnessUtxo
+	}
+	for _, o := range other.PartialSigs {
+		var found bool
+		for _, partialSig := range pi.PartialSigs {
+			if bytes.Equal(partialSig.PubKey, o.PubKey) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			pi.PartialSigs = append(pi.PartialSigs, o)
+		}
+	}
+	if pi.SighashType == 0 {
+		pi.SighashType = other.SighashType
+	}
+	if pi.RedeemScript == nil {
+		pi.RedeemScript = other.RedeemScript
+	}
+	if pi.WitnessScript == nil {
+		pi.WitnessScript = other.WitnessScript
+	}
+	if pi.FinalScriptSig == nil {
+		pi.FinalScriptSig = other.FinalScriptSig
+	}
+	if pi.FinalScriptWitness == nil {
+		pi.FinalScriptWitness = other.FinalScriptWitness
+	}
+	pi.Unknowns = mergeUnknowns(pi.Unknowns, other.Unknowns)
+}
+
+// merge adds the fields of the other output which are not set in the output.
+func (po *POutput) merge(other *POutput) {
+	if po.RedeemScript == nil {
+		po.RedeemScript = other.RedeemScript
+	}
+	if po.WitnessScript == nil {
+		po.WitnessScript = other.WitnessScript
+	}
+	po.Unknowns = mergeUnknowns(po.Unknowns, other.Unknowns)
+}
+
+// Merge combines the other packet, which must be for the same unsigned
+// transaction, into the packet, such as when each cosigner of a transaction
+// signed their own copy of it.  The partial signatures of both are kept, with
+// only one kept for each key, and fields which are only set in the other
+// packet are taken from it, sharing their values.  Where both packets set a
+// field differently, the value of the packet is kept, as allowed by the
+// combiner role of BIP0174.
+//
+// ErrUnsignedTxMismatch is returned when the packets are for different
+// unsigned transactions, and ErrInvalidPsbtFormat when either doesn't have an
+// input and output map for each of its inputs and outputs.  The packet is not
+// modified when an error is returned.
+func (p *Packet) Merge(other *Packet) error {
+	for _, packet := range []*Packet{p, other} {
+		tx := packet.UnsignedTx
+		if tx == nil || len(packet.Inputs) != len(tx.TxIn) ||
+			len(packet.Outputs) != len(tx.TxOut) {
+
+			return ErrInvalidPsbtFormat
+		}
+	}
+	if p.UnsignedTx.TxHash() != other.UnsignedTx.TxHash() {
+		return ErrUnsignedTxMismatch
+	}
+
+	for i := range p.Inputs {
+		p.Inputs[i].merge(&other.Inputs[i])
+	}
+	for i := range p.Outputs {
+		p.Outputs[i].merge(&other.Outputs[i])
+	}
+	p.Unknowns = mergeUnknowns(p.Unknowns, other.Unknowns)
+	return nil
+}
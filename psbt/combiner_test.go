@@ -0,0 +1,89 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestMerge ensures packets signed by different cosigners are combined into a
+// packet with all of their signatures.
+func TestMerge(t *testing.T) {
+	// Create a packet whose first input spends a 2-of-2 multisig witness
+	// script hash output.
+	otherPubKey := hexToBytes("02c6047f9441ed7d6d3045406e95c07cd85c778e" +
+		"4b8cef3ca7abac09b95c709ee5")
+	witnessScript := append([]byte{0x52, 0x21}, testPubKey...)
+	witnessScript = append(witnessScript, 0x21)
+	witnessScript = append(witnessScript, otherPubKey...)
+	witnessScript = append(witnessScript, 0x52, 0xae)
+	newPacket := func() *Packet {
+		p, err := NewFromUnsignedTx(newTestUnsignedTx())
+		if err != nil {
+			t.Fatalf("NewFromUnsignedTx: %v", err)
+		}
+		p.Inputs[0].WitnessUtxo = wire.NewTxOut(60000,
+			testP2WPKHScript)
+		p.Inputs[0].WitnessScript = witnessScript
+		return p
+	}
+	sig1 := &PartialSig{PubKey: testPubKey,
+		Signature: bytes.Repeat([]byte{0x30}, 71)}
+	sig2 := &PartialSig{PubKey: otherPubKey,
+		Signature: bytes.Repeat([]byte{0x31}, 72)}
+
+	// Each cosigner signs their own copy, with the second also adding an
+	// unknown field and the signature of the first, which must not be
+	// duplicated.
+	p := newPacket()
+	p.Inputs[0].PartialSigs = []*PartialSig{sig1}
+	other := newPacket()
+	other.Inputs[0].PartialSigs = []*PartialSig{sig2, sig1}
+	other.Outputs[1].Unknowns = []*Unknown{{Key: []byte{0xf0},
+		Value: []byte{0x01}}}
+	if err := p.Merge(other); err != nil {
+		t.Fatalf("Merge: unexpected error: %v", err)
+	}
+
+	want := newPacket()
+	want.Inputs[0].PartialSigs = []*PartialSig{sig1, sig2}
+	want.Outputs[1].Unknowns = other.Outputs[1].Unknowns
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Merge: got %+v, want %+v", p, want)
+	}
+
+	// Merging the same packet again doesn't change it.
+	if err := p.Merge(other); err != nil {
+		t.Fatalf("Merge: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Merge: got %+v after merging again, want %+v", p,
+			want)
+	}
+
+	// Packets for different transactions can't be merged, and the packet
+	// must be left unchanged.
+	different := newPacket()
+	different.UnsignedTx.LockTime = 1
+	different.Inputs[1].PartialSigs = []*PartialSig{sig1}
+	if err := p.Merge(different); err != ErrUnsignedTxMismatch {
+		t.Errorf("Merge: got error %v, want %v", err,
+			ErrUnsignedTxMismatch)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Merge: got %+v after failed merge, want %+v", p, want)
+	}
+
+	malformed := newPacket()
+	malformed.Inputs = malformed.Inputs[:1]
+	if err := p.Merge(malformed); err != ErrInvalidPsbtFormat {
+		t.Errorf("Merge: got error %v, want %v", err,
+			ErrInvalidPsbtFormat)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package psbt provides an API for partially signed bitcoin transactions
+(BIP0174).
+
+# Overview
+
+A partially signed bitcoin transaction, or PSBT, is an unsigned transaction
+along with the information needed to sign it, which is passed between the
+parties creating, signing, and finalizing the transaction.  This package
+provides a Packet type holding a PSBT along with functions to serialize it to
+and parse it from the binary and base64 encodings defined by BIP0174.
+
+# Supported Fields
+
+The unsigned transaction, along with the previous outputs, partial signatures,
+sighash types, redeem and witness scripts, and final scripts of the inputs and
+the redeem and witness scripts of the outputs are decoded into their fields.
+All other fields, such as BIP0032 derivation paths, are kept as unknown
+key-value pairs so they are preserved when the packet is serialized again.
+*/
+package psbt
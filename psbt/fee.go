@@ -0,0 +1,147 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// ErrMissingUtxo describes an error where an input of a packet has neither a
+// witness nor a non-witness previous output, or its non-witness previous
+// transaction isn't the one it spends.
+var ErrMissingUtxo = errors.New("psbt input is missing its previous output")
+
+// prevOut returns the output spent by the input, which spends the passed
+// outpoint, from its witness previous output, or otherwise its non-witness
+// previous transaction.  False is returned when neither is set or the previous
+// transaction doesn't have the spent output.
+func (pi *PInput) prevOut(outPoint *wire.OutPoint) (*wire.TxOut, bool) {
+	if pi.WitnessUtxo != nil {
+		return pi.WitnessUtxo, true
+	}
+	prevTx := pi.NonWitnessUtxo
+	if prevTx == nil || prevTx.TxHash() != outPoint.Hash ||
+		outPoint.Index >= uint32(len(prevTx.TxOut)) {
+
+		return nil, false
+	}
+	return prevTx.TxOut[outPoint.Index], true
+}
+
+// inputClass returns the class of the output spent by the input, as expected
+// by btcutil.EstimateSignedVSize.  Pay-to-script-hash outputs are only
+// supported when the redeem script of the input is a P2WPKH program.
+func (pi *PInput) inputClass(
+	outPoint *wire.OutPoint) (btcutil.ScriptClass, error) {
+
+	txOut, ok := pi.prevOut(outPoint)
+	if !ok {
+		return btcutil.NonStandardTy, ErrMissingUtxo
+	}
+
+	class := btcutil.ClassifyScript(txOut.PkScript)
+	if class == btcutil.ScriptHashTy {
+		redeemClass := btcutil.ClassifyScript(pi.RedeemScript)
+		if redeemClass != btcutil.WitnessV0PubKeyHashTy {
+			return btcutil.NonStandardTy, fmt.Errorf("unable to "+
+				"estimate size of input spending p2sh output "+
+				"with %v redeem script", redeemClass)
+		}
+	}
+	return class, nil
+}
+
+// EstimateFinalFee returns the fee needed for the transaction of the packet to
+// pay the passed fee rate once all of its inputs are finalized.  The sizes of
+// the final signature scripts and witnesses are projected from the classes of
+// the outputs spent by the inputs, as by btcutil.EstimateSignedVSize, so it
+// can be used before any input is signed.
+//
+// ErrMissingUtxo is returned when the output spent by an input is missing,
+// and an error is also returned when the size of an input can't be
+// estimated, such as one spending a multisig output.  Pay-to-script-hash
+// inputs are only supported when their redeem script is a P2WPKH program.
+func (p *Packet) EstimateFinalFee(
+	feeRate btcutil.FeeRate) (btcutil.Amount, error) {
+
+	if p.UnsignedTx == nil || len(p.Inputs) != len(p.UnsignedTx.TxIn) {
+		return 0, ErrInvalidPsbtFormat
+	}
+
+	inputTypes := make([]btcutil.ScriptClass, len(p.Inputs))
+	for i, txIn := range p.UnsignedTx.TxIn {
+		class, err := p.Inputs[i].inputClass(&txIn.PreviousOutPoint)
+		if err != nil {
+			return 0, err
+		}
+		inputTypes[i] = class
+	}
+
+	tx, err := btcutil.TxNewFromLegacy(p.UnsignedTx)
+	if err != nil {
+		return 0, err
+	}
+	vsize, err := tx.EstimateSignedVSize(inputTypes)
+	if err != nil {
+		return 0, err
+	}
+	return feeRate.FeeForVSize(vsize), nil
+}
+
+// Fee returns the fee paid by the transaction of the packet, which is the total
+// value of the outputs spent by its inputs, from their witness or non-witness
+// previous outputs, minus the total value of its outputs.  Signers should
+// check it before signing, since the unsigned transaction alone doesn't
+// reveal the fee.
+//
+// ErrMissingUtxo is returned when the output spent by an input is missing,
+// btcutil.ErrBadTxOutValue when the value of a spent output or their total is
+// negative or more than btcutil.MaxSatoshi, and btcutil.ErrSpendTooHigh when
+// the outputs are worth more than the spent outputs.  An error is also
+// returned when the value of an output or their total is out of range.
+func (p *Packet) Fee() (btcutil.Amount, error) {
+	if p.UnsignedTx == nil || len(p.Inputs) != len(p.UnsignedTx.TxIn) {
+		return 0, ErrInvalidPsbtFormat
+	}
+
+	var totalIn int64
+	for i, txIn := range p.UnsignedTx.TxIn {
+		txOut, ok := p.Inputs[i].prevOut(&txIn.PreviousOutPoint)
+		if !ok {
+			return 0, ErrMissingUtxo
+		}
+
+		// The values come from the packet rather than the chain, so
+		// they must be checked like those of spent outputs are by
+		// btcutil.CheckTransactionInputs, including for overflow.
+		if txOut.Value < 0 || txOut.Value > btcutil.MaxSatoshi {
+			return 0, btcutil.ErrBadTxOutValue
+		}
+		totalIn += txOut.Value
+		if totalIn > btcutil.MaxSatoshi {
+			return 0, btcutil.ErrBadTxOutValue
+		}
+	}
+	var totalOut int64
+	for i, txOut := range p.UnsignedTx.TxOut {
+		if txOut.Value < 0 || txOut.Value > btcutil.MaxSatoshi {
+			return 0, fmt.Errorf("value %d of output %d is out of "+
+				"range", txOut.Value, i)
+		}
+		totalOut += txOut.Value
+		if totalOut > btcutil.MaxSatoshi {
+			return 0, errors.New("total value of outputs is " +
+				"out of range")
+		}
+	}
+	if totalOut > totalIn {
+		return 0, btcutil.ErrSpendTooHigh
+	}
+	return btcutil.Amount(totalIn - totalOut), nil
+}
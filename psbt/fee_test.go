@@ -0,0 +1,186 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestEstimateFinalFee ensures the fees of packets are estimated from the
+// sizes of their inputs once finalized.
+func TestEstimateFinalFee(t *testing.T) {
+	const feeRate = btcutil.FeeRate(10000)
+	p, err := NewFromUnsignedTx(newTestUnsignedTx())
+	if err != nil {
+		t.Fatalf("NewFromUnsignedTx: %v", err)
+	}
+	for i := range p.Inputs {
+		p.Inputs[i].WitnessUtxo = wire.NewTxOut(60000, testP2WPKHScript)
+	}
+
+	// The fee must pay for the transaction once its P2WPKH inputs are
+	// signed with typical signatures.
+	signed := p.UnsignedTx.Copy()
+	for _, txIn := range signed.TxIn {
+		txIn.Witness = wire.TxWitness{bytes.Repeat([]byte{0x30}, 72),
+			testPubKey}
+	}
+	signedTx, err := btcutil.TxNewFromLegacy(signed)
+	if err != nil {
+		t.Fatalf("TxNewFromLegacy: %v", err)
+	}
+	want := feeRate.FeeForVSize(signedTx.VirtualSize())
+	fee, err := p.EstimateFinalFee(feeRate)
+	if err != nil {
+		t.Fatalf("EstimateFinalFee: unexpected error: %v", err)
+	}
+	if fee != want {
+		t.Errorf("EstimateFinalFee: got %v, want %v", fee, want)
+	}
+
+	// The spent output may also be found in the previous transaction of
+	// an input.
+	prevTx := wire.NewMsgTx(1)
+	prevTx.AddTxOut(wire.NewTxOut(60000, testP2WPKHScript))
+	p.UnsignedTx.TxIn[1].PreviousOutPoint = wire.OutPoint{
+		Hash: prevTx.TxHash(),
+	}
+	p.Inputs[1] = PInput{NonWitnessUtxo: prevTx}
+	fee, err = p.EstimateFinalFee(feeRate)
+	if err != nil {
+		t.Fatalf("EstimateFinalFee: unexpected error: %v", err)
+	}
+	if fee != want {
+		t.Errorf("EstimateFinalFee: got %v, want %v", fee, want)
+	}
+
+	// Inputs whose type can't be determined or estimated are rejected.
+	p2shScript := hexToBytes("a9146edbc6c4d31bae9f1ccc38538a114bf42de65e" +
+		"8687")
+	tests := []struct {
+		name  string
+		input PInput
+		err   error
+	}{
+		{"missing utxo", PInput{}, ErrMissingUtxo},
+		{"wrong previous tx", PInput{NonWitnessUtxo: wire.NewMsgTx(2)},
+			ErrMissingUtxo},
+		{"p2sh without redeem script", PInput{
+			WitnessUtxo: wire.NewTxOut(60000, p2shScript)}, nil},
+		{"p2sh multisig", PInput{
+			WitnessUtxo:  wire.NewTxOut(60000, p2shScript),
+			RedeemScript: []byte{0x51, 0x51, 0xae}}, nil},
+		{"p2wsh", PInput{WitnessUtxo: wire.NewTxOut(60000,
+			append([]byte{0x00, 0x20}, make([]byte, 32)...))}, nil},
+	}
+	for _, test := range tests {
+		p.Inputs[1] = test.input
+		_, err := p.EstimateFinalFee(feeRate)
+		if err == nil || (test.err != nil && err != test.err) {
+			t.Errorf("EstimateFinalFee #%s: got error %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+
+	// Nested P2WPKH inputs are supported.
+	p.Inputs[1] = PInput{
+		WitnessUtxo:  wire.NewTxOut(60000, p2shScript),
+		RedeemScript: testP2WPKHScript,
+	}
+	fee, err = p.EstimateFinalFee(feeRate)
+	if err != nil {
+		t.Fatalf("EstimateFinalFee: unexpected error: %v", err)
+	}
+	if fee <= want {
+		t.Errorf("EstimateFinalFee: got %v for nested p2wpkh input, "+
+			"want more than %v", fee, want)
+	}
+}
+
+// TestFee ensures the fees of packets are calculated from the outputs spent by
+// their inputs.
+func TestFee(t *testing.T) {
+	p, err := NewFromUnsignedTx(newTestUnsignedTx())
+	if err != nil {
+		t.Fatalf("NewFromUnsignedTx: %v", err)
+	}
+
+	// Spend a witness output along with the second output of a previous
+	// transaction for a total of 100,000 satoshi, while the outputs of the
+	// unsigned transaction total 90,000 satoshi.
+	prevTx := wire.NewMsgTx(1)
+	prevTx.AddTxOut(wire.NewTxOut(1000, testP2WPKHScript))
+	prevTx.AddTxOut(wire.NewTxOut(40000, testP2WPKHScript))
+	p.UnsignedTx.TxIn[1].PreviousOutPoint = wire.OutPoint{
+		Hash:  prevTx.TxHash(),
+		Index: 1,
+	}
+	p.Inputs[0].WitnessUtxo = wire.NewTxOut(60000, testP2WPKHScript)
+	p.Inputs[1].NonWitnessUtxo = prevTx
+
+	fee, err := p.Fee()
+	if err != nil {
+		t.Fatalf("Fee: unexpected error: %v", err)
+	}
+	if fee != 10000 {
+		t.Errorf("Fee: got %v, want %v", fee, btcutil.Amount(10000))
+	}
+
+	// Outputs worth more than the spent outputs are rejected.
+	p.UnsignedTx.TxOut[0].Value = 50001
+	if _, err := p.Fee(); err != btcutil.ErrSpendTooHigh {
+		t.Errorf("Fee: got error %v, want %v", err,
+			btcutil.ErrSpendTooHigh)
+	}
+	p.UnsignedTx.TxOut[0].Value = 40000
+
+	// Spent outputs with values out of range are rejected, including ones
+	// which would overflow the total.
+	badValues := []int64{-1, btcutil.MaxSatoshi + 1, math.MaxInt64,
+		btcutil.MaxSatoshi}
+	for _, value := range badValues {
+		p.Inputs[0].WitnessUtxo.Value = value
+		if _, err := p.Fee(); err != btcutil.ErrBadTxOutValue {
+			t.Errorf("Fee: got error %v for spent value %d, "+
+				"want %v", err, value, btcutil.ErrBadTxOutValue)
+		}
+	}
+	p.Inputs[0].WitnessUtxo.Value = 60000
+
+	// Outputs with values out of range are rejected, even when they would
+	// otherwise lower the total.
+	for _, value := range []int64{-1, btcutil.MaxSatoshi + 1} {
+		p.UnsignedTx.TxOut[0].Value = value
+		if _, err := p.Fee(); err == nil {
+			t.Errorf("Fee: accepted output value %d", value)
+		}
+	}
+	p.UnsignedTx.TxOut[0].Value = 40000
+
+	// Inputs must have the output they spend.
+	tests := []struct {
+		name  string
+		input PInput
+		index uint32
+	}{
+		{"missing utxo", PInput{}, 1},
+		{"wrong previous tx", PInput{NonWitnessUtxo: wire.NewMsgTx(2)},
+			1},
+		{"missing output", PInput{NonWitnessUtxo: prevTx}, 2},
+	}
+	for _, test := range tests {
+		p.Inputs[1] = test.input
+		p.UnsignedTx.TxIn[1].PreviousOutPoint.Index = test.index
+		if _, err := p.Fee(); err != ErrMissingUtxo {
+			t.Errorf("Fee #%s: got error %v, want %v", test.name, err,
+				ErrMissingUtxo)
+		}
+	}
+}
@@ -0,0 +1,598 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// psbtMagic is the magic prefix of a serialized packet, which is "psbt"
+// followed by the 0xff separator.
+var psbtMagic = [5]byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// maxPsbtFieldSize is the maximum size of a key or value in a serialized
+// packet.  No field of a transaction which fits in a message can exceed it.
+const maxPsbtFieldSize = wire.MaxMessagePayload
+
+// These constants are the types of the key-value pairs of a packet, which are
+// the first byte of their keys.
+const (
+	// Global types.
+	globalUnsignedTxType = 0x00
+
+	// Input types.
+	inputNonWitnessUtxoType     = 0x00
+	inputWitnessUtxoType        = 0x01
+	inputPartialSigType         = 0x02
+	inputSighashType            = 0x03
+	inputRedeemScriptType       = 0x04
+	inputWitnessScriptType      = 0x05
+	inputFinalScriptSigType     = 0x07
+	inputFinalScriptWitnessType = 0x08
+
+	// Output types.
+	outputRedeemScriptType  = 0x00
+	outputWitnessScriptType = 0x01
+)
+
+var (
+	// ErrInvalidMagicBytes describes an error where a serialized packet
+	// doesn't start with the magic bytes of a PSBT.
+	ErrInvalidMagicBytes = errors.New("invalid magic bytes for psbt")
+
+	// ErrInvalidPsbtFormat describes an error where a packet is missing
+	// its unsigned transaction or doesn't have an input and output map for
+	// each of its inputs and outputs, or where a serialized packet is
+	// followed by additional bytes.
+	ErrInvalidPsbtFormat = errors.New("invalid psbt format")
+
+	// ErrDuplicateKey describes an error where a map of a serialized
+	// packet has the same key more than once.
+	ErrDuplicateKey = errors.New("duplicate key in psbt map")
+
+	// ErrInvalidKeyData describes an error where the key or value of a
+	// known type doesn't have the expected size or encoding.
+	ErrInvalidKeyData = errors.New("invalid key or value data in psbt")
+
+	// ErrInvalidRawTxSigned describes an error where the unsigned
+	// transaction of a packet has signature scripts or witnesses.
+	ErrInvalidRawTxSigned = errors.New("psbt unsigned transaction has " +
+		"signature scripts or witnesses")
+)
+
+// Unknown is a key-value pair of a packet whose type isn't decoded by this
+// package.  It is kept as is so it is preserved when the packet is serialized
+// again.
+type Unknown struct {
+	Key   []byte
+	Value []byte
+}
+
+// PartialSig is a signature of an input by one of the keys it requires, along
+// with that key.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// PInput holds the information for signing and finalizing an input of a
+// packet.  Fields which are not set are nil or zero.
+type PInput struct {
+	// NonWitnessUtxo is the full transaction whose output is spent by the
+	// input.
+	NonWitnessUtxo *wire.MsgTx
+
+	// WitnessUtxo is the output spent by the input when it is a witness
+	// output.
+	WitnessUtxo *wire.TxOut
+
+	// PartialSigs are the signatures of the input collected so far.
+	PartialSigs []*PartialSig
+
+	// SighashType is the signature hash type which signatures of the input
+	// must use, or zero when none is specified.
+	SighashType btcutil.SigHashType
+
+	// RedeemScript and WitnessScript are the scripts revealed by the input
+	// when it spends a pay-to-script-hash or witness script hash output.
+	RedeemScript  []byte
+	WitnessScript []byte
+
+	// FinalScriptSig and FinalScriptWitness are the signature script and
+	// serialized witness of the input once it is finalized.
+	FinalScriptSig     []byte
+	FinalScriptWitness []byte
+
+	// Unknowns are the key-value pairs of the input which aren't decoded.
+	Unknowns []*Unknown
+}
+
+// POutput holds the information about an output of a packet.  Fields which are
+// not set are nil.
+type POutput struct {
+	// RedeemScript and WitnessScript are the scripts which the output pays
+	// to when it is a pay-to-script-hash or witness script hash output.
+	RedeemScript  []byte
+	WitnessScript []byte
+
+	// Unknowns are the key-value pairs of the output which aren't decoded.
+	Unknowns []*Unknown
+}
+
+// Packet is a partially signed bitcoin transaction.  It has an input and output
+// map for each input and output of its unsigned transaction, in the same order.
+type Packet struct {
+	// UnsignedTx is the transaction being signed, whose inputs have no
+	// signature scripts or witnesses.
+	UnsignedTx *wire.MsgTx
+
+	// Inputs and Outputs hold the information about each input and output
+	// of the unsigned transaction.
+	Inputs  []PInput
+	Outputs []POutput
+
+	// Unknowns are the global key-value pairs which aren't decoded.
+	Unknowns []*Unknown
+}
+
+// isUnsigned returns whether none of the inputs of the passed transaction have
+// signature scripts or witnesses.
+func isUnsigned(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 || len(txIn.Witness) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NewFromUnsignedTx returns a new packet for the passed unsigned transaction
+// with empty input and output maps.  ErrInvalidRawTxSigned is returned when
+// any of its inputs has a signature script or a witness.
+func NewFromUnsignedTx(tx *wire.MsgTx) (*Packet, error) {
+	if !isUnsigned(tx) {
+		return nil, ErrInvalidRawTxSigned
+	}
+	return &Packet{
+		UnsignedTx: tx,
+		Inputs:     make([]PInput, len(tx.TxIn)),
+		Outputs:    make([]POutput, len(tx.TxOut)),
+	}, nil
+}
+
+// readKeyValue reads a single key-value pair of a map from r.  A nil key is
+// returned for the separator which ends the map.
+func readKeyValue(r io.Reader) (key, value []byte, err error) {
+	key, err = wire.ReadVarBytes(r, 0, maxPsbtFieldSize, "psbt key")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(key) == 0 {
+		return nil, nil, nil
+	}
+	value, err = wire.ReadVarBytes(r, 0, maxPsbtFieldSize, "psbt value")
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// writeKeyValue writes a single key-value pair of a map to w.
+func writeKeyValue(w io.Writer, key, value []byte) error {
+	if err := wire.WriteVarBytes(w, 0, key); err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0, value)
+}
+
+// writeSeparator writes the separator which ends a map to w.
+func writeSeparator(w io.Writer) error {
+	_, err := w.Write([]byte{0x00})
+	return err
+}
+
+// readMap reads the key-value pairs of a map from r up to and including its
+// separator, passing each one to decode, which returns false for pairs of
+// unknown types.  The unknown pairs are returned.  ErrDuplicateKey is returned
+// when the map has the same key more than once.
+func readMap(r io.Reader,
+	decode func(key, value []byte) (bool, error)) ([]*Unknown, error) {
+
+	var unknowns []*Unknown
+	seen := make(map[string]struct{})
+	for {
+		key, value, err := readKeyValue(r)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return unknowns, nil
+		}
+		if _, ok := seen[string(key)]; ok {
+			return nil, ErrDuplicateKey
+		}
+		seen[string(key)] = struct{}{}
+
+		known, err := decode(key, value)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			unknowns = append(unknowns, &Unknown{
+				Key:   key,
+				Value: value,
+			})
+		}
+	}
+}
+
+// writeUnknowns writes the passed unknown key-value pairs to w.
+func writeUnknowns(w io.Writer, unknowns []*Unknown) error {
+	for _, unknown := range unknowns {
+		err := writeKeyValue(w, unknown.Key, unknown.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deserializeTx decodes the passed serialized transaction, which must not be
+// followed by any other bytes.  Transactions serialized without witness data
+// are decoded with DeserializeNoWitness, since one without inputs would
+// otherwise be mistaken for the witness encoding.
+func deserializeTx(serialized []byte, noWitness bool) (*wire.MsgTx, error) {
+	var tx wire.MsgTx
+	r := bytes.NewReader(serialized)
+	var err error
+	if noWitness {
+		err = tx.DeserializeNoWitness(r)
+	} else {
+		err = tx.Deserialize(r)
+	}
+	if err != nil || r.Len() != 0 {
+		return nil, ErrInvalidKeyData
+	}
+	return &tx, nil
+}
+
+// serializeTxOut returns the serialization of the passed output, which is its
+// value followed by its length-prefixed public key script.
+func serializeTxOut(txOut *wire.TxOut) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := wire.WriteTxOut(&buf, 0, 0, txOut); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deserializeTxOut decodes the passed serialized output, which must not be
+// followed by any other bytes.
+func deserializeTxOut(serialized []byte) (*wire.TxOut, error) {
+	if len(serialized) < 8 {
+		return nil, ErrInvalidKeyData
+	}
+	value := int64(binary.LittleEndian.Uint64(serialized[:8]))
+	r := bytes.NewReader(serialized[8:])
+	pkScript, err := wire.ReadVarBytes(r, 0, maxPsbtFieldSize, "pkScript")
+	if err != nil || r.Len() != 0 {
+		return nil, ErrInvalidKeyData
+	}
+	return wire.NewTxOut(value, pkScript), nil
+}
+
+// decode decodes the passed key-value pair of an input map into the input.
+// False is returned for pairs of unknown types.
+func (pi *PInput) decode(key, value []byte) (bool, error) {
+	// The keys of all known types other than partial signatures only
+	// consist of the type.
+	switch key[0] {
+	case inputNonWitnessUtxoType, inputWitnessUtxoType, inputSighashType,
+		inputRedeemScriptType, inputWitnessScriptType,
+		inputFinalScriptSigType, inputFinalScriptWitnessType:
+
+		if len(key) != 1 {
+			return false, ErrInvalidKeyData
+		}
+	}
+
+	switch key[0] {
+	case inputNonWitnessUtxoType:
+		tx, err := deserializeTx(value, false)
+		if err != nil {
+			return false, err
+		}
+		pi.NonWitnessUtxo = tx
+
+	case inputWitnessUtxoType:
+		txOut, err := deserializeTxOut(value)
+		if err != nil {
+			return false, err
+		}
+		pi.WitnessUtxo = txOut
+
+	case inputPartialSigType:
+		pubKey := key[1:]
+		_, err := btcec.ParsePubKey(pubKey, btcec.S256())
+		if err != nil {
+			return false, ErrInvalidKeyData
+		}
+		pi.PartialSigs = append(pi.PartialSigs, &PartialSig{
+			PubKey:    pubKey,
+			Signature: value,
+		})
+
+	case inputSighashType:
+		if len(value) != 4 {
+			return false, ErrInvalidKeyData
+		}
+		pi.SighashType = btcutil.SigHashType(
+			binary.LittleEndian.Uint32(value))
+
+	case inputRedeemScriptType:
+		pi.RedeemScript = value
+
+	case inputWitnessScriptType:
+		pi.WitnessScript = value
+
+	case inputFinalScriptSigType:
+		pi.FinalScriptSig = value
+
+	case inputFinalScriptWitnessType:
+		pi.FinalScriptWitness = value
+
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// serialize writes the key-value pairs of the input followed by the separator
+// to w.
+func (pi *PInput) serialize(w io.Writer) error {
+	if pi.NonWitnessUtxo != nil {
+		var buf bytes.Buffer
+		if err := pi.NonWitnessUtxo.Serialize(&buf); err != nil {
+			return err
+		}
+		err := writeKeyValue(w, []byte{inputNonWitnessUtxoType},
+			buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	if pi.WitnessUtxo != nil {
+		serialized, err := serializeTxOut(pi.WitnessUtxo)
+		if err != nil {
+			return err
+		}
+		err = writeKeyValue(w, []byte{inputWitnessUtxoType}, serialized)
+		if err != nil {
+			return err
+		}
+	}
+	for _, partialSig := range pi.PartialSigs {
+		key := append([]byte{inputPartialSigType}, partialSig.PubKey...)
+		err := writeKeyValue(w, key, partialSig.Signature)
+		if err != nil {
+			return err
+		}
+	}
+	if pi.SighashType != 0 {
+		var value [4]byte
+		binary.LittleEndian.PutUint32(value[:], uint32(pi.SighashType))
+		err := writeKeyValue(w, []byte{inputSighashType}, value[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	scripts := []struct {
+		keyType byte
+		script  []byte
+	}{
+		{inputRedeemScriptType, pi.RedeemScript},
+		{inputWitnessScriptType, pi.WitnessScript},
+		{inputFinalScriptSigType, pi.FinalScriptSig},
+		{inputFinalScriptWitnessType, pi.FinalScriptWitness},
+	}
+	for _, s := range scripts {
+		if s.script == nil {
+			continue
+		}
+		err := writeKeyValue(w, []byte{s.keyType}, s.script)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeUnknowns(w, pi.Unknowns); err != nil {
+		return err
+	}
+	return writeSeparator(w)
+}
+
+// decode decodes the passed key-value pair of an output map into the output.
+// False is returned for pairs of unknown types.
+func (po *POutput) decode(key, value []byte) (bool, error) {
+	switch key[0] {
+	case outputRedeemScriptType:
+		if len(key) != 1 {
+			return false, ErrInvalidKeyData
+		}
+		po.RedeemScript = value
+
+	case outputWitnessScriptType:
+		if len(key) != 1 {
+			return false, ErrInvalidKeyData
+		}
+		po.WitnessScript = value
+
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// serialize writes the key-value pairs of the output followed by the separator
+// to w.
+func (po *POutput) serialize(w io.Writer) error {
+	if po.RedeemScript != nil {
+		err := writeKeyValue(w, []byte{outputRedeemScriptType},
+			po.RedeemScript)
+		if err != nil {
+			return err
+		}
+	}
+	if po.WitnessScript != nil {
+		err := writeKeyValue(w, []byte{outputWitnessScriptType},
+			po.WitnessScript)
+		if err != nil {
+			return err
+		}
+	}
+	if err := writeUnknowns(w, po.Unknowns); err != nil {
+		return err
+	}
+	return writeSeparator(w)
+}
+
+// NewFromRawBytes returns a new packet parsed from the binary serialization of
+// a PSBT read from r.  Nothing past the last output map is read.
+// ErrInvalidMagicBytes is returned when it doesn't start with the magic bytes
+// of a PSBT, and ErrInvalidPsbtFormat when it doesn't have an unsigned
+// transaction.
+func NewFromRawBytes(r io.Reader) (*Packet, error) {
+	var magic [5]byte
+	_, err := io.ReadFull(r, magic[:])
+	if err != nil || magic != psbtMagic {
+		return nil, ErrInvalidMagicBytes
+	}
+
+	var p Packet
+	unknowns, err := readMap(r, func(key, value []byte) (bool, error) {
+		if key[0] != globalUnsignedTxType {
+			return false, nil
+		}
+		if len(key) != 1 {
+			return false, ErrInvalidKeyData
+		}
+		tx, err := deserializeTx(value, true)
+		if err != nil {
+			return false, err
+		}
+		if !isUnsigned(tx) {
+			return false, ErrInvalidRawTxSigned
+		}
+		p.UnsignedTx = tx
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.UnsignedTx == nil {
+		return nil, ErrInvalidPsbtFormat
+	}
+	p.Unknowns = unknowns
+
+	p.Inputs = make([]PInput, len(p.UnsignedTx.TxIn))
+	for i := range p.Inputs {
+		pi := &p.Inputs[i]
+		pi.Unknowns, err = readMap(r, pi.decode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.Outputs = make([]POutput, len(p.UnsignedTx.TxOut))
+	for i := range p.Outputs {
+		po := &p.Outputs[i]
+		po.Unknowns, err = readMap(r, po.decode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// Serialize writes the binary serialization of the packet to w.
+// ErrInvalidPsbtFormat is returned when the packet doesn't have an unsigned
+// transaction along with an input and output map for each of its inputs and
+// outputs.
+func (p *Packet) Serialize(w io.Writer) error {
+	if p.UnsignedTx == nil || len(p.Inputs) != len(p.UnsignedTx.TxIn) ||
+		len(p.Outputs) != len(p.UnsignedTx.TxOut) {
+
+		return ErrInvalidPsbtFormat
+	}
+
+	if _, err := w.Write(psbtMagic[:]); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := p.UnsignedTx.SerializeNoWitness(&buf); err != nil {
+		return err
+	}
+	err := writeKeyValue(w, []byte{globalUnsignedTxType}, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := writeUnknowns(w, p.Unknowns); err != nil {
+		return err
+	}
+	if err := writeSeparator(w); err != nil {
+		return err
+	}
+
+	for i := range p.Inputs {
+		if err := p.Inputs[i].serialize(w); err != nil {
+			return err
+		}
+	}
+	for i := range p.Outputs {
+		if err := p.Outputs[i].serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// B64Encode returns the base64 encoding of the binary serialization of the
+// packet, which is how PSBTs are commonly exchanged as text, such as by
+// copying and pasting them.
+func (p *Packet) B64Encode() (string, error) {
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// NewPacketFromB64 returns a new packet parsed from the base64 encoding of the
+// binary serialization of a PSBT.  An error is returned when the string isn't
+// valid base64, and the errors of NewFromRawBytes when it doesn't decode to a
+// PSBT.  ErrInvalidPsbtFormat is returned when it decodes to more than a PSBT.
+func NewPacketFromB64(s string) (*Packet, error) {
+	serialized, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(serialized)
+	p, err := NewFromRawBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, ErrInvalidPsbtFormat
+	}
+	return p, nil
+}
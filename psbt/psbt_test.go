@@ -0,0 +1,273 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// hexToBytes converts the passed hex string into bytes and will panic if there
+// is an error.  This is only provided for the hard-coded constants so errors in
+// the source code can be detected.  It will only (and must only) be called
+// with hard-coded values.
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	return b
+}
+
+var (
+	// testPubKey is the compressed public key of the generator point.
+	testPubKey = hexToBytes("0279be667ef9dcbbac55a06295ce870b07029bfcdb2d" +
+		"ce28d959f2815b16f81798")
+
+	// testP2WPKHScript is a pay-to-witness-pubkey-hash script.
+	testP2WPKHScript = hexToBytes("00146edbc6c4d31bae9f1ccc38538a114bf4" +
+		"2de65e86")
+)
+
+// newTestUnsignedTx returns an unsigned transaction with two inputs and two
+// outputs.
+func newTestUnsignedTx() *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	for i := uint32(0); i < 2; i++ {
+		prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: i}
+		tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(40000, testP2WPKHScript))
+	tx.AddTxOut(wire.NewTxOut(50000, testP2WPKHScript))
+	return tx
+}
+
+// newTestPacket returns a packet for newTestUnsignedTx with fields of every
+// supported type set, along with unknown key-value pairs.
+func newTestPacket(t *testing.T) *Packet {
+	p, err := NewFromUnsignedTx(newTestUnsignedTx())
+	if err != nil {
+		t.Fatalf("NewFromUnsignedTx: %v", err)
+	}
+
+	prevTx := wire.NewMsgTx(1)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, []byte{0x51},
+		wire.TxWitness{{0x01, 0x02}}))
+	prevTx.AddTxOut(wire.NewTxOut(100000, testP2WPKHScript))
+
+	p.Unknowns = []*Unknown{{Key: []byte{0xf0, 0x01}, Value: []byte{0xaa}}}
+	p.Inputs[0] = PInput{
+		WitnessUtxo: wire.NewTxOut(60000, testP2WPKHScript),
+		PartialSigs: []*PartialSig{{
+			PubKey:    testPubKey,
+			Signature: bytes.Repeat([]byte{0x30}, 71),
+		}},
+		SighashType:   btcutil.SigHashAll,
+		WitnessScript: []byte{0x51},
+	}
+	p.Inputs[1] = PInput{
+		NonWitnessUtxo:     prevTx,
+		RedeemScript:       []byte{0x00, 0x14},
+		FinalScriptSig:     []byte{0x01, 0x02},
+		FinalScriptWitness: []byte{0x01, 0x01, 0x03},
+		Unknowns: []*Unknown{{
+			Key:   append([]byte{0x06}, testPubKey...),
+			Value: []byte{0x01, 0x02, 0x03, 0x04},
+		}},
+	}
+	p.Outputs[1] = POutput{
+		RedeemScript:  []byte{0x00, 0x20},
+		WitnessScript: []byte{0x52},
+		Unknowns:      []*Unknown{{Key: []byte{0x02}, Value: nil}},
+	}
+	return p
+}
+
+// checkPacketFields ensures the passed packet, which was parsed from the
+// serialization of newTestPacket, has its fields decoded.
+func checkPacketFields(t *testing.T, name string, p *Packet) {
+	want := newTestPacket(t)
+	if p.UnsignedTx.TxHash() != want.UnsignedTx.TxHash() {
+		t.Errorf("%s: got unsigned tx %v, want %v", name,
+			p.UnsignedTx.TxHash(), want.UnsignedTx.TxHash())
+	}
+	if len(p.Inputs) != 2 || len(p.Outputs) != 2 {
+		t.Fatalf("%s: got %d inputs and %d outputs, want 2 and 2", name,
+			len(p.Inputs), len(p.Outputs))
+	}
+	in0, in1 := &p.Inputs[0], &p.Inputs[1]
+	if !reflect.DeepEqual(in0.WitnessUtxo, want.Inputs[0].WitnessUtxo) ||
+		!reflect.DeepEqual(in0.PartialSigs, want.Inputs[0].PartialSigs) ||
+		in0.SighashType != btcutil.SigHashAll ||
+		!bytes.Equal(in0.WitnessScript, []byte{0x51}) {
+
+		t.Errorf("%s: got input 0 %+v, want %+v", name, in0,
+			want.Inputs[0])
+	}
+	if in1.NonWitnessUtxo == nil || in1.NonWitnessUtxo.WitnessHash() !=
+		want.Inputs[1].NonWitnessUtxo.WitnessHash() ||
+		!bytes.Equal(in1.FinalScriptWitness, []byte{0x01, 0x01, 0x03}) ||
+		!reflect.DeepEqual(in1.Unknowns, want.Inputs[1].Unknowns) {
+
+		t.Errorf("%s: got input 1 %+v, want %+v", name, in1,
+			want.Inputs[1])
+	}
+	if !bytes.Equal(p.Outputs[1].WitnessScript, []byte{0x52}) ||
+		len(p.Outputs[1].Unknowns) != 1 {
+
+		t.Errorf("%s: got output 1 %+v, want %+v", name, p.Outputs[1],
+			want.Outputs[1])
+	}
+	if !reflect.DeepEqual(p.Unknowns, want.Unknowns) {
+		t.Errorf("%s: got unknowns %+v, want %+v", name, p.Unknowns,
+			want.Unknowns)
+	}
+}
+
+// TestPacketRoundTrip ensures packets are unchanged after being serialized and
+// parsed again, both in the binary and base64 encodings.
+func TestPacketRoundTrip(t *testing.T) {
+	p := newTestPacket(t)
+
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("psbt\xff")) {
+		t.Fatalf("Serialize: missing magic bytes in %x", buf.Bytes())
+	}
+	parsed, err := NewFromRawBytes(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewFromRawBytes: %v", err)
+	}
+	checkPacketFields(t, "NewFromRawBytes", parsed)
+
+	encoded, err := p.B64Encode()
+	if err != nil {
+		t.Fatalf("B64Encode: %v", err)
+	}
+	if encoded != base64.StdEncoding.EncodeToString(buf.Bytes()) {
+		t.Errorf("B64Encode: got %s, want base64 of %x", encoded,
+			buf.Bytes())
+	}
+	decoded, err := NewPacketFromB64(encoded)
+	if err != nil {
+		t.Fatalf("NewPacketFromB64: %v", err)
+	}
+	checkPacketFields(t, "NewPacketFromB64", decoded)
+
+	// Encoding the parsed packets again must produce the same encodings,
+	// including packets without any fields.
+	empty, err := NewFromUnsignedTx(newTestUnsignedTx())
+	if err != nil {
+		t.Fatalf("NewFromUnsignedTx: %v", err)
+	}
+	for _, p := range []*Packet{decoded, empty} {
+		encoded, err := p.B64Encode()
+		if err != nil {
+			t.Fatalf("B64Encode: %v", err)
+		}
+		decoded, err := NewPacketFromB64(encoded)
+		if err != nil {
+			t.Fatalf("NewPacketFromB64: %v", err)
+		}
+		reencoded, err := decoded.B64Encode()
+		if err != nil {
+			t.Fatalf("B64Encode: %v", err)
+		}
+		if reencoded != encoded {
+			t.Errorf("B64Encode: got %s after round trip, want %s",
+				reencoded, encoded)
+		}
+	}
+}
+
+// TestNewPacketFromB64Invalid ensures malformed packets are rejected.
+func TestNewPacketFromB64Invalid(t *testing.T) {
+	var unsignedTx bytes.Buffer
+	err := newTestUnsignedTx().SerializeNoWitness(&unsignedTx)
+	if err != nil {
+		t.Fatalf("SerializeNoWitness: %v", err)
+	}
+	var globalMap bytes.Buffer
+	writeKeyValue(&globalMap, []byte{globalUnsignedTxType},
+		unsignedTx.Bytes())
+	valid := append([]byte("psbt\xff"), globalMap.Bytes()...)
+	valid = append(valid, 0x00, 0x00, 0x00, 0x00, 0x00)
+
+	signedTx := newTestUnsignedTx()
+	signedTx.TxIn[0].SignatureScript = []byte{0x51}
+	var signed bytes.Buffer
+	signedTx.SerializeNoWitness(&signed)
+	var signedMap bytes.Buffer
+	writeKeyValue(&signedMap, []byte{globalUnsignedTxType}, signed.Bytes())
+
+	join := func(parts ...[]byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Join(parts, nil))
+	}
+	magic := []byte("psbt\xff")
+	dupKey := []byte{0x02, 0xf0, 0x01, 0x01, 0xaa}
+
+	tests := []struct {
+		name string
+		b64  string
+		err  error
+	}{
+		{"wrong magic", join([]byte("pbst\xff"), valid[5:]),
+			ErrInvalidMagicBytes},
+		{"not psbt", base64.StdEncoding.EncodeToString([]byte("hello")),
+			ErrInvalidMagicBytes},
+		{"empty", "", ErrInvalidMagicBytes},
+		{"no unsigned tx", join(magic, []byte{0x00}),
+			ErrInvalidPsbtFormat},
+		{"trailing bytes", join(valid, []byte{0x00}),
+			ErrInvalidPsbtFormat},
+		{"signed tx", join(magic, signedMap.Bytes(), []byte{0x00}),
+			ErrInvalidRawTxSigned},
+		{"duplicate global key", join(magic, globalMap.Bytes(), dupKey,
+			dupKey, valid[5+globalMap.Len():]), ErrDuplicateKey},
+		{"long sighash key", join(magic, globalMap.Bytes(), []byte{0x00,
+			0x02, 0x03, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00}), ErrInvalidKeyData},
+		{"bad partial sig key", join(magic, globalMap.Bytes(), []byte{
+			0x00, 0x02, 0x02, 0x05, 0x01, 0x30, 0x00, 0x00, 0x00, 0x00,
+			0x00}), ErrInvalidKeyData},
+	}
+
+	for _, test := range tests {
+		_, err := NewPacketFromB64(test.b64)
+		if err != test.err {
+			t.Errorf("NewPacketFromB64 #%s: got error %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+
+	// The valid packet the malformed ones are derived from must parse.
+	if _, err := NewPacketFromB64(join(valid)); err != nil {
+		t.Errorf("NewPacketFromB64: unexpected error: %v", err)
+	}
+
+	// Truncated packets and invalid base64 are rejected.
+	for _, s := range []string{join(valid[:len(valid)-1]), "cHNid!==",
+		"cHNidP8"} {
+
+		if _, err := NewPacketFromB64(s); err == nil {
+			t.Errorf("NewPacketFromB64(%q): expected error", s)
+		}
+	}
+
+	// Transactions which are signed can't be made into packets.
+	if _, err := NewFromUnsignedTx(signedTx); err != ErrInvalidRawTxSigned {
+		t.Errorf("NewFromUnsignedTx: got error %v, want %v", err,
+			ErrInvalidRawTxSigned)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MaxRBFSequence is the maximum sequence number an input can use to signal
+// that the transaction spending it can be replaced per BIP0125.  It mirrors
+// mempool.MaxRBFSequence, which can't be referenced from here without creating
+// an import cycle.
+const MaxRBFSequence = 0xfffffffd
+
+var (
+	// ErrReplacementNoConflict describes an error where a replacement
+	// transaction doesn't spend any of the outputs spent by the
+	// transaction it is meant to replace.
+	ErrReplacementNoConflict = errors.New("replacement does not spend " +
+		"any inputs of the replaced transaction")
+
+	// ErrReplacementNotSignaled describes an error where the replaced
+	// transaction doesn't signal replaceability on any of its inputs.
+	ErrReplacementNotSignaled = errors.New("replaced transaction does " +
+		"not signal replaceability")
+
+	// ErrReplacementFeeTooLow describes an error where a replacement
+	// transaction doesn't pay a higher absolute fee than the transaction
+	// it replaces.
+	ErrReplacementFeeTooLow = errors.New("replacement does not pay a " +
+		"higher fee than the replaced transaction")
+
+	// ErrReplacementBandwidthFee describes an error where the additional
+	// fee paid by a replacement transaction doesn't cover relaying it at
+	// the minimum relay fee rate.
+	ErrReplacementBandwidthFee = errors.New("replacement does not pay " +
+		"for its own bandwidth at the relay fee rate")
+)
+
+// CanReplace returns whether the transaction may replace the passed existing
+// transaction according to the BIP0125 replacement rules given the fees paid
+// by both and the minimum relay fee rate in satoshi per 1000 virtual bytes.
+// That is:
+//
+//   - The transactions must spend at least one common output
+//   - The existing transaction must signal replaceability by using a sequence
+//     number of at most MaxRBFSequence on any of its inputs, including those
+//     the replacement doesn't spend
+//   - The replacement must pay a higher absolute fee than the existing
+//     transaction
+//   - The additional fee must pay for relaying the replacement at the relay
+//     fee rate
+//
+// An error describing the first rule which isn't met is returned when the
+// replacement is not allowed.  Note that the rules concerning the descendants
+// of the existing transaction and unconfirmed inputs depend on the contents of
+// the mempool and must be checked separately.
+func (t *TxNew) CanReplace(existing *TxNew, existingFee, newFee Amount,
+	relayFeePerKvB Amount) (bool, error) {
+
+	spent := make(map[wire.OutPoint]struct{}, len(t.msgTx.TxIn))
+	for _, txIn := range t.msgTx.TxIn {
+		spent[txIn.PreviousOutPoint] = struct{}{}
+	}
+	var conflicts, signaled bool
+	for _, txIn := range existing.msgTx.TxIn {
+		if _, ok := spent[txIn.PreviousOutPoint]; ok {
+			conflicts = true
+		}
+		if txIn.Sequence <= MaxRBFSequence {
+			signaled = true
+		}
+	}
+	if !conflicts {
+		return false, ErrReplacementNoConflict
+	}
+	if !signaled {
+		return false, ErrReplacementNotSignaled
+	}
+
+	if newFee <= existingFee {
+		return false, ErrReplacementFeeTooLow
+	}
+	if !t.MeetsRelayFee(newFee-existingFee, relayFeePerKvB) {
+		return false, ErrReplacementBandwidthFee
+	}
+
+	return true, nil
+}
+
+// MinRBFBump returns the minimum absolute fee the passed replacement must pay
+// to replace the original transaction paying originalFee under the fee rules
+// of CanReplace at the given relay fee rate in satoshi per 1000 virtual bytes.
+// That is the fee of the original plus the fee for relaying the replacement,
+// which depends only on the size of the replacement, so wallets should
+// recompute it after changing the replacement, such as by adding inputs.  The
+// original transaction itself doesn't affect the result.
+//
+// The fee for relaying the replacement is at least 1 satoshi, such as when
+// the relay fee rate is zero, since CanReplace also requires the replacement
+// to pay a strictly higher fee than the original.
+func MinRBFBump(original *TxNew, originalFee Amount, replacement *TxNew,
+	relayFeePerKvB Amount) Amount {
+
+	bandwidthFee := replacement.MinRelayFee(relayFeePerKvB)
+	if bandwidthFee == 0 {
+		bandwidthFee = 1
+	}
+	return originalFee + bandwidthFee
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestCanReplace ensures the BIP0125 replacement rules are enforced.
+func TestCanReplace(t *testing.T) {
+	shared := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	other := wire.OutPoint{Hash: chainhash.Hash{0x02}}
+
+	// newTx returns a transaction spending the passed outpoint with the
+	// given sequence number.
+	newTx := func(prevOut wire.OutPoint, sequence uint32) *btcutil.TxNew {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		txIn := wire.NewTxIn(&prevOut, nil, nil)
+		txIn.Sequence = sequence
+		msgTx.AddTxIn(txIn)
+		msgTx.AddTxOut(wire.NewTxOut(1000, p2wpkhScript))
+		return btcutil.TstNewTxNew(msgTx)
+	}
+	signaling := newTx(shared, btcutil.MaxRBFSequence)
+	final := newTx(shared, wire.MaxTxInSequenceNum)
+	replacement := newTx(shared, wire.MaxTxInSequenceNum)
+	unrelated := newTx(other, btcutil.MaxRBFSequence)
+
+	// Signaling on an input the replacement doesn't spend is enough for
+	// the whole transaction to be replaceable.
+	signalingOther := newTx(shared, wire.MaxTxInSequenceNum)
+	otherTxIn := wire.NewTxIn(&other, nil, nil)
+	otherTxIn.Sequence = btcutil.MaxRBFSequence
+	signalingOther.MsgTx().AddTxIn(otherTxIn)
+
+	// The replacement must pay at least 1 satoshi per vbyte more than the
+	// existing transaction to cover its own relay.
+	const relayFee = 1000
+	minExtra := replacement.MinRelayFee(relayFee)
+
+	tests := []struct {
+		name        string
+		existing    *btcutil.TxNew
+		existingFee btcutil.Amount
+		newFee      btcutil.Amount
+		err         error
+	}{
+		{"replaceable", signaling, 1000, 1000 + minExtra, nil},
+		{"signaled on other input", signalingOther, 1000,
+			1000 + minExtra, nil},
+		{"no shared inputs", unrelated, 1000, 1000 + minExtra,
+			btcutil.ErrReplacementNoConflict},
+		{"not signaled", final, 1000, 1000 + minExtra,
+			btcutil.ErrReplacementNotSignaled},
+		{"equal fee", signaling, 1000, 1000,
+			btcutil.ErrReplacementFeeTooLow},
+		{"lower fee", signaling, 1000, 999,
+			btcutil.ErrReplacementFeeTooLow},
+		{"bandwidth not paid", signaling, 1000, 1000 + minExtra - 1,
+			btcutil.ErrReplacementBandwidthFee},
+	}
+
+	for _, test := range tests {
+		ok, err := replacement.CanReplace(test.existing,
+			test.existingFee, test.newFee, relayFee)
+		if err != test.err {
+			t.Errorf("CanReplace #%s: got error %v, want %v",
+				test.name, err, test.err)
+		}
+		if ok != (test.err == nil) {
+			t.Errorf("CanReplace #%s: got %v, want %v", test.name,
+				ok, test.err == nil)
+		}
+	}
+}
+
+// TestMinRBFBump ensures the minimum fee of a replacement accounts for its own
+// size and is accepted by CanReplace.
+func TestMinRBFBump(t *testing.T) {
+	// Replace a transaction with one which adds an input to pay the
+	// higher fee, making the replacement larger.
+	original := wire.NewMsgTx(wire.TxVersion)
+	original.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		nil, nil))
+	original.TxIn[0].Sequence = btcutil.MaxRBFSequence
+	original.AddTxOut(wire.NewTxOut(50000, p2wpkhScript))
+	replacement := original.Copy()
+	replacement.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x02}},
+		bytes.Repeat([]byte{0x51}, 107), nil))
+	originalTx := btcutil.TstNewTxNew(original)
+	replacementTx := btcutil.TstNewTxNew(replacement)
+	if replacementTx.VirtualSize() <= originalTx.VirtualSize() {
+		t.Fatalf("replacement is not larger than the original")
+	}
+
+	const originalFee, relayFee = btcutil.Amount(2000), btcutil.Amount(1000)
+	bump := btcutil.MinRBFBump(originalTx, originalFee, replacementTx,
+		relayFee)
+	want := originalFee + btcutil.Amount(replacementTx.VirtualSize())
+	if bump != want {
+		t.Errorf("MinRBFBump: got %v, want %v", bump, want)
+	}
+
+	// The bump must be the least fee the replacement rules accept.
+	ok, err := replacementTx.CanReplace(originalTx, originalFee, bump,
+		relayFee)
+	if !ok || err != nil {
+		t.Errorf("CanReplace: rejected minimum bump: %v", err)
+	}
+	_, err = replacementTx.CanReplace(originalTx, originalFee, bump-1,
+		relayFee)
+	if err != btcutil.ErrReplacementBandwidthFee {
+		t.Errorf("CanReplace: got error %v for bump below minimum, "+
+			"want %v", err, btcutil.ErrReplacementBandwidthFee)
+	}
+
+	// Without a relay fee the replacement must still pay more to be
+	// accepted.
+	bump = btcutil.MinRBFBump(originalTx, originalFee, replacementTx, 0)
+	if bump != originalFee+1 {
+		t.Errorf("MinRBFBump: got %v without relay fee, want %v", bump,
+			originalFee+1)
+	}
+	ok, err = replacementTx.CanReplace(originalTx, originalFee, bump, 0)
+	if !ok || err != nil {
+		t.Errorf("CanReplace: rejected minimum bump without relay fee: "+
+			"%v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// These constants are the values of the script opcodes used by the script
+// helpers in this package.  They mirror the definitions in txscript, which
+// can't be referenced from here without creating an import cycle.
+const (
+	op0             = 0x00 // 0
+	opData1         = 0x01 // 1
+	opData4         = 0x04 // 4
+	opData20        = 0x14 // 20
+	opData32        = 0x20 // 32
+	opData75        = 0x4b // 75
+	opPushData1     = 0x4c // 76
+	opPushData2     = 0x4d // 77
+	opPushData4     = 0x4e // 78
+	op1             = 0x51 // 81
+	op16            = 0x60 // 96
+	opReturn        = 0x6a // 106
+	opDup           = 0x76 // 118
+	opEqual         = 0x87 // 135
+	opEqualVerify   = 0x88 // 136
+	opHash160       = 0xa9 // 169
+	opCodeSeparator = 0xab // 171
+	opCheckSig      = 0xac // 172
+	opCheckMultiSig = 0xae // 174
+)
+
+// maxScriptSize is the maximum allowed length of a raw script.  It mirrors
+// txscript.MaxScriptSize.
+const maxScriptSize = 10000
+
+// ErrMalformedScript describes an error where a script can't be parsed
+// because a data push runs past the end of the script.
+var ErrMalformedScript = errors.New("malformed script")
+
+// scriptOp is a single parsed opcode of a script along with any data it
+// pushes.
+type scriptOp struct {
+	opcode byte   // The opcode itself
+	data   []byte // Data pushed by the opcode, if any
+	raw    []byte // Full encoding of the opcode within the script
+}
+
+// parseScript splits the passed script into its opcodes.  The data and raw
+// encodings of the returned opcodes alias the script.  ErrMalformedScript is
+// returned when a data push exceeds the end of the script, along with the
+// opcodes which precede it.
+func parseScript(script []byte) ([]scriptOp, error) {
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		start := i
+		i++
+
+		// Determine how much data is pushed by the opcode, reading the
+		// explicit length for the OP_PUSHDATA variants.
+		var dataLen int
+		switch {
+		case opcode >= opData1 && opcode <= opData75:
+			dataLen = int(opcode)
+
+		case opcode == opPushData1:
+			if len(script)-i < 1 {
+				return ops, ErrMalformedScript
+			}
+			dataLen = int(script[i])
+			i++
+
+		case opcode == opPushData2:
+			if len(script)-i < 2 {
+				return ops, ErrMalformedScript
+			}
+			dataLen = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+
+		case opcode == opPushData4:
+			if len(script)-i < 4 {
+				return ops, ErrMalformedScript
+			}
+			dataLen = int(binary.LittleEndian.Uint32(script[i:]))
+			i += 4
+		}
+		if dataLen < 0 || dataLen > len(script)-i {
+			return ops, ErrMalformedScript
+		}
+
+		ops = append(ops, scriptOp{
+			opcode: opcode,
+			data:   script[i : i+dataLen],
+			raw:    script[start : i+dataLen],
+		})
+		i += dataLen
+	}
+	return ops, nil
+}
+
+// removeOpcode returns a copy of the passed script with every occurrence of
+// the given opcode removed.  Data pushes are left untouched even when they
+// contain the opcode value.
+func removeOpcode(script []byte, opcode byte) ([]byte, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(script))
+	for _, op := range ops {
+		if op.opcode == opcode {
+			continue
+		}
+		result = append(result, op.raw...)
+	}
+	return result, nil
+}
+
+// isPushOnly returns whether the passed script only consists of opcodes which
+// push data, including the small integers, as required of signature scripts
+// by standardness.  Malformed scripts aren't push only.
+func isPushOnly(script []byte) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if op.opcode > op16 {
+			return false
+		}
+	}
+	return true
+}
+
+// pushedData returns the data pushed by the opcodes of the passed script,
+// excluding the small integers.  It mirrors txscript.PushedData, which can't
+// be referenced from here without creating an import cycle.
+func pushedData(script []byte) ([][]byte, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	var data [][]byte
+	for _, op := range ops {
+		if op.opcode <= opPushData4 {
+			data = append(data, op.data)
+		}
+	}
+	return data, nil
+}
+
+// ScriptFingerprint returns a compact fingerprint of the passed public key
+// script, which is the first 8 bytes of its SHA-256 hash.  It is suitable as
+// an index key for scanning outputs by script, such as with a prefix filter,
+// where the rare collisions between different scripts are tolerable since
+// the matches are checked against the full scripts anyway.
+func ScriptFingerprint(pkScript []byte) [8]byte {
+	var fingerprint [8]byte
+	hash := sha256.Sum256(pkScript)
+	copy(fingerprint[:], hash[:])
+	return fingerprint
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// ScriptFlags is a bitmask defining additional checks done when verifying the
+// scripts of inputs.  It mirrors txscript.ScriptFlags, which can't be
+// referenced from here without creating an import cycle, and shares the
+// values of the flags defined here.  Other flags have no effect.
+type ScriptFlags uint32
+
+const (
+	// ScriptVerifyDERSignatures defines that signatures are required to
+	// comply with the strict DER encoding of BIP0066.
+	ScriptVerifyDERSignatures ScriptFlags = 1 << 6
+
+	// ScriptVerifyLowS defines that signatures are required to have an S
+	// value of at most half the order of the curve.
+	ScriptVerifyLowS ScriptFlags = 1 << 7
+
+	// ScriptVerifyWitness defines whether or not to verify inputs spending
+	// witness programs as defined by BIP0141.  Without it, witness
+	// programs are spendable by anyone as they were before segwit.
+	ScriptVerifyWitness ScriptFlags = 1 << 12
+)
+
+// ErrUnsupportedScript describes an error where an input spends an output
+// whose scripts VerifyScripts can't verify, as opposed to an input which
+// fails verification.
+var ErrUnsupportedScript = errors.New("verifying inputs spending the " +
+	"script type of the spent output is unsupported")
+
+// halfOrder is half the order of the secp256k1 curve, which is the highest S
+// value of a signature allowed by ScriptVerifyLowS.
+var halfOrder = new(big.Int).Rsh(btcec.S256().N, 1)
+
+// ScriptError describes an input whose scripts failed verification.
+type ScriptError struct {
+	// Index is the index of the offending input.
+	Index int
+
+	// Description is a human-readable description of the failure.
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e ScriptError) Error() string {
+	return fmt.Sprintf("input %d: %s", e.Index, e.Description)
+}
+
+// isMinimalPositiveInt returns whether the passed DER encoded integer, which
+// must not be empty, is positive and doesn't have excess zero padding.
+func isMinimalPositiveInt(n []byte) bool {
+	if n[0]&0x80 != 0 {
+		return false
+	}
+	return len(n) == 1 || n[0] != 0x00 || n[1]&0x80 != 0
+}
+
+// isStrictDERSignature returns whether the passed signature, which is followed
+// by its hash type, is strictly DER encoded as required by BIP0066.  That is,
+// along with the structure checked by isDERSignature, its R and S values must
+// be positive integers without excess zero padding.
+func isStrictDERSignature(sig []byte) bool {
+	if !isDERSignature(sig) {
+		return false
+	}
+	rLen := int(sig[3])
+	r := sig[4 : 4+rLen]
+	s := sig[6+rLen : len(sig)-1]
+	return isMinimalPositiveInt(r) && isMinimalPositiveInt(s)
+}
+
+// checkSig verifies the passed signature, which is followed by its hash type,
+// of the signature hash returned by calcHash for that hash type against the
+// passed serialized public key.  A description of the failure is returned
+// when it isn't valid.
+func checkSig(sig, pubKey []byte, flags ScriptFlags,
+	calcHash func(SigHashType) ([]byte, error)) string {
+
+	if len(sig) == 0 {
+		return "empty signature"
+	}
+	strictDER := flags&ScriptVerifyDERSignatures != 0
+	if strictDER && !isStrictDERSignature(sig) {
+		return "signature is not strictly DER encoded"
+	}
+	hashType := SigHashType(sig[len(sig)-1])
+	parse := btcec.ParseSignature
+	if strictDER {
+		parse = btcec.ParseDERSignature
+	}
+	signature, err := parse(sig[:len(sig)-1], btcec.S256())
+	if err != nil {
+		return fmt.Sprintf("malformed signature: %v", err)
+	}
+	if flags&ScriptVerifyLowS != 0 && signature.S.Cmp(halfOrder) > 0 {
+		return "signature has a high S value"
+	}
+	key, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return fmt.Sprintf("malformed public key: %v", err)
+	}
+	hash, err := calcHash(hashType)
+	if err != nil {
+		return err.Error()
+	}
+	if !signature.Verify(hash, key) {
+		return "signature verification failed"
+	}
+	return ""
+}
+
+// verifyInputScripts verifies the scripts of the input at index idx of the
+// passed transaction.  Only inputs spending pay-to-pubkey, pay-to-pubkey-hash
+// and pay-to-witness-pubkey-hash outputs can be verified, and
+// ErrUnsupportedScript is returned for any others.
+func (v *UtxoView) verifyInputScripts(tx *TxNew, idx int, flags ScriptFlags,
+	sigHashes *TxSigHashes) error {
+
+	txIn := tx.msgTx.TxIn[idx]
+	entry := v.LookupEntry(txIn.PreviousOutPoint)
+	if entry == nil {
+		return ErrMissingTxOut
+	}
+	pkScript := entry.PkScript()
+	fail := func(description string) error {
+		return ScriptError{Index: idx, Description: description}
+	}
+
+	// Inputs spending witness programs are verified against their
+	// witnesses, while all others must not have any.  Without witness
+	// verification, witness programs are spendable by anyone.
+	_, _, isWitness := WitnessVersion(pkScript)
+	if isWitness && flags&ScriptVerifyWitness == 0 {
+		return nil
+	}
+	if isWitness && !isWitnessPubKeyHashScript(pkScript) {
+		return ErrUnsupportedScript
+	}
+	if isWitness {
+		if len(txIn.SignatureScript) != 0 {
+			return fail("non-empty signature script for p2wpkh " +
+				"input")
+		}
+		if len(txIn.Witness) != 2 {
+			return fail(fmt.Sprintf("p2wpkh witness has %d items, "+
+				"want 2", len(txIn.Witness)))
+		}
+		sig, pubKey := txIn.Witness[0], txIn.Witness[1]
+		if !bytes.Equal(Hash160(pubKey), pkScript[2:]) {
+			return fail("public key does not match p2wpkh " +
+				"program")
+		}
+		description := checkSig(sig, pubKey, flags,
+			func(hashType SigHashType) ([]byte, error) {
+				hash, err := tx.WitnessSignatureHash(idx,
+					sigHashes, hashType, pkScript,
+					entry.Amount())
+				return hash[:], err
+			})
+		if description != "" {
+			return fail(description)
+		}
+		return nil
+	}
+	if flags&ScriptVerifyWitness != 0 && len(txIn.Witness) != 0 {
+		return fail("unexpected witness for non-witness input")
+	}
+
+	pkOps, err := parseScript(pkScript)
+	if err != nil {
+		return fail("malformed public key script")
+	}
+	if !isPubKey(pkOps) && !isPubKeyHash(pkOps) {
+		return ErrUnsupportedScript
+	}
+	sigOps, err := parseScript(txIn.SignatureScript)
+	if err != nil || !isPushOnly(txIn.SignatureScript) {
+		return fail("signature script is not push only")
+	}
+	var sig, pubKey []byte
+	if isPubKey(pkOps) {
+		if len(sigOps) != 1 {
+			return fail("p2pk signature script is not a signature")
+		}
+		sig, pubKey = sigOps[0].data, pkOps[0].data
+	} else {
+		if len(sigOps) != 2 {
+			return fail("p2pkh signature script is not a " +
+				"signature and a public key")
+		}
+		sig, pubKey = sigOps[0].data, sigOps[1].data
+		if !bytes.Equal(Hash160(pubKey), pkOps[2].data) {
+			return fail("public key does not match p2pkh hash")
+		}
+	}
+
+	description := checkSig(sig, pubKey, flags,
+		func(hashType SigHashType) ([]byte, error) {
+			hash, err := tx.SignatureHash(idx, pkScript, hashType)
+			return hash[:], err
+		})
+	if description != "" {
+		return fail(description)
+	}
+	return nil
+}
+
+// VerifyScripts verifies the scripts of each input of the passed transaction
+// against the output it spends from the view, using the passed flags, and
+// returns the error for the first input which fails.  ErrMissingTxOut is
+// returned when a spent output is not in the view, and a ScriptError when an
+// input fails verification.
+//
+// Unlike txscript, there is no general script engine available here, so it is
+// not a general script verifier.  Only inputs spending pay-to-pubkey,
+// pay-to-pubkey-hash and, with ScriptVerifyWitness, pay-to-witness-pubkey-hash
+// outputs can be verified, and ErrUnsupportedScript is returned for inputs
+// spending any other outputs, such as pay-to-script-hash, P2WSH and bare
+// multisig outputs, so callers can tell them apart from invalid inputs.
+// Coinbase transactions have no inputs to verify.
+func (v *UtxoView) VerifyScripts(tx *TxNew, flags ScriptFlags) error {
+	if tx.IsCoinBase() {
+		return nil
+	}
+
+	sigHashes := NewTxSigHashes(tx)
+	for i := range tx.msgTx.TxIn {
+		err := v.verifyInputScripts(tx, i, flags, sigHashes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyScriptsVerbose verifies the scripts of the passed transaction like
+// VerifyScripts, however rather than stopping at the first failure, it
+// verifies every input and returns the error of each one, which is nil for
+// those which pass, such as for debugging transactions with several
+// incorrectly signed inputs.
+func (v *UtxoView) VerifyScriptsVerbose(tx *TxNew, flags ScriptFlags) []error {
+	errs := make([]error, len(tx.msgTx.TxIn))
+	if tx.IsCoinBase() {
+		return errs
+	}
+
+	sigHashes := NewTxSigHashes(tx)
+	for i := range tx.msgTx.TxIn {
+		errs[i] = v.verifyInputScripts(tx, i, flags, sigHashes)
+	}
+	return errs
+}
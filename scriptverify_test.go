@@ -0,0 +1,233 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newSignedMsgTx returns a view holding a P2PKH, a P2WPKH and a P2PK output
+// paying to the passed private key, along with a transaction spending them
+// whose inputs are signed by signers, in the same order.
+func newSignedMsgTx(t *testing.T, key *btcec.PrivateKey,
+	signers [3]*btcec.PrivateKey) (*btcutil.UtxoView, *wire.MsgTx) {
+
+	pubKey := key.PubKey().SerializeCompressed()
+	pubKeyHash := btcutil.Hash160(pubKey)
+	pkScripts := [][]byte{
+		append(append([]byte{0x76, 0xa9, 0x14}, pubKeyHash...), 0x88,
+			0xac),
+		append([]byte{0x00, 0x14}, pubKeyHash...),
+		append(append([]byte{0x21}, pubKey...), 0xac),
+	}
+
+	view := btcutil.NewUtxoView()
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for i, pkScript := range pkScripts {
+		prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01},
+			Index: uint32(i)}
+		view.AddEntry(prevOut, btcutil.NewUtxoEntry(
+			wire.NewTxOut(int64(i+1)*10000, pkScript), 100, false))
+		msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(50000, p2wpkhScript))
+
+	tx := btcutil.TstNewTxNew(msgTx)
+	sigHashes := btcutil.NewTxSigHashes(tx)
+	for i, pkScript := range pkScripts {
+		var hash chainhash.Hash
+		var err error
+		if i == 1 {
+			hash, err = tx.WitnessSignatureHash(i, sigHashes,
+				btcutil.SigHashAll, pkScript, 20000)
+		} else {
+			hash, err = tx.SignatureHash(i, pkScript,
+				btcutil.SigHashAll)
+		}
+		if err != nil {
+			t.Fatalf("signature hash #%d: %v", i, err)
+		}
+		sig, err := signers[i].Sign(hash[:])
+		if err != nil {
+			t.Fatalf("Sign #%d: %v", i, err)
+		}
+		sigBytes := append(sig.Serialize(), byte(btcutil.SigHashAll))
+
+		txIn := msgTx.TxIn[i]
+		switch i {
+		case 0:
+			txIn.SignatureScript = append(append([]byte{
+				byte(len(sigBytes))}, sigBytes...), 0x21)
+			txIn.SignatureScript = append(txIn.SignatureScript,
+				pubKey...)
+		case 1:
+			txIn.Witness = wire.TxWitness{sigBytes, pubKey}
+		case 2:
+			txIn.SignatureScript = append([]byte{
+				byte(len(sigBytes))}, sigBytes...)
+		}
+	}
+	return view, msgTx
+}
+
+// TestVerifyScripts ensures the signatures of inputs spending single key
+// outputs are verified and every failing input is reported.
+func TestVerifyScripts(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		bytes.Repeat([]byte{0x01}, 32))
+	otherKey, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		bytes.Repeat([]byte{0x02}, 32))
+	const flags = btcutil.ScriptVerifyDERSignatures |
+		btcutil.ScriptVerifyLowS | btcutil.ScriptVerifyWitness
+
+	// All inputs of a correctly signed transaction pass.
+	view, msgTx := newSignedMsgTx(t, key, [3]*btcec.PrivateKey{key, key,
+		key})
+	tx := btcutil.TstNewTxNew(msgTx)
+	if err := view.VerifyScripts(tx, flags); err != nil {
+		t.Errorf("VerifyScripts: unexpected error: %v", err)
+	}
+	errs := view.VerifyScriptsVerbose(tx, flags)
+	if len(errs) != 3 {
+		t.Fatalf("VerifyScriptsVerbose: got %d errors, want 3", len(errs))
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("VerifyScriptsVerbose #%d: unexpected error: %v",
+				i, err)
+		}
+	}
+
+	// Sign the first and last inputs with the wrong key.  Only the first
+	// failure is returned by VerifyScripts, while both are returned by
+	// VerifyScriptsVerbose.
+	view, msgTx = newSignedMsgTx(t, key, [3]*btcec.PrivateKey{otherKey,
+		key, otherKey})
+	tx = btcutil.TstNewTxNew(msgTx)
+	err := view.VerifyScripts(tx, flags)
+	if serr, ok := err.(btcutil.ScriptError); !ok || serr.Index != 0 {
+		t.Errorf("VerifyScripts: got error %v, want script error for "+
+			"input 0", err)
+	}
+	errs = view.VerifyScriptsVerbose(tx, flags)
+	if len(errs) != 3 {
+		t.Fatalf("VerifyScriptsVerbose: got %d errors, want 3", len(errs))
+	}
+	for i, err := range errs {
+		if i == 1 {
+			if err != nil {
+				t.Errorf("VerifyScriptsVerbose #%d: unexpected "+
+					"error: %v", i, err)
+			}
+			continue
+		}
+		if serr, ok := err.(btcutil.ScriptError); !ok || serr.Index != i {
+			t.Errorf("VerifyScriptsVerbose #%d: got error %v, want "+
+				"script error", i, err)
+		}
+	}
+
+	// Witness programs are spendable by anyone without witness
+	// verification.
+	msgTx.TxIn[1].Witness = nil
+	errs = view.VerifyScriptsVerbose(tx, 0)
+	if errs[1] != nil {
+		t.Errorf("VerifyScriptsVerbose: unexpected error without "+
+			"witness verification: %v", errs[1])
+	}
+	errs = view.VerifyScriptsVerbose(tx, flags)
+	if errs[1] == nil {
+		t.Errorf("VerifyScriptsVerbose: expected error for missing " +
+			"witness")
+	}
+
+	// Spent outputs must be in the view, and inputs spending outputs of
+	// unsupported types are reported as such rather than as failures.
+	view = btcutil.NewUtxoView()
+	view.AddEntry(msgTx.TxIn[0].PreviousOutPoint, btcutil.NewUtxoEntry(
+		wire.NewTxOut(10000, p2shScript), 100, false))
+	view.AddEntry(msgTx.TxIn[2].PreviousOutPoint, btcutil.NewUtxoEntry(
+		wire.NewTxOut(30000, p2wshScript), 100, false))
+	errs = view.VerifyScriptsVerbose(tx, flags)
+	for _, i := range []int{0, 2} {
+		if errs[i] != btcutil.ErrUnsupportedScript {
+			t.Errorf("VerifyScriptsVerbose #%d: got error %v, "+
+				"want %v", i, errs[i],
+				btcutil.ErrUnsupportedScript)
+		}
+	}
+	if errs[1] != btcutil.ErrMissingTxOut {
+		t.Errorf("VerifyScriptsVerbose: got error %v, want %v", errs[1],
+			btcutil.ErrMissingTxOut)
+	}
+}
+
+// TestVerifyScriptsStrictDER ensures signatures whose R value is padded or
+// negative are only rejected when strict DER encoding is required.
+func TestVerifyScriptsStrictDER(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		bytes.Repeat([]byte{0x01}, 32))
+	const flags = btcutil.ScriptVerifyLowS | btcutil.ScriptVerifyWitness
+	const strictFlags = flags | btcutil.ScriptVerifyDERSignatures
+
+	// replaceR returns the signature pushed by the signature script of
+	// the P2PK input with its R value replaced by the result of modify.
+	replaceR := func(sigScript []byte, modify func([]byte) []byte) []byte {
+		sig := sigScript[1:]
+		rLen := int(sig[3])
+		r := modify(append([]byte(nil), sig[4:4+rLen]...))
+		newSig := []byte{0x30, byte(len(sig) - 3 - rLen + len(r)), 0x02,
+			byte(len(r))}
+		newSig = append(newSig, r...)
+		newSig = append(newSig, sig[4+rLen:]...)
+		return append([]byte{byte(len(newSig))}, newSig...)
+	}
+
+	// Padding R with a zero byte leaves its value unchanged, so the
+	// signature is only rejected by strict DER verification.
+	view, msgTx := newSignedMsgTx(t, key, [3]*btcec.PrivateKey{key, key,
+		key})
+	msgTx.TxIn[2].SignatureScript = replaceR(msgTx.TxIn[2].SignatureScript,
+		func(r []byte) []byte { return append([]byte{0x00}, r...) })
+	tx := btcutil.TstNewTxNew(msgTx)
+	if err := view.VerifyScripts(tx, flags); err != nil {
+		t.Errorf("VerifyScripts: unexpected error for padded R: %v",
+			err)
+	}
+	err := view.VerifyScripts(tx, strictFlags)
+	if serr, ok := err.(btcutil.ScriptError); !ok || serr.Index != 2 ||
+		serr.Description != "signature is not strictly DER encoded" {
+
+		t.Errorf("VerifyScripts: got error %v for padded R, want DER "+
+			"error for input 2", err)
+	}
+
+	// Make R negative, either by dropping the zero byte which keeps it
+	// positive or by setting its sign bit.
+	view, msgTx = newSignedMsgTx(t, key, [3]*btcec.PrivateKey{key, key,
+		key})
+	msgTx.TxIn[2].SignatureScript = replaceR(msgTx.TxIn[2].SignatureScript,
+		func(r []byte) []byte {
+			if r[0] == 0x00 {
+				return r[1:]
+			}
+			r[0] |= 0x80
+			return r
+		})
+	tx = btcutil.TstNewTxNew(msgTx)
+	err = view.VerifyScripts(tx, strictFlags)
+	if serr, ok := err.(btcutil.ScriptError); !ok || serr.Index != 2 ||
+		serr.Description != "signature is not strictly DER encoded" {
+
+		t.Errorf("VerifyScripts: got error %v for negative R, want "+
+			"DER error for input 2", err)
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SigHashType represents hash type bits at the end of a signature.
+type SigHashType uint32
+
+// Hash type bits from the end of a signature.
+const (
+	SigHashDefault      SigHashType = 0x0
+	SigHashOld          SigHashType = 0x0
+	SigHashAll          SigHashType = 0x1
+	SigHashNone         SigHashType = 0x2
+	SigHashSingle       SigHashType = 0x3
+	SigHashAnyOneCanPay SigHashType = 0x80
+
+	// sigHashMask defines the number of bits of the hash type which is used
+	// to identify which outputs are signed.
+	sigHashMask = 0x1f
+)
+
+// shallowCopyMsgTx creates a shallow copy of the transaction for use when
+// calculating the signature hash.  The inputs and outputs are copied so they
+// can be modified without affecting the original, while the scripts they
+// reference are shared.
+func shallowCopyMsgTx(tx *wire.MsgTx) wire.MsgTx {
+	txCopy := wire.MsgTx{
+		Version:  tx.Version,
+		TxIn:     make([]*wire.TxIn, len(tx.TxIn)),
+		TxOut:    make([]*wire.TxOut, len(tx.TxOut)),
+		LockTime: tx.LockTime,
+	}
+	txIns := make([]wire.TxIn, len(tx.TxIn))
+	for i, oldTxIn := range tx.TxIn {
+		txIns[i] = *oldTxIn
+		txCopy.TxIn[i] = &txIns[i]
+	}
+	txOuts := make([]wire.TxOut, len(tx.TxOut))
+	for i, oldTxOut := range tx.TxOut {
+		txOuts[i] = *oldTxOut
+		txCopy.TxOut[i] = &txOuts[i]
+	}
+	return txCopy
+}
+
+// SignatureHash returns the legacy (pre-segwit) signature hash for the input
+// at index idx spending an output locked by subScript, using the passed hash
+// type.
+//
+// For compatibility with the original implementation, requesting a
+// SigHashSingle hash for an input without a corresponding output does not
+// produce an error, but returns the hash with a value of one instead.
+func (t *TxNew) SignatureHash(idx int, subScript []byte, hashType SigHashType) (chainhash.Hash, error) {
+	tx := t.msgTx
+	if idx < 0 || idx >= len(tx.TxIn) {
+		str := fmt.Sprintf("input index %d is out of range - max %d",
+			idx, len(tx.TxIn)-1)
+		return chainhash.Hash{}, OutOfRangeError(str)
+	}
+
+	// The SigHashSingle signature type signs only the corresponding input
+	// and output.  Due to a bug in the original implementation, a hash of
+	// one is signed when there is no corresponding output.
+	if hashType&sigHashMask == SigHashSingle && idx >= len(tx.TxOut) {
+		var hash chainhash.Hash
+		hash[0] = 0x01
+		return hash, nil
+	}
+
+	// Remove all instances of OP_CODESEPARATOR from the script.
+	script, err := removeOpcode(subScript, opCodeSeparator)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	// Make a shallow copy of the transaction, zeroing out the script for
+	// all inputs that are not currently being processed.
+	txCopy := shallowCopyMsgTx(tx)
+	for i := range txCopy.TxIn {
+		if i == idx {
+			txCopy.TxIn[idx].SignatureScript = script
+		} else {
+			txCopy.TxIn[i].SignatureScript = nil
+		}
+	}
+
+	switch hashType & sigHashMask {
+	case SigHashNone:
+		// Sign no outputs and let the other inputs be updated.
+		txCopy.TxOut = txCopy.TxOut[0:0]
+		for i := range txCopy.TxIn {
+			if i != idx {
+				txCopy.TxIn[i].Sequence = 0
+			}
+		}
+
+	case SigHashSingle:
+		// Resize output array to up to and including requested index
+		// and blank out all but the requested output.
+		txCopy.TxOut = txCopy.TxOut[:idx+1]
+		for i := 0; i < idx; i++ {
+			txCopy.TxOut[i].Value = -1
+			txCopy.TxOut[i].PkScript = nil
+		}
+		for i := range txCopy.TxIn {
+			if i != idx {
+				txCopy.TxIn[i].Sequence = 0
+			}
+		}
+
+	default:
+		// SigHashOld and SigHashAll as well as any unknown hash types
+		// sign everything.
+	}
+
+	// Only the current input is signed with SigHashAnyOneCanPay.
+	if hashType&SigHashAnyOneCanPay != 0 {
+		txCopy.TxIn = txCopy.TxIn[idx : idx+1]
+	}
+
+	// The final hash is the double sha256 of both the serialized modified
+	// transaction and the hash type encoded as a 4-byte little-endian
+	// value appended.
+	wbuf := bytes.NewBuffer(make([]byte, 0, txCopy.SerializeSizeStripped()+4))
+	if err := txCopy.SerializeNoWitness(wbuf); err != nil {
+		return chainhash.Hash{}, err
+	}
+	var hashTypeBytes [4]byte
+	binary.LittleEndian.PutUint32(hashTypeBytes[:], uint32(hashType))
+	wbuf.Write(hashTypeBytes[:])
+	return chainhash.DoubleHashH(wbuf.Bytes()), nil
+}
+
+// TxSigHashes houses the partial set of sighashes introduced within BIP0143.
+// This partial set of sighashes may be re-used within each input across a
+// transaction when validating or generating all of its witness signatures.
+type TxSigHashes struct {
+	HashPrevOuts chainhash.Hash
+	HashSequence chainhash.Hash
+	HashOutputs  chainhash.Hash
+}
+
+// NewTxSigHashes computes, and returns the cached sighashes of the given
+// transaction.
+func NewTxSigHashes(tx *TxNew) *TxSigHashes {
+	msgTx := tx.msgTx
+
+	// The prevouts hash is the double sha256 of all of the serialized
+	// outpoints being spent.
+	var prevOuts bytes.Buffer
+	for _, txIn := range msgTx.TxIn {
+		prevOuts.Write(txIn.PreviousOutPoint.Hash[:])
+		var bIndex [4]byte
+		binary.LittleEndian.PutUint32(bIndex[:], txIn.PreviousOutPoint.Index)
+		prevOuts.Write(bIndex[:])
+	}
+
+	// The sequence hash is the double sha256 of the sequence numbers of
+	// all inputs.
+	var sequences bytes.Buffer
+	for _, txIn := range msgTx.TxIn {
+		var bSequence [4]byte
+		binary.LittleEndian.PutUint32(bSequence[:], txIn.Sequence)
+		sequences.Write(bSequence[:])
+	}
+
+	// The outputs hash is the double sha256 of all serialized outputs.
+	var outputs bytes.Buffer
+	for _, txOut := range msgTx.TxOut {
+		wire.WriteTxOut(&outputs, 0, 0, txOut)
+	}
+
+	return &TxSigHashes{
+		HashPrevOuts: chainhash.DoubleHashH(prevOuts.Bytes()),
+		HashSequence: chainhash.DoubleHashH(sequences.Bytes()),
+		HashOutputs:  chainhash.DoubleHashH(outputs.Bytes()),
+	}
+}
+
+// isWitnessPubKeyHashScript returns whether the passed script is a version 0
+// pay-to-witness-pubkey-hash output script.
+func isWitnessPubKeyHashScript(script []byte) bool {
+	return len(script) == 22 && script[0] == op0 && script[1] == opData20
+}
+
+// WitnessSignatureHash returns the BIP0143 signature hash for the input at
+// index idx which spends an output of the given amount.  The sigHashes are
+// the midstates shared by all inputs of the transaction as returned by
+// NewTxSigHashes.
+//
+// The subScript is the script code of the input.  As a convenience, passing a
+// version 0 pay-to-witness-pubkey-hash output script uses the corresponding
+// pay-to-pubkey-hash script code as required by BIP0143.
+func (t *TxNew) WitnessSignatureHash(idx int, sigHashes *TxSigHashes,
+	hashType SigHashType, subScript []byte, amount int64) (chainhash.Hash, error) {
+
+	tx := t.msgTx
+	if idx < 0 || idx >= len(tx.TxIn) {
+		str := fmt.Sprintf("input index %d is out of range - max %d",
+			idx, len(tx.TxIn)-1)
+		return chainhash.Hash{}, OutOfRangeError(str)
+	}
+
+	// First write out the transaction's version number.
+	var sigHash bytes.Buffer
+	var bVersion [4]byte
+	binary.LittleEndian.PutUint32(bVersion[:], uint32(tx.Version))
+	sigHash.Write(bVersion[:])
+
+	// The cached prevouts hash is only committed to when anyone can pay
+	// isn't active, and the cached sequence hash only when additionally
+	// neither single nor none are used.  Zeroes are written otherwise.
+	var zeroHash chainhash.Hash
+	anyoneCanPay := hashType&SigHashAnyOneCanPay != 0
+	baseType := hashType & sigHashMask
+	if !anyoneCanPay {
+		sigHash.Write(sigHashes.HashPrevOuts[:])
+	} else {
+		sigHash.Write(zeroHash[:])
+	}
+	if !anyoneCanPay && baseType != SigHashSingle && baseType != SigHashNone {
+		sigHash.Write(sigHashes.HashSequence[:])
+	} else {
+		sigHash.Write(zeroHash[:])
+	}
+
+	// Next, write the outpoint being spent.
+	txIn := tx.TxIn[idx]
+	sigHash.Write(txIn.PreviousOutPoint.Hash[:])
+	var bIndex [4]byte
+	binary.LittleEndian.PutUint32(bIndex[:], txIn.PreviousOutPoint.Index)
+	sigHash.Write(bIndex[:])
+
+	// Write the script code.  For p2wkh it is a re-creation of the
+	// original p2pkh script, otherwise the script itself.
+	if isWitnessPubKeyHashScript(subScript) {
+		sigHash.Write([]byte{0x19, opDup, opHash160, opData20})
+		sigHash.Write(subScript[2:])
+		sigHash.Write([]byte{opEqualVerify, opCheckSig})
+	} else {
+		if err := wire.WriteVarBytes(&sigHash, 0, subScript); err != nil {
+			return chainhash.Hash{}, err
+		}
+	}
+
+	// Next, add the input amount and sequence number of the input being
+	// signed.
+	var bAmount [8]byte
+	binary.LittleEndian.PutUint64(bAmount[:], uint64(amount))
+	sigHash.Write(bAmount[:])
+	var bSequence [4]byte
+	binary.LittleEndian.PutUint32(bSequence[:], txIn.Sequence)
+	sigHash.Write(bSequence[:])
+
+	// All outputs are committed to through the cached hash unless single
+	// or none are used, in which case only the output at the same index
+	// or nothing at all is committed to.
+	switch {
+	case baseType != SigHashSingle && baseType != SigHashNone:
+		sigHash.Write(sigHashes.HashOutputs[:])
+
+	case baseType == SigHashSingle && idx < len(tx.TxOut):
+		var b bytes.Buffer
+		if err := wire.WriteTxOut(&b, 0, 0, tx.TxOut[idx]); err != nil {
+			return chainhash.Hash{}, err
+		}
+		sigHash.Write(chainhash.DoubleHashB(b.Bytes()))
+
+	default:
+		sigHash.Write(zeroHash[:])
+	}
+
+	// Finally, write out the transaction's locktime and the sig hash type.
+	var bLockTime [4]byte
+	binary.LittleEndian.PutUint32(bLockTime[:], tx.LockTime)
+	sigHash.Write(bLockTime[:])
+	var bHashType [4]byte
+	binary.LittleEndian.PutUint32(bHashType[:], uint32(hashType))
+	sigHash.Write(bHashType[:])
+
+	return chainhash.DoubleHashH(sigHash.Bytes()), nil
+}
+
+// taprootAnnexTag is the first byte of a taproot annex as defined by BIP0341.
+const taprootAnnexTag = 0x50
+
+var (
+	// ErrInvalidTaprootSigHashType describes an error where a hash type
+	// which isn't valid for taproot signatures was requested.
+	ErrInvalidTaprootSigHashType = errors.New("invalid taproot sighash type")
+
+	// ErrInvalidTaprootAnnex describes an error where the passed annex
+	// does not start with the annex tag.
+	ErrInvalidTaprootAnnex = errors.New("invalid taproot annex")
+)
+
+// isValidTaprootSigHash returns whether the passed hash type is one of the
+// types allowed for taproot signatures.
+func isValidTaprootSigHash(hashType SigHashType) bool {
+	switch hashType {
+	case SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay:
+
+		return true
+	}
+	return false
+}
+
+// taggedHash returns the BIP0340 tagged hash of the passed message, that is
+// sha256(sha256(tag) || sha256(tag) || msg).
+func taggedHash(tag string, msg []byte) chainhash.Hash {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	h.Write(msg)
+
+	var hash chainhash.Hash
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// TaprootSignatureHash returns the BIP0341 signature hash for a key path
+// spend of the input at index idx.  The prevOuts are the outputs spent by
+// every input of the transaction, in input order, since taproot signatures
+// commit to all of them.  The annex is optional and must start with the annex
+// tag when present.
+func (t *TxNew) TaprootSignatureHash(idx int, prevOuts []wire.TxOut,
+	hashType SigHashType, annex []byte) (chainhash.Hash, error) {
+
+	tx := t.msgTx
+	if idx < 0 || idx >= len(tx.TxIn) {
+		str := fmt.Sprintf("input index %d is out of range - max %d",
+			idx, len(tx.TxIn)-1)
+		return chainhash.Hash{}, OutOfRangeError(str)
+	}
+	if len(prevOuts) != len(tx.TxIn) {
+		str := fmt.Sprintf("%d previous outputs provided for %d inputs",
+			len(prevOuts), len(tx.TxIn))
+		return chainhash.Hash{}, errors.New(str)
+	}
+	if !isValidTaprootSigHash(hashType) {
+		return chainhash.Hash{}, ErrInvalidTaprootSigHashType
+	}
+	if len(annex) > 0 && annex[0] != taprootAnnexTag {
+		return chainhash.Hash{}, ErrInvalidTaprootAnnex
+	}
+
+	anyoneCanPay := hashType&SigHashAnyOneCanPay != 0
+	baseType := hashType & 0x03
+	if baseType == SigHashSingle && idx >= len(tx.TxOut) {
+		str := fmt.Sprintf("no output corresponding to input index %d "+
+			"for SIGHASH_SINGLE", idx)
+		return chainhash.Hash{}, OutOfRangeError(str)
+	}
+
+	// The message starts with the epoch, hash type, version and lock time
+	// of the transaction.
+	var msg bytes.Buffer
+	var b4 [4]byte
+	var b8 [8]byte
+	msg.WriteByte(0x00)
+	msg.WriteByte(byte(hashType))
+	binary.LittleEndian.PutUint32(b4[:], uint32(tx.Version))
+	msg.Write(b4[:])
+	binary.LittleEndian.PutUint32(b4[:], tx.LockTime)
+	msg.Write(b4[:])
+
+	// Unless anyone can pay is active, commit to the single sha256 of all
+	// outpoints, amounts, output scripts and sequence numbers.
+	if !anyoneCanPay {
+		var prevOutsBuf, amounts, scripts, sequences bytes.Buffer
+		for i, txIn := range tx.TxIn {
+			prevOutsBuf.Write(txIn.PreviousOutPoint.Hash[:])
+			binary.LittleEndian.PutUint32(b4[:], txIn.PreviousOutPoint.Index)
+			prevOutsBuf.Write(b4[:])
+
+			binary.LittleEndian.PutUint64(b8[:], uint64(prevOuts[i].Value))
+			amounts.Write(b8[:])
+
+			err := wire.WriteVarBytes(&scripts, 0, prevOuts[i].PkScript)
+			if err != nil {
+				return chainhash.Hash{}, err
+			}
+
+			binary.LittleEndian.PutUint32(b4[:], txIn.Sequence)
+			sequences.Write(b4[:])
+		}
+		for _, buf := range []*bytes.Buffer{&prevOutsBuf, &amounts,
+			&scripts, &sequences} {
+
+			hash := sha256.Sum256(buf.Bytes())
+			msg.Write(hash[:])
+		}
+	}
+
+	// Commit to all outputs unless none or single are used.
+	if baseType != SigHashNone && baseType != SigHashSingle {
+		var outputs bytes.Buffer
+		for _, txOut := range tx.TxOut {
+			if err := wire.WriteTxOut(&outputs, 0, 0, txOut); err != nil {
+				return chainhash.Hash{}, err
+			}
+		}
+		hash := sha256.Sum256(outputs.Bytes())
+		msg.Write(hash[:])
+	}
+
+	// The spend type is always a key path spend, with the low bit marking
+	// the presence of an annex.
+	var spendType byte
+	if len(annex) > 0 {
+		spendType |= 0x01
+	}
+	msg.WriteByte(spendType)
+
+	// Commit to the input being signed itself when anyone can pay is
+	// active, otherwise only to its index.
+	if anyoneCanPay {
+		txIn := tx.TxIn[idx]
+		msg.Write(txIn.PreviousOutPoint.Hash[:])
+		binary.LittleEndian.PutUint32(b4[:], txIn.PreviousOutPoint.Index)
+		msg.Write(b4[:])
+		if err := wire.WriteTxOut(&msg, 0, 0, &prevOuts[idx]); err != nil {
+			return chainhash.Hash{}, err
+		}
+		binary.LittleEndian.PutUint32(b4[:], txIn.Sequence)
+		msg.Write(b4[:])
+	} else {
+		binary.LittleEndian.PutUint32(b4[:], uint32(idx))
+		msg.Write(b4[:])
+	}
+
+	// Commit to the annex with its length prefix when present.
+	if len(annex) > 0 {
+		var annexBuf bytes.Buffer
+		if err := wire.WriteVarBytes(&annexBuf, 0, annex); err != nil {
+			return chainhash.Hash{}, err
+		}
+		hash := sha256.Sum256(annexBuf.Bytes())
+		msg.Write(hash[:])
+	}
+
+	// Commit to the output at the same index for single.
+	if baseType == SigHashSingle {
+		var output bytes.Buffer
+		err := wire.WriteTxOut(&output, 0, 0, tx.TxOut[idx])
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+		hash := sha256.Sum256(output.Bytes())
+		msg.Write(hash[:])
+	}
+
+	return taggedHash("TapSighash", msg.Bytes()), nil
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// hexToTxNew decodes the passed hex-encoded transaction into a TxNew.  It
+// panics on an error since it is only used with hard-coded, and therefore
+// known good, transactions.
+func hexToTxNew(s string) *btcutil.TxNew {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	tx, err := btcutil.NewTxNewFromBytes(b)
+	if err != nil {
+		panic("invalid transaction in source file: " + s)
+	}
+	return tx
+}
+
+// TestSignatureHash tests the legacy signature hash calculation against a
+// selection of the reference vectors from Bitcoin Core's sighash.json.
+func TestSignatureHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		tx       string
+		script   string
+		idx      int
+		hashType int32
+		want     string
+	}{
+		{
+			name:     "SIGHASH_ALL",
+			tx:       "cf7bdc250249e22cbe23baf6b648328d31773ea0e771b3b76a48b4748d7fbd390e88a004d30000000003ac536a4ab8cce0e097136c90b2037f231b7fde2063017facd40ed4e5896da7ad00e9c71dd70ae600000000096a0063516352525365ffffffff01b71e3e00000000000300536a00000000",
+			script:   "",
+			idx:      1,
+			hashType: 546970113,
+			want:     "6a815ba155270af102322c882f26d22da11c5330a751f520807936b320b9af5d",
+		},
+		{
+			name:     "SIGHASH_ALL|ANYONECANPAY with code separators",
+			tx:       "4ddaa680026ec4d8060640304b86823f1ac760c260cef81d85bd847952863d629a3002b54b0200000008526365636a656aab65457861fc6c24bdc760c8b2e906b6656edaf9ed22b5f50e1fb29ec076ceadd9e8ebcb6b000000000152ffffffff033ff04f00000000000551526a00657a1d900300000000002153af040000000003006a6300000000",
+			script:   "ab526a53acabab",
+			idx:      0,
+			hashType: 1055317633,
+			want:     "7f21b62267ed52462e371a917eb3542569a4049b9dfca2de3c75872b39510b26",
+		},
+		{
+			name:     "SIGHASH_NONE",
+			tx:       "2f7353dd02e395b0a4d16da0f7472db618857cd3de5b9e2789232952a9b154d249102245fd030000000151617fd88f103280b85b0a198198e438e7cab1a4c92ba58409709997cc7a65a619eb9eec3c0200000003636aabffffffff0397481c0200000000045300636a0dc97803000000000009d389030000000003ac6a53134007bb",
+			script:   "0000536552526a",
+			idx:      0,
+			hashType: -1912746174,
+			want:     "30c4cd4bd6b291f7e9489cc4b4440a083f93a7664ea1f93e77a9597dab8ded9c",
+		},
+		{
+			name:     "SIGHASH_NONE|ANYONECANPAY",
+			tx:       "25ee54ef0187387564bb86e0af96baec54289ca8d15e81a507a2ed6668dc92683111dfb7a50100000004005263634cecf17d0429aa4d000000000007636a6aabab5263daa75601000000000251ab4df70a01000000000151980a890400000000065253ac6a006377fd24e3",
+			script:   "65ab",
+			idx:      0,
+			hashType: 797877378,
+			want:     "069f38fd5d47abff46f04ee3ae27db03275e9aa4737fa0d2f5394779f9654845",
+		},
+		{
+			name:     "SIGHASH_SINGLE",
+			tx:       "ff5400dd02fec5beb9a396e1cbedc82bedae09ed44bae60ba9bef2ff375a6858212478844b03000000025253ffffffff01e46c203577a79d1172db715e9cc6316b9cfc59b5e5e4d9199fef201c6f9f0f000000000900ab6552656a5165acffffffff02e8ce62040000000002515312ce3e00000000000251513f119316",
+			script:   "",
+			idx:      0,
+			hashType: 1541581667,
+			want:     "1e0da47eedbbb381b0e0debbb76e128d042e02e65b11125e17fd127305fc65cd",
+		},
+		{
+			name:     "SIGHASH_SINGLE|ANYONECANPAY",
+			tx:       "d3b7421e011f4de0f1cea9ba7458bf3486bee722519efab711a963fa8c100970cf7488b7bb0200000003525352dcd61b300148be5d05000000000000000000",
+			script:   "535251536aac536a",
+			idx:      0,
+			hashType: -1960128125,
+			want:     "29aa6d2d752d3310eba20442770ad345b7f6a35f96161ede5f07b33e92053e2a",
+		},
+		{
+			// The second input has no corresponding output, so the
+			// bug-compatible hash of one must be returned.
+			name:     "SIGHASH_SINGLE without matching output",
+			tx:       "cf7bdc250249e22cbe23baf6b648328d31773ea0e771b3b76a48b4748d7fbd390e88a004d30000000003ac536a4ab8cce0e097136c90b2037f231b7fde2063017facd40ed4e5896da7ad00e9c71dd70ae600000000096a0063516352525365ffffffff01b71e3e00000000000300536a00000000",
+			script:   "",
+			idx:      1,
+			hashType: int32(btcutil.SigHashSingle),
+			want:     "0000000000000000000000000000000000000000000000000000000000000001",
+		},
+	}
+
+	for _, test := range tests {
+		tx := hexToTxNew(test.tx)
+		script, err := hex.DecodeString(test.script)
+		if err != nil {
+			t.Errorf("%s: invalid script hex: %v", test.name, err)
+			continue
+		}
+		want, err := chainhash.NewHashFromStr(test.want)
+		if err != nil {
+			t.Errorf("%s: invalid hash: %v", test.name, err)
+			continue
+		}
+
+		hash, err := tx.SignatureHash(test.idx, script,
+			btcutil.SigHashType(uint32(test.hashType)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !hash.IsEqual(want) {
+			t.Errorf("%s: mismatched hash - got %v, want %v",
+				test.name, hash, want)
+		}
+	}
+}
+
+// TestSignatureHashErrors tests the error paths for SignatureHash.
+func TestSignatureHashErrors(t *testing.T) {
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+
+	for _, idx := range []int{-1, len(tx.MsgTx().TxIn)} {
+		_, err := tx.SignatureHash(idx, nil, btcutil.SigHashAll)
+		if _, ok := err.(btcutil.OutOfRangeError); !ok {
+			t.Errorf("SignatureHash #%d: did not get expected "+
+				"OutOfRangeError - got %T", idx, err)
+		}
+	}
+
+	// A data push running past the end of the script is malformed.
+	_, err := tx.SignatureHash(0, []byte{0x4c}, btcutil.SigHashAll)
+	if err != btcutil.ErrMalformedScript {
+		t.Errorf("SignatureHash: did not get expected error - got %v, "+
+			"want %v", err, btcutil.ErrMalformedScript)
+	}
+}
+
+// TestWitnessSignatureHash tests the BIP0143 signature hash calculation
+// against the examples from the BIP.
+func TestWitnessSignatureHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		tx       string
+		script   string
+		idx      int
+		amount   int64
+		hashType btcutil.SigHashType
+		want     string
+	}{
+		{
+			// The P2WPKH output script must be expanded to the
+			// corresponding P2PKH script code.
+			name:     "native P2WPKH",
+			tx:       "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000",
+			script:   "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1",
+			idx:      1,
+			amount:   600000000,
+			hashType: btcutil.SigHashAll,
+			want:     "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670",
+		},
+		{
+			// The script code is passed explicitly and must be used
+			// as is.
+			name:     "P2SH-P2WPKH with explicit script code",
+			tx:       "0100000001db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a54770100000000feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac92040000",
+			script:   "76a91479091972186c449eb1ded22b78e40d009bdf008988ac",
+			idx:      0,
+			amount:   1000000000,
+			hashType: btcutil.SigHashAll,
+			want:     "64f3b0f4dd2bb3aa1ce8566d220cc74dda9df97d8490cc81d89d735c92e59fb6",
+		},
+	}
+
+	for _, test := range tests {
+		tx := hexToTxNew(test.tx)
+		script, err := hex.DecodeString(test.script)
+		if err != nil {
+			t.Errorf("%s: invalid script hex: %v", test.name, err)
+			continue
+		}
+
+		sigHashes := btcutil.NewTxSigHashes(tx)
+		hash, err := tx.WitnessSignatureHash(test.idx, sigHashes,
+			test.hashType, script, test.amount)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		// The BIP lists the hashes in byte order rather than the
+		// reversed order used when displaying hashes.
+		if got := hex.EncodeToString(hash[:]); got != test.want {
+			t.Errorf("%s: mismatched hash - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+
+	// Ensure an out of range input index is rejected.
+	tx := hexToTxNew(tests[0].tx)
+	_, err := tx.WitnessSignatureHash(2, btcutil.NewTxSigHashes(tx),
+		btcutil.SigHashAll, nil, 0)
+	if _, ok := err.(btcutil.OutOfRangeError); !ok {
+		t.Errorf("WitnessSignatureHash: did not get expected "+
+			"OutOfRangeError - got %T", err)
+	}
+}
+
+// TestTaprootSignatureHash tests the BIP0341 key path signature hash
+// calculation.  The vectors are valid key path spends taken from Bitcoin
+// Core's taproot script assets tests, so each expected hash is the message
+// the spend's BIP0340 signature verifies against.
+func TestTaprootSignatureHash(t *testing.T) {
+	type prevOut struct {
+		value  int64
+		script string
+	}
+	tests := []struct {
+		name     string
+		tx       string
+		prevOuts []prevOut
+		idx      int
+		hashType btcutil.SigHashType
+		annex    string
+		want     string
+	}{
+		{
+			name: "SIGHASH_DEFAULT",
+			tx:   "d76dec3801bcb2054607a921b3c6df992a9486776863b28485e731a805931b6feb14221acfb00000000010ed51ba02f2876300000000001976a9145dabd582fbdb106f3f7460c03ce83bc27d461d0f88ac5802000000000000160014619b982e9f6832d2edb1a1ee4e7656a8d72c65e7c1000000",
+			prevOuts: []prevOut{
+				{6678200, "5120860597d3b29a47949c68e53703a7c358236fede9036ee1439f49b54ea72cb70b"},
+			},
+			idx:      0,
+			hashType: btcutil.SigHashDefault,
+			want:     "9c83d2ee0ff4caba5fe44ec72c917932beda282db3766b9b9c3acc091a2463f6",
+		},
+		{
+			name: "SIGHASH_SINGLE|ANYONECANPAY",
+			tx:   "0200000001bcb2054607a921b3c6df992a9486776863b28485e731a805931b6feb14221acf5000000000de02e99601bf326c000000000017a9141d5a2c690c3e2dacb3cead240f0ce4a273b9d0e4876d010000",
+			prevOuts: []prevOut{
+				{7631967, "5120860597d3b29a47949c68e53703a7c358236fede9036ee1439f49b54ea72cb70b"},
+			},
+			idx:      0,
+			hashType: btcutil.SigHashSingle | btcutil.SigHashAnyOneCanPay,
+			want:     "81fcdfc87e13c07700ce17463198f34d2f3132c90f38fb2711002e7544cd4e63",
+		},
+		{
+			name: "SIGHASH_DEFAULT with annex",
+			tx:   "0200000002bcb2054607a921b3c6df992a9486776863b28485e731a805931b6feb14221acfc7000000009095a1b0dceb5f5568f8ada45d428630f512fb8efacd46682b4367b4edaf1985c5e4af4bb701000000a352ab8601a88993000000000017a914719f78084af863e000acd618ba76df97972236898739000000",
+			prevOuts: []prevOut{
+				{7724762, "5120d7a74e7d66477e5ce18f223a8c348977bbded01f23ea87f4513721d36eca07d5"},
+				{2670028, "5120c72d052844e54654bf1b4ba7d482e0a32ceacfdb2b793a896c2e00e5d00b606a"},
+			},
+			idx:      1,
+			hashType: btcutil.SigHashDefault,
+			annex:    "50ba592f23777ae38b527d1e68f48fbbd0597a4bd3512c0706cff7137b704520a6799688434c19b8a47faaa5b17c6887b3157b870a3c23288c8a8cbd09633106ac0a4ae8a59b92dbe9d5adb32aa66a90d0824a54e23936f4e8bd046cfff1c8d9b63774d6b0dbb485da602a7c96289a9aa07eb2248cb17ca8ad8af3b55c8b090e3abfda0e50755f980c8633d6044045c642c48ac87067",
+			want:     "121cb6025393baa31979102c1c94db4e7d55cc07050eee1f07bf68903b48010e",
+		},
+		{
+			name: "SIGHASH_SINGLE with annex",
+			tx:   "0200000002dceb5f5568f8ada45d428630f512fb8efacd46682b4367b4edaf1985c5e4af4b8f00000000ed8cc89e8bd9b9012d1e9d0bc9c34df9d487a1d5663f1b37dbd4a857a2bddcbe25f0d0c45a0000000057eac8a603966c5f000000000017a914f017945d4d088c7d42ab3bcbc1adce51d74fbd9f8758020000000000001976a91401f109af244d8c7f2563284ac2d2ba7d6323a75e88ac58020000000000001976a91490770ceff2b1c32e9dbf952fbe65b04a54d1949388ac496bcc1f",
+			prevOuts: []prevOut{
+				{2678655, "5120c72d052844e54654bf1b4ba7d482e0a32ceacfdb2b793a896c2e00e5d00b606a"},
+				{3681909, "5120eeb645229ded9c683f00135b937b2e4e86df68d251777aa040a582f59863bb1e"},
+			},
+			idx:      0,
+			hashType: btcutil.SigHashSingle,
+			annex:    "5083deecf4721c9cdb4119d484f0caeaf438104133a0c467de03fedcdf2a6bcd686be9e73c",
+			want:     "3abccd3004a87e796642ebb3ab8384490e6c789913afde9431112adec305bae7",
+		},
+	}
+
+	for _, test := range tests {
+		tx := hexToTxNew(test.tx)
+		prevOuts := make([]wire.TxOut, 0, len(test.prevOuts))
+		for _, p := range test.prevOuts {
+			script, err := hex.DecodeString(p.script)
+			if err != nil {
+				t.Fatalf("%s: invalid script hex: %v", test.name, err)
+			}
+			prevOuts = append(prevOuts, wire.TxOut{
+				Value:    p.value,
+				PkScript: script,
+			})
+		}
+		annex, err := hex.DecodeString(test.annex)
+		if err != nil {
+			t.Errorf("%s: invalid annex hex: %v", test.name, err)
+			continue
+		}
+
+		hash, err := tx.TaprootSignatureHash(test.idx, prevOuts,
+			test.hashType, annex)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got := hex.EncodeToString(hash[:]); got != test.want {
+			t.Errorf("%s: mismatched hash - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestTaprootSignatureHashErrors tests the error paths for
+// TaprootSignatureHash.
+func TestTaprootSignatureHashErrors(t *testing.T) {
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	prevOuts := []wire.TxOut{{Value: 1, PkScript: []byte{0x51}}}
+
+	// The number of previous outputs must match the number of inputs.
+	_, err := tx.TaprootSignatureHash(0, nil, btcutil.SigHashDefault, nil)
+	if err == nil {
+		t.Errorf("TaprootSignatureHash: did not receive expected error " +
+			"for missing previous outputs")
+	}
+
+	_, err = tx.TaprootSignatureHash(1, prevOuts, btcutil.SigHashDefault, nil)
+	if _, ok := err.(btcutil.OutOfRangeError); !ok {
+		t.Errorf("TaprootSignatureHash: did not get expected "+
+			"OutOfRangeError - got %T", err)
+	}
+
+	_, err = tx.TaprootSignatureHash(0, prevOuts, 0x04, nil)
+	if err != btcutil.ErrInvalidTaprootSigHashType {
+		t.Errorf("TaprootSignatureHash: did not get expected error - "+
+			"got %v, want %v", err, btcutil.ErrInvalidTaprootSigHashType)
+	}
+
+	_, err = tx.TaprootSignatureHash(0, prevOuts, btcutil.SigHashDefault,
+		[]byte{0x51})
+	if err != btcutil.ErrInvalidTaprootAnnex {
+		t.Errorf("TaprootSignatureHash: did not get expected error - "+
+			"got %v, want %v", err, btcutil.ErrInvalidTaprootAnnex)
+	}
+}
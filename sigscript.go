@@ -0,0 +1,244 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotMultiSig describes an error where a script is required to be
+	// a multi-signature script but a different script was provided.
+	ErrNotMultiSig = errors.New("script is not a multi-signature script")
+
+	// ErrRedeemScriptMismatch describes an error where the redeem script
+	// revealed by the signature script of an input differs from the one
+	// provided.
+	ErrRedeemScriptMismatch = errors.New("signature script does not " +
+		"reveal the provided redeem script")
+)
+
+// isDERSignature returns whether the passed data is encoded like a strict DER
+// signature followed by a hash type byte, as required by BIP0066.  The values
+// of the signature are not checked.
+func isDERSignature(sig []byte) bool {
+	// The format of a DER encoded signature followed by the hash type is:
+	//  0x30 <total length> 0x02 <length of R> <R> 0x02 <length of S> <S>
+	//  <hash type>
+	// Both R and S are at least one byte, so the minimum length is 9 bytes,
+	// and they are at most 33 bytes, so the maximum length is 73 bytes.
+	if len(sig) < 9 || len(sig) > 73 {
+		return false
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-3 {
+		return false
+	}
+
+	// Ensure R is an integer which leaves room for S.
+	rLen := int(sig[3])
+	if sig[2] != 0x02 || rLen == 0 || 5+rLen >= len(sig) {
+		return false
+	}
+
+	// Ensure S is an integer which ends right before the hash type.
+	sLen := int(sig[5+rLen])
+	return sig[4+rLen] == 0x02 && sLen != 0 && rLen+sLen+7 == len(sig)
+}
+
+// isSerializedPubKey returns whether the passed data has the length and prefix
+// of a compressed or uncompressed serialized public key.  The key itself is
+// not checked to be on the curve.
+func isSerializedPubKey(pubKey []byte) bool {
+	switch len(pubKey) {
+	case 33:
+		return pubKey[0] == 0x02 || pubKey[0] == 0x03
+	case 65:
+		return pubKey[0] == 0x04
+	}
+	return false
+}
+
+// ExtractPkScriptSigInfo returns the signatures and public keys pushed by the
+// passed signature script, such as those of a pay-to-pubkey-hash or
+// multi-signature spend.  When the final push is a multi-signature redeem
+// script, as in a pay-to-script-hash spend, its public keys are returned as
+// well.
+//
+// The extraction is heuristic since it only looks at the encoding of the
+// pushed data, so it is meant for analytics rather than validation.
+// Nonstandard scripts are tolerated by returning whatever could be extracted,
+// including from the pushes preceding a malformed one.
+func ExtractPkScriptSigInfo(scriptSig []byte) (sigs [][]byte, pubkeys [][]byte) {
+	ops, _ := parseScript(scriptSig)
+	for _, op := range ops {
+		switch {
+		case isDERSignature(op.data):
+			sigs = append(sigs, op.data)
+		case isSerializedPubKey(op.data):
+			pubkeys = append(pubkeys, op.data)
+		}
+	}
+
+	// Look for the public keys of a multi-signature redeem script.
+	if len(ops) == 0 {
+		return sigs, pubkeys
+	}
+	redeemOps, err := parseScript(ops[len(ops)-1].data)
+	if err != nil || !isMultiSig(redeemOps) {
+		return sigs, pubkeys
+	}
+	for _, op := range redeemOps[1 : len(redeemOps)-2] {
+		if isSerializedPubKey(op.data) {
+			pubkeys = append(pubkeys, op.data)
+		}
+	}
+	return sigs, pubkeys
+}
+
+// ExtractInputPubkeys returns the public keys of the passed multi-signature
+// redeem script spent by the input of the transaction with the passed index,
+// that is the keys controlling a pay-to-script-hash multi-signature input.
+// They are returned in the order they appear in the redeem script.
+//
+// ErrNotMultiSig is returned when the redeem script isn't a multi-signature
+// script.  Unless the input is unsigned, the final push of its signature script
+// must be the redeem script, otherwise ErrRedeemScriptMismatch is returned.
+func (t *TxNew) ExtractInputPubkeys(idx int, redeemScript []byte) ([][]byte, error) {
+	numTxIn := len(t.msgTx.TxIn)
+	if idx < 0 || idx >= numTxIn {
+		str := fmt.Sprintf("input index %d is out of range - max %d",
+			idx, numTxIn-1)
+		return nil, OutOfRangeError(str)
+	}
+
+	redeemOps, err := parseScript(redeemScript)
+	if err != nil || !isMultiSig(redeemOps) {
+		return nil, ErrNotMultiSig
+	}
+
+	sigScript := t.msgTx.TxIn[idx].SignatureScript
+	if len(sigScript) != 0 {
+		ops, err := parseScript(sigScript)
+		if err != nil || len(ops) == 0 ||
+			!bytes.Equal(ops[len(ops)-1].data, redeemScript) {
+			return nil, ErrRedeemScriptMismatch
+		}
+	}
+
+	pubKeyOps := redeemOps[1 : len(redeemOps)-2]
+	pubKeys := make([][]byte, 0, len(pubKeyOps))
+	for _, op := range pubKeyOps {
+		pubKeys = append(pubKeys, op.data)
+	}
+	return pubKeys, nil
+}
+
+// WitnessStructureError describes an input whose signature script or witness
+// doesn't have the structure required by the output it spends.
+type WitnessStructureError struct {
+	// Index is the index of the offending input.
+	Index int
+
+	// Description is a human-readable description of the problem.
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e WitnessStructureError) Error() string {
+	return fmt.Sprintf("input %d: %s", e.Index, e.Description)
+}
+
+// witnessProgram returns the witness program spent by an input with the
+// passed signature script spending the passed public key script, which is
+// either the script itself or, for a pay-to-script-hash output, the redeem
+// script pushed by the signature script.  False is returned when the input
+// doesn't spend a witness program.
+func witnessProgram(sigScript, pkScript []byte) ([]byte, bool) {
+	if isScriptHash(pkScript) {
+		ops, err := parseScript(sigScript)
+		if err != nil || len(ops) != 1 {
+			return nil, false
+		}
+		pkScript = ops[0].data
+	}
+	if _, _, ok := WitnessVersion(pkScript); !ok {
+		return nil, false
+	}
+	return pkScript, true
+}
+
+// ValidateWitnessStructure checks that the witness of each input of the
+// transaction has the structure required by the output it spends, whose public
+// key script is the corresponding entry of prevScripts.  It catches malformed
+// transactions early without verifying any signatures.  The structure checked
+// is:
+//
+//   - Inputs spending non-witness outputs have no witness
+//   - Inputs spending native witness programs have empty signature scripts,
+//     while those spending them nested in pay-to-script-hash outputs push
+//     only the program
+//   - Pay-to-witness-pubkey-hash witnesses are a signature and a compressed
+//     public key
+//   - Pay-to-witness-script-hash witnesses end with the witness script whose
+//     hash is the program
+//
+// Witnesses of inputs spending programs of unknown versions aren't checked, and
+// neither are those of coinbase transactions, which spend no outputs and whose
+// witness holds the witness reserved value.  A WitnessStructureError
+// identifying the offending input is returned when the structure is not as
+// required.
+func (t *TxNew) ValidateWitnessStructure(prevScripts [][]byte) error {
+	if t.IsCoinBase() {
+		return nil
+	}
+
+	if len(prevScripts) != len(t.msgTx.TxIn) {
+		return fmt.Errorf("got %d previous scripts for %d inputs",
+			len(prevScripts), len(t.msgTx.TxIn))
+	}
+
+	for i, txIn := range t.msgTx.TxIn {
+		witness := txIn.Witness
+		program, ok := witnessProgram(txIn.SignatureScript,
+			prevScripts[i])
+		if !ok {
+			if len(witness) != 0 {
+				return WitnessStructureError{i, "unexpected " +
+					"witness for non-witness input"}
+			}
+			continue
+		}
+		if !isScriptHash(prevScripts[i]) &&
+			len(txIn.SignatureScript) != 0 {
+			return WitnessStructureError{i, "non-empty signature " +
+				"script for native witness input"}
+		}
+
+		switch {
+		case isWitnessPubKeyHashScript(program):
+			if len(witness) != 2 || len(witness[1]) != 33 ||
+				!isSerializedPubKey(witness[1]) {
+				return WitnessStructureError{i, "witness for " +
+					"p2wpkh input is not a signature and a " +
+					"compressed public key"}
+			}
+
+		case isWitnessScriptHash(program):
+			if len(witness) == 0 {
+				return WitnessStructureError{i, "empty witness " +
+					"for p2wsh input"}
+			}
+			scriptHash := sha256.Sum256(witness[len(witness)-1])
+			if !bytes.Equal(scriptHash[:], program[2:]) {
+				return WitnessStructureError{i, "witness " +
+					"script does not match p2wsh program"}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newP2SHMultiSig returns the public keys of a 2-of-3 multi-signature redeem
+// script, the redeem script, and a pay-to-script-hash signature script which
+// spends it with the passed signature used twice.
+func newP2SHMultiSig(sig []byte) (pubKeys [][]byte, redeemScript, sigScript []byte) {
+	pubKeys = [][]byte{
+		hexToBytes("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28" +
+			"d959f2815b16f81798"),
+		hexToBytes("02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3c" +
+			"a7abac09b95c709ee5"),
+		hexToBytes("02f9308a019258c31049344f85f89d5229b531c845836f99" +
+			"b08601f113bce036f9"),
+	}
+	redeemScript = []byte{0x52}
+	for _, pubKey := range pubKeys {
+		redeemScript = append(redeemScript, 0x21)
+		redeemScript = append(redeemScript, pubKey...)
+	}
+	redeemScript = append(redeemScript, 0x53, 0xae)
+
+	sigScript = []byte{0x00, byte(len(sig))}
+	sigScript = append(sigScript, sig...)
+	sigScript = append(sigScript, byte(len(sig)))
+	sigScript = append(sigScript, sig...)
+	sigScript = append(sigScript, 0x4c, byte(len(redeemScript)))
+	sigScript = append(sigScript, redeemScript...)
+	return pubKeys, redeemScript, sigScript
+}
+
+// TestExtractPkScriptSigInfo ensures signatures and public keys are extracted
+// from signature scripts.
+func TestExtractPkScriptSigInfo(t *testing.T) {
+	t.Parallel()
+
+	// The pay-to-pubkey-hash signature script of the first input of the
+	// second transaction in block 100000.
+	p2pkhSigScript := Block100000.Transactions[1].TxIn[0].SignatureScript
+	sig := p2pkhSigScript[1 : 1+p2pkhSigScript[0]]
+	pubKey := p2pkhSigScript[2+len(sig):]
+
+	// A 2-of-3 multi-signature redeem script and pay-to-script-hash
+	// signature script spending it.
+	multiSigPubKeys, _, multiSigScript := newP2SHMultiSig(sig)
+
+	tests := []struct {
+		name      string
+		sigScript []byte
+		sigs      [][]byte
+		pubkeys   [][]byte
+	}{
+		{
+			name:      "p2pkh",
+			sigScript: p2pkhSigScript,
+			sigs:      [][]byte{sig},
+			pubkeys:   [][]byte{pubKey},
+		},
+		{
+			name:      "2-of-3 p2sh multisig",
+			sigScript: multiSigScript,
+			sigs:      [][]byte{sig, sig},
+			pubkeys:   multiSigPubKeys,
+		},
+		{
+			name:      "malformed after signature",
+			sigScript: append(p2pkhSigScript[:1+len(sig):1+len(sig)], 0x4c),
+			sigs:      [][]byte{sig},
+		},
+		{
+			name:      "no signatures or keys",
+			sigScript: hexToBytes("0151"),
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, test := range tests {
+		sigs, pubkeys := btcutil.ExtractPkScriptSigInfo(test.sigScript)
+		if !reflect.DeepEqual(sigs, test.sigs) {
+			t.Errorf("%s: got signatures %x, want %x", test.name,
+				sigs, test.sigs)
+		}
+		if !reflect.DeepEqual(pubkeys, test.pubkeys) {
+			t.Errorf("%s: got public keys %x, want %x", test.name,
+				pubkeys, test.pubkeys)
+		}
+	}
+}
+
+// TestTxNewExtractInputPubkeys ensures the public keys controlling a
+// pay-to-script-hash multi-signature input are extracted from its redeem
+// script.
+func TestTxNewExtractInputPubkeys(t *testing.T) {
+	t.Parallel()
+
+	// Spend a 2-of-3 multi-signature output with the first input and
+	// leave the second one unsigned.
+	p2pkhSigScript := Block100000.Transactions[1].TxIn[0].SignatureScript
+	sig := p2pkhSigScript[1 : 1+p2pkhSigScript[0]]
+	pubKeys, redeemScript, sigScript := newP2SHMultiSig(sig)
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		sigScript, nil))
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x02}},
+		nil, nil))
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x03}},
+		p2pkhSigScript, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, nil))
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	tests := []struct {
+		name         string
+		idx          int
+		redeemScript []byte
+		want         [][]byte
+		err          error
+	}{
+		{"signed", 0, redeemScript, pubKeys, nil},
+		{"unsigned", 1, redeemScript, pubKeys, nil},
+		{"other redeem script", 2, redeemScript, nil,
+			btcutil.ErrRedeemScriptMismatch},
+		{"not multisig", 0, p2pkhScript, nil, btcutil.ErrNotMultiSig},
+		{"wrong key length", 0, hexToBytes("51010251ae"), nil,
+			btcutil.ErrNotMultiSig},
+	}
+
+	for _, test := range tests {
+		got, err := tx.ExtractInputPubkeys(test.idx, test.redeemScript)
+		if err != test.err {
+			t.Errorf("ExtractInputPubkeys #%s: got error %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ExtractInputPubkeys #%s: got %x, want %x",
+				test.name, got, test.want)
+		}
+	}
+
+	// Out of range indices must be rejected.
+	for _, idx := range []int{-1, 3} {
+		_, err := tx.ExtractInputPubkeys(idx, redeemScript)
+		if _, ok := err.(btcutil.OutOfRangeError); !ok {
+			t.Errorf("ExtractInputPubkeys(%d): got error %v, want "+
+				"OutOfRangeError", idx, err)
+		}
+	}
+}
+
+// TestTxNewValidateWitnessStructure ensures witnesses which don't have the
+// structure required by the outputs they spend are detected.
+func TestTxNewValidateWitnessStructure(t *testing.T) {
+	t.Parallel()
+
+	witnessScript := []byte{0x51}
+	scriptHash := sha256.Sum256(witnessScript)
+	p2wshProgram := append([]byte{0x00, 0x20}, scriptHash[:]...)
+	nestedSigScript := append([]byte{byte(len(p2wpkhScript))},
+		p2wpkhScript...)
+
+	// The mixed witness transaction spends a P2WPKH output followed by a
+	// P2PKH output.
+	prevScripts := [][]byte{p2wpkhScript, p2pkhScript}
+	tests := []struct {
+		name        string
+		modify      func(msgTx *wire.MsgTx)
+		prevScripts [][]byte
+		badIndex    int
+	}{
+		{
+			name:     "well-formed p2wpkh",
+			modify:   func(*wire.MsgTx) {},
+			badIndex: -1,
+		},
+		{
+			name: "well-formed nested p2wpkh",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[0].SignatureScript = nestedSigScript
+			},
+			prevScripts: [][]byte{p2shScript, p2pkhScript},
+			badIndex:    -1,
+		},
+		{
+			name: "well-formed p2wsh",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[0].Witness = wire.TxWitness{
+					{0x01}, witnessScript,
+				}
+			},
+			prevScripts: [][]byte{p2wshProgram, p2pkhScript},
+			badIndex:    -1,
+		},
+		{
+			name: "p2wpkh with extra witness item",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[0].Witness = append(
+					msgTx.TxIn[0].Witness, []byte{0x01})
+			},
+			badIndex: 0,
+		},
+		{
+			name: "p2wpkh with uncompressed public key",
+			modify: func(msgTx *wire.MsgTx) {
+				pubKey := append([]byte{0x04},
+					bytes.Repeat([]byte{0x01}, 64)...)
+				msgTx.TxIn[0].Witness[1] = pubKey
+			},
+			badIndex: 0,
+		},
+		{
+			name: "p2wpkh with signature script",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[0].SignatureScript = []byte{0x51}
+			},
+			badIndex: 0,
+		},
+		{
+			name: "p2wsh with mismatched witness script",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[0].Witness = wire.TxWitness{{0x52}}
+			},
+			prevScripts: [][]byte{p2wshProgram, p2pkhScript},
+			badIndex:    0,
+		},
+		{
+			name: "witness for p2pkh",
+			modify: func(msgTx *wire.MsgTx) {
+				msgTx.TxIn[1].Witness = wire.TxWitness{{0x01}}
+			},
+			badIndex: 1,
+		},
+	}
+
+	for _, test := range tests {
+		msgTx := newMixedWitnessMsgTx()
+		test.modify(msgTx)
+		scripts := test.prevScripts
+		if scripts == nil {
+			scripts = prevScripts
+		}
+
+		err := btcutil.TstNewTxNew(msgTx).ValidateWitnessStructure(scripts)
+		if test.badIndex < 0 {
+			if err != nil {
+				t.Errorf("ValidateWitnessStructure #%s: "+
+					"unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		wsErr, ok := err.(btcutil.WitnessStructureError)
+		if !ok {
+			t.Errorf("ValidateWitnessStructure #%s: got error %v, "+
+				"want WitnessStructureError", test.name, err)
+			continue
+		}
+		if wsErr.Index != test.badIndex {
+			t.Errorf("ValidateWitnessStructure #%s: got index %d, "+
+				"want %d", test.name, wsErr.Index, test.badIndex)
+		}
+	}
+
+	// The previous scripts must match the inputs.
+	tx := btcutil.TstNewTxNew(newMixedWitnessMsgTx())
+	if err := tx.ValidateWitnessStructure(prevScripts[:1]); err == nil {
+		t.Errorf("ValidateWitnessStructure: accepted missing previous " +
+			"script")
+	}
+
+	// The witness reserved value of a coinbase is valid even though the
+	// coinbase spends no outputs.
+	coinbase := Block100000.Transactions[0].Copy()
+	coinbase.TxIn[0].Witness = wire.TxWitness{make([]byte, 32)}
+	tx = btcutil.TstNewTxNew(coinbase)
+	if err := tx.ValidateWitnessStructure(nil); err != nil {
+		t.Errorf("ValidateWitnessStructure: unexpected error for "+
+			"coinbase: %v", err)
+	}
+}
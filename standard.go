@@ -0,0 +1,329 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	// maxDataCarrierSize is the maximum number of bytes allowed in pushed
+	// data to be considered a standard nulldata script.
+	maxDataCarrierSize = 80
+
+	// opData36 is the opcode which pushes the next 36 bytes, used by the
+	// witness commitment.
+	opData36 = 0x24
+
+	// witnessCommitmentScriptLen is the minimum length of a witness
+	// commitment script, that is OP_RETURN, OP_DATA_36, the header, and
+	// the 32 byte commitment.
+	witnessCommitmentScriptLen = 1 + 1 + len(witnessCommitmentHeader) + 32
+)
+
+// witnessCommitmentHeader is the header which begins the data pushed by the
+// witness commitment output of a coinbase transaction as defined by BIP0141.
+var witnessCommitmentHeader = [4]byte{0xaa, 0x21, 0xa9, 0xed}
+
+// ScriptClass is an enumeration for the list of standard types of script.  It
+// mirrors txscript.ScriptClass, which can't be referenced from here without
+// creating an import cycle.
+type ScriptClass byte
+
+// Classes of script payment known about in the blockchain.
+const (
+	NonStandardTy         ScriptClass = iota // None of the recognized forms.
+	PubKeyTy                                 // Pay pubkey.
+	PubKeyHashTy                             // Pay pubkey hash.
+	WitnessV0PubKeyHashTy                    // Pay witness pubkey hash.
+	ScriptHashTy                             // Pay to script hash.
+	WitnessV0ScriptHashTy                    // Pay to witness script hash.
+	MultiSigTy                               // Multi signature.
+	NullDataTy                               // Empty data-only (provably prunable).
+)
+
+// scriptClassToName houses the human-readable strings which describe each
+// script class.
+var scriptClassToName = []string{
+	NonStandardTy:         "nonstandard",
+	PubKeyTy:              "pubkey",
+	PubKeyHashTy:          "pubkeyhash",
+	WitnessV0PubKeyHashTy: "witness_v0_keyhash",
+	ScriptHashTy:          "scripthash",
+	WitnessV0ScriptHashTy: "witness_v0_scripthash",
+	MultiSigTy:            "multisig",
+	NullDataTy:            "nulldata",
+}
+
+// String implements the Stringer interface by returning the name of
+// the enum script class.  If the enum is invalid then "Invalid" will be
+// returned.
+func (t ScriptClass) String() string {
+	if int(t) >= len(scriptClassToName) {
+		return "Invalid"
+	}
+	return scriptClassToName[t]
+}
+
+// isSmallInt returns whether or not the opcode is considered a small integer,
+// which is an OP_0, or OP_1 through OP_16.
+func isSmallInt(opcode byte) bool {
+	return opcode == op0 || (opcode >= op1 && opcode <= op16)
+}
+
+// asSmallInt returns the passed opcode, which must be true according to
+// isSmallInt(), as an integer.
+func asSmallInt(opcode byte) int {
+	if opcode == op0 {
+		return 0
+	}
+	return int(opcode - (op1 - 1))
+}
+
+// isDataPush returns whether or not the opcode pushes data onto the stack.
+func isDataPush(opcode byte) bool {
+	return opcode >= opData1 && opcode <= opPushData4
+}
+
+// isPubKey returns true if the script passed is a pay-to-pubkey transaction,
+// false otherwise.
+func isPubKey(ops []scriptOp) bool {
+	return len(ops) == 2 &&
+		(len(ops[0].data) == 33 || len(ops[0].data) == 65) &&
+		ops[1].opcode == opCheckSig
+}
+
+// isPubKeyHash returns true if the script passed is a pay-to-pubkey-hash
+// transaction, false otherwise.
+func isPubKeyHash(ops []scriptOp) bool {
+	return len(ops) == 5 &&
+		ops[0].opcode == opDup &&
+		ops[1].opcode == opHash160 &&
+		ops[2].opcode == opData20 &&
+		ops[3].opcode == opEqualVerify &&
+		ops[4].opcode == opCheckSig
+}
+
+// isScriptHash returns true if the script passed is a pay-to-script-hash
+// transaction, false otherwise.
+func isScriptHash(script []byte) bool {
+	return len(script) == 23 &&
+		script[0] == opHash160 &&
+		script[1] == opData20 &&
+		script[22] == opEqual
+}
+
+// isWitnessScriptHash returns true if the passed script is a
+// pay-to-witness-script-hash transaction, false otherwise.
+func isWitnessScriptHash(script []byte) bool {
+	return len(script) == 34 && script[0] == op0 && script[1] == opData32
+}
+
+// WitnessVersion returns the version and program of the passed witness program
+// script as defined by BIP141, that is a version opcode, OP_0 or OP_1 through
+// OP_16, followed by a single push of a 2 to 40 byte program.  False is
+// returned for scripts which aren't witness programs.
+func WitnessVersion(pkScript []byte) (version int, program []byte, ok bool) {
+	if len(pkScript) < 4 || len(pkScript) > 42 {
+		return 0, nil, false
+	}
+	if !isSmallInt(pkScript[0]) || int(pkScript[1]) != len(pkScript)-2 {
+		return 0, nil, false
+	}
+	return asSmallInt(pkScript[0]), pkScript[2:], true
+}
+
+// IsWitnessCommitmentScript returns whether the passed script is the witness
+// commitment output of a coinbase transaction as defined by BIP0141, that is
+// OP_RETURN followed by a 36 byte push of the commitment header and the 32 byte
+// commitment.  Additional data may follow the push.
+func IsWitnessCommitmentScript(pkScript []byte) bool {
+	return len(pkScript) >= witnessCommitmentScriptLen &&
+		pkScript[0] == opReturn && pkScript[1] == opData36 &&
+		bytes.Equal(pkScript[2:6], witnessCommitmentHeader[:])
+}
+
+// isMultiSig returns true if the passed script is a multisig transaction,
+// false otherwise.
+func isMultiSig(ops []scriptOp) bool {
+	// The absolute minimum is 1 pubkey:
+	// OP_0/OP_1-16 <pubkey> OP_1 OP_CHECKMULTISIG
+	l := len(ops)
+	if l < 4 {
+		return false
+	}
+	if !isSmallInt(ops[0].opcode) || !isSmallInt(ops[l-2].opcode) ||
+		ops[l-1].opcode != opCheckMultiSig {
+		return false
+	}
+
+	// Verify the number of pubkeys specified matches the actual number
+	// of pubkeys provided.
+	if l-3 != asSmallInt(ops[l-2].opcode) {
+		return false
+	}
+	for _, op := range ops[1 : l-2] {
+		// Valid pubkeys are either 33 or 65 bytes.
+		if !isDataPush(op.opcode) ||
+			(len(op.data) != 33 && len(op.data) != 65) {
+
+			return false
+		}
+	}
+	return true
+}
+
+// IsBareMultisig returns whether the passed public key script is a bare
+// multi-signature script, that is one which isn't wrapped in a
+// pay-to-script-hash output.  Relay policy limits such outputs to small
+// numbers of keys.  See BareMultisigParams.
+func IsBareMultisig(pkScript []byte) bool {
+	_, _, ok := BareMultisigParams(pkScript)
+	return ok
+}
+
+// BareMultisigParams returns the number of required signatures, m, and the
+// number of public keys, n, of the passed bare multi-signature public key
+// script.  False is returned when it isn't a bare multi-signature script.
+func BareMultisigParams(pkScript []byte) (m, n int, ok bool) {
+	ops, err := parseScript(pkScript)
+	if err != nil || !isMultiSig(ops) {
+		return 0, 0, false
+	}
+	return asSmallInt(ops[0].opcode), asSmallInt(ops[len(ops)-2].opcode), true
+}
+
+// isNullData returns true if the passed script is a null data transaction,
+// false otherwise.
+func isNullData(ops []scriptOp) bool {
+	// A nulldata transaction is either a single OP_RETURN or an
+	// OP_RETURN SMALLDATA (where SMALLDATA is a data push up to
+	// maxDataCarrierSize bytes).
+	l := len(ops)
+	if l == 1 && ops[0].opcode == opReturn {
+		return true
+	}
+
+	return l == 2 &&
+		ops[0].opcode == opReturn &&
+		(isSmallInt(ops[1].opcode) || isDataPush(ops[1].opcode)) &&
+		len(ops[1].data) <= maxDataCarrierSize
+}
+
+// typeOfScript returns the type of the script being inspected from the known
+// standard types.
+func typeOfScript(script []byte, ops []scriptOp) ScriptClass {
+	switch {
+	case isWitnessPubKeyHashScript(script):
+		return WitnessV0PubKeyHashTy
+	case isWitnessScriptHash(script):
+		return WitnessV0ScriptHashTy
+	case isScriptHash(script):
+		return ScriptHashTy
+	case isPubKey(ops):
+		return PubKeyTy
+	case isPubKeyHash(ops):
+		return PubKeyHashTy
+	case isMultiSig(ops):
+		return MultiSigTy
+	case isNullData(ops):
+		return NullDataTy
+	}
+	return NonStandardTy
+}
+
+// ClassifyScript returns the class of the script passed.
+//
+// NonStandardTy will be returned when the script does not parse.
+func ClassifyScript(script []byte) ScriptClass {
+	ops, err := parseScript(script)
+	if err != nil {
+		return NonStandardTy
+	}
+	return typeOfScript(script, ops)
+}
+
+// extractPkScriptAddrs returns the type of script and the addresses associated
+// with the passed public key script.  Note that it only works for 'standard'
+// transaction script types.  Any data such as public keys which are invalid
+// are omitted from the results.  ErrMalformedScript is returned when the script
+// does not parse.
+func extractPkScriptAddrs(pkScript []byte, net *chaincfg.Params) (ScriptClass, []Address, error) {
+	ops, err := parseScript(pkScript)
+	if err != nil {
+		return NonStandardTy, nil, err
+	}
+
+	var addrs []Address
+	scriptClass := typeOfScript(pkScript, ops)
+	switch scriptClass {
+	case PubKeyHashTy:
+		// A pay-to-pubkey-hash script is of the form:
+		//  OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+		// Therefore the pubkey hash is the 3rd item on the stack.
+		addr, err := NewAddressPubKeyHash(ops[2].data, net)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+
+	case WitnessV0PubKeyHashTy:
+		// A pay-to-witness-pubkey-hash script is of the form:
+		//  OP_0 <20-byte hash>
+		// Therefore, the pubkey hash is the second item on the stack.
+		addr, err := NewAddressWitnessPubKeyHash(ops[1].data, net)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+
+	case PubKeyTy:
+		// A pay-to-pubkey script is of the form:
+		//  <pubkey> OP_CHECKSIG
+		// Therefore the pubkey is the first item on the stack.
+		addr, err := NewAddressPubKey(ops[0].data, net)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+
+	case ScriptHashTy:
+		// A pay-to-script-hash script is of the form:
+		//  OP_HASH160 <scripthash> OP_EQUAL
+		// Therefore the script hash is the 2nd item on the stack.
+		addr, err := NewAddressScriptHashFromHash(ops[1].data, net)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+
+	case WitnessV0ScriptHashTy:
+		// A pay-to-witness-script-hash script is of the form:
+		//  OP_0 <32-byte hash>
+		// Therefore, the script hash is the second item on the stack.
+		addr, err := NewAddressWitnessScriptHash(ops[1].data, net)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+
+	case MultiSigTy:
+		// A multi-signature script is of the form:
+		//  <numsigs> <pubkey> <pubkey> <pubkey>... <numpubkeys> OP_CHECKMULTISIG
+		// Therefore the pubkeys are the items between the counts.
+		for _, op := range ops[1 : len(ops)-2] {
+			addr, err := NewAddressPubKey(op.data, net)
+			if err == nil {
+				addrs = append(addrs, addr)
+			}
+		}
+
+	case NullDataTy:
+		// Null data transactions have no addresses.
+
+	case NonStandardTy:
+		// Don't attempt to extract addresses for nonstandard
+		// transactions.
+	}
+
+	return scriptClass, addrs, nil
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+)
+
+// Public key scripts of each standard type used throughout the tests.
+var (
+	p2pkhScript  = hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac")
+	p2wpkhScript = hexToBytes("00146edbc6c4d31bae9f1ccc38538a114bf42de65e86")
+	p2shScript   = hexToBytes("a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8687")
+	p2wshScript  = hexToBytes("00206edbc6c4d31bae9f1ccc38538a114bf42de65e86" +
+		"6edbc6c4d31bae9f1ccc3853")
+	p2pkScript = hexToBytes("210279be667ef9dcbbac55a06295ce870b07029bfcdb2d" +
+		"ce28d959f2815b16f81798ac")
+	multiSigScript = hexToBytes("51210279be667ef9dcbbac55a06295ce870b07029bfc" +
+		"db2dce28d959f2815b16f817982102c6047f9441ed7d6d3045406e95c07c" +
+		"d85c778e4b8cef3ca7abac09b95c709ee552ae")
+	nullDataScript = hexToBytes("6a04deadbeef")
+)
+
+// TestClassifyScript ensures public key scripts are classified as the expected
+// standard type.
+func TestClassifyScript(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		script []byte
+		class  btcutil.ScriptClass
+	}{
+		{"p2pkh", p2pkhScript, btcutil.PubKeyHashTy},
+		{"p2wpkh", p2wpkhScript, btcutil.WitnessV0PubKeyHashTy},
+		{"p2sh", p2shScript, btcutil.ScriptHashTy},
+		{"p2wsh", p2wshScript, btcutil.WitnessV0ScriptHashTy},
+		{"p2pk", p2pkScript, btcutil.PubKeyTy},
+		{"multisig", multiSigScript, btcutil.MultiSigTy},
+		{"nulldata", nullDataScript, btcutil.NullDataTy},
+		{"bare OP_RETURN", hexToBytes("6a"), btcutil.NullDataTy},
+		{"oversized nulldata", append(hexToBytes("6a4c51"),
+			make([]byte, 81)...), btcutil.NonStandardTy},
+		{"multisig count mismatch", hexToBytes("51210279be667ef9dcbbac55a0" +
+			"6295ce870b07029bfcdb2dce28d959f2815b16f8179852ae"),
+			btcutil.NonStandardTy},
+		{"multisig wrong key length", hexToBytes("51010251ae"),
+			btcutil.NonStandardTy},
+		{"OP_TRUE", hexToBytes("51"), btcutil.NonStandardTy},
+		{"empty", nil, btcutil.NonStandardTy},
+		{"malformed", hexToBytes("4c"), btcutil.NonStandardTy},
+	}
+
+	for _, test := range tests {
+		class := btcutil.ClassifyScript(test.script)
+		if class != test.class {
+			t.Errorf("%s: got class %v, want %v", test.name, class,
+				test.class)
+		}
+	}
+}
+
+// TestScriptClassStringer tests the stringized output for the ScriptClass
+// type.
+func TestScriptClassStringer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   btcutil.ScriptClass
+		want string
+	}{
+		{btcutil.NonStandardTy, "nonstandard"},
+		{btcutil.PubKeyTy, "pubkey"},
+		{btcutil.PubKeyHashTy, "pubkeyhash"},
+		{btcutil.WitnessV0PubKeyHashTy, "witness_v0_keyhash"},
+		{btcutil.ScriptHashTy, "scripthash"},
+		{btcutil.WitnessV0ScriptHashTy, "witness_v0_scripthash"},
+		{btcutil.MultiSigTy, "multisig"},
+		{btcutil.NullDataTy, "nulldata"},
+		{0xff, "Invalid"},
+	}
+
+	for _, test := range tests {
+		if got := test.in.String(); got != test.want {
+			t.Errorf("String: got %q, want %q", got, test.want)
+		}
+	}
+}
+
+// TestWitnessVersion ensures the version and program of witness program
+// scripts are extracted.
+func TestWitnessVersion(t *testing.T) {
+	t.Parallel()
+
+	// A taproot output from BIP341.
+	p2trScript := hexToBytes("512053a1f6e454df1aa2776a2814a721372d6258050" +
+		"de330b3c6d10ee8f4e0dda343")
+
+	tests := []struct {
+		name    string
+		script  []byte
+		version int
+		program []byte
+		ok      bool
+	}{
+		{"p2wpkh", p2wpkhScript, 0, p2wpkhScript[2:], true},
+		{"p2wsh", p2wshScript, 0, p2wshScript[2:], true},
+		{"taproot", p2trScript, 1, p2trScript[2:], true},
+		{"v16", hexToBytes("6002abcd"), 16, hexToBytes("abcd"), true},
+		{"p2pkh", p2pkhScript, 0, nil, false},
+		{"p2sh", p2shScript, 0, nil, false},
+		{"program too short", hexToBytes("0001ab"), 0, nil, false},
+		{"program too long", append([]byte{0x00, 0x29},
+			make([]byte, 41)...), 0, nil, false},
+		{"bad push length", hexToBytes("0014abcd"), 0, nil, false},
+		{"bad version", hexToBytes("4f02abcd"), 0, nil, false},
+	}
+
+	for _, test := range tests {
+		version, program, ok := btcutil.WitnessVersion(test.script)
+		if ok != test.ok || version != test.version ||
+			!bytes.Equal(program, test.program) {
+
+			t.Errorf("WitnessVersion #%s: got (%d, %x, %v), want "+
+				"(%d, %x, %v)", test.name, version, program, ok,
+				test.version, test.program, test.ok)
+		}
+	}
+}
+
+// TestIsWitnessCommitmentScript ensures coinbase witness commitment outputs
+// are detected.
+func TestIsWitnessCommitmentScript(t *testing.T) {
+	t.Parallel()
+
+	// A witness commitment output with an arbitrary commitment.
+	commitment := hexToBytes("6a24aa21a9ede2f61c3f71d1defd3fa999dfa36953755" +
+		"c690689799962b48bebd836974e8cf9")
+
+	tests := []struct {
+		name   string
+		script []byte
+		want   bool
+	}{
+		{"commitment", commitment, true},
+		{"commitment with extra data", append(commitment[:38:38], 0x00),
+			true},
+		{"wrong header", append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xee},
+			commitment[6:]...), false},
+		{"wrong push", append([]byte{0x6a, 0x23}, commitment[2:37]...),
+			false},
+		{"truncated", commitment[:37], false},
+		{"not op_return", append([]byte{0x00}, commitment[1:]...), false},
+		{"nulldata", nullDataScript, false},
+	}
+
+	for _, test := range tests {
+		got := btcutil.IsWitnessCommitmentScript(test.script)
+		if got != test.want {
+			t.Errorf("IsWitnessCommitmentScript #%s: got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestBareMultisigParams ensures bare multi-signature scripts are detected
+// along with their parameters.
+func TestBareMultisigParams(t *testing.T) {
+	t.Parallel()
+
+	// A 2-of-3 multi-signature script reusing the keys of the 1-of-2 one.
+	multiSig2of3 := append([]byte{0x52}, multiSigScript[1:len(multiSigScript)-2]...)
+	multiSig2of3 = append(multiSig2of3, multiSigScript[1:35]...)
+	multiSig2of3 = append(multiSig2of3, 0x53, 0xae)
+
+	tests := []struct {
+		name   string
+		script []byte
+		m, n   int
+		ok     bool
+	}{
+		{"1-of-2", multiSigScript, 1, 2, true},
+		{"2-of-3", multiSig2of3, 2, 3, true},
+		{"p2sh", p2shScript, 0, 0, false},
+		{"p2pkh", p2pkhScript, 0, 0, false},
+		{"truncated", multiSigScript[:len(multiSigScript)-1], 0, 0, false},
+		{"wrong key length", hexToBytes("51010251ae"), 0, 0, false},
+	}
+
+	for _, test := range tests {
+		m, n, ok := btcutil.BareMultisigParams(test.script)
+		if m != test.m || n != test.n || ok != test.ok {
+			t.Errorf("BareMultisigParams #%s: got (%d, %d, %v), want "+
+				"(%d, %d, %v)", test.name, m, n, ok, test.m, test.n,
+				test.ok)
+		}
+		if got := btcutil.IsBareMultisig(test.script); got != test.ok {
+			t.Errorf("IsBareMultisig #%s: got %v, want %v", test.name,
+				got, test.ok)
+		}
+	}
+}
+
+// TestScriptFingerprint ensures identical scripts share a fingerprint while
+// different scripts practically never do.
+func TestScriptFingerprint(t *testing.T) {
+	scripts := [][]byte{p2pkhScript, p2wpkhScript, p2shScript, p2wshScript,
+		p2pkScript, multiSigScript, nullDataScript, nil}
+
+	seen := make(map[[8]byte]int)
+	for i, script := range scripts {
+		fingerprint := btcutil.ScriptFingerprint(script)
+		copied := append([]byte(nil), script...)
+		if got := btcutil.ScriptFingerprint(copied); got != fingerprint {
+			t.Errorf("ScriptFingerprint #%d: got %x for copy, want %x",
+				i, got, fingerprint)
+		}
+		if j, ok := seen[fingerprint]; ok {
+			t.Errorf("ScriptFingerprint #%d: collides with #%d", i, j)
+		}
+		seen[fingerprint] = i
+	}
+
+	// Random scripts of typical sizes are far too few to collide by
+	// chance.
+	const numScripts = 10000
+	rng := rand.New(rand.NewSource(0))
+	fingerprints := make(map[[8]byte]struct{}, numScripts)
+	var collisions int
+	for i := 0; i < numScripts; i++ {
+		script := make([]byte, 22+rng.Intn(14))
+		rng.Read(script)
+		fingerprint := btcutil.ScriptFingerprint(script)
+		if _, ok := fingerprints[fingerprint]; ok {
+			collisions++
+		}
+		fingerprints[fingerprint] = struct{}{}
+	}
+	if collisions != 0 {
+		t.Errorf("ScriptFingerprint: got %d collisions over %d random "+
+			"scripts, want 0", collisions, numScripts)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrNoTxOutputs describes an error where a transaction is built without any
+// outputs, which is never valid.
+var ErrNoTxOutputs = errors.New("transaction has no outputs")
+
+// TxBuilder is a utility type that makes building transactions convenient.
+// Its methods return the builder itself so calls can be chained, for example:
+//
+//	tx, err := btcutil.NewTxBuilder().
+//		AddInput(prevOut, wire.MaxTxInSequenceNum).
+//		AddOutput(amount, pkScript).
+//		Build()
+type TxBuilder struct {
+	msgTx *wire.MsgTx
+}
+
+// NewTxBuilder returns a new builder for a transaction of the current version
+// which has no inputs or outputs and a lock time of zero.
+func NewTxBuilder() *TxBuilder {
+	return &TxBuilder{msgTx: wire.NewMsgTx(wire.TxVersion)}
+}
+
+// AddInput adds an input spending the passed outpoint with the given sequence
+// number.  Its signature script and witness are left empty to be filled in
+// when the transaction is signed.
+func (b *TxBuilder) AddInput(op wire.OutPoint, sequence uint32) *TxBuilder {
+	txIn := wire.NewTxIn(&op, nil, nil)
+	txIn.Sequence = sequence
+	b.msgTx.AddTxIn(txIn)
+	return b
+}
+
+// AddOutput adds an output paying the passed value to the given public key
+// script.
+func (b *TxBuilder) AddOutput(value int64, pkScript []byte) *TxBuilder {
+	b.msgTx.AddTxOut(wire.NewTxOut(value, pkScript))
+	return b
+}
+
+// SetLockTime sets the lock time of the transaction.
+func (b *TxBuilder) SetLockTime(lockTime uint32) *TxBuilder {
+	b.msgTx.LockTime = lockTime
+	return b
+}
+
+// Build returns the transaction built so far as a TxNew.  The builder may
+// continue to be used afterwards without affecting the returned transaction.
+// ErrNoTxOutputs is returned when no outputs have been added.
+func (b *TxBuilder) Build() (*TxNew, error) {
+	if len(b.msgTx.TxOut) == 0 {
+		return nil, ErrNoTxOutputs
+	}
+	return TxNewFromLegacy(b.msgTx)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestTxBuilder ensures transactions are built as specified.
+func TestTxBuilder(t *testing.T) {
+	prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 2}
+	pkScript1 := p2pkhScript
+	pkScript2 := p2wpkhScript
+
+	tx, err := btcutil.NewTxBuilder().
+		AddInput(prevOut, 0xfffffffe).
+		AddOutput(100000, pkScript1).
+		AddOutput(50000, pkScript2).
+		SetLockTime(500000).
+		Build()
+	if err != nil {
+		t.Fatalf("Build: unexpected error: %v", err)
+	}
+
+	// Ensure the serialization is of a version 1 transaction with the
+	// input and outputs in the order added.
+	var want bytes.Buffer
+	want.Write([]byte{0x01, 0x00, 0x00, 0x00}) // Version
+	want.WriteByte(0x01)                       // Input count
+	want.Write(prevOut.Hash[:])                // Previous hash
+	want.Write([]byte{0x02, 0x00, 0x00, 0x00}) // Previous index
+	want.WriteByte(0x00)                       // Signature script
+	want.Write([]byte{0xfe, 0xff, 0xff, 0xff}) // Sequence
+	want.WriteByte(0x02)                       // Output count
+	want.Write([]byte{0xa0, 0x86, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00})
+	want.WriteByte(byte(len(pkScript1)))
+	want.Write(pkScript1)
+	want.Write([]byte{0x50, 0xc3, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	want.WriteByte(byte(len(pkScript2)))
+	want.Write(pkScript2)
+	want.Write([]byte{0x20, 0xa1, 0x07, 0x00}) // Lock time
+
+	var got bytes.Buffer
+	if err := tx.MsgTx().Serialize(&got); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("Build: got serialization %x, want %x", got.Bytes(),
+			want.Bytes())
+	}
+	if tx.MsgTxNew() == nil {
+		t.Errorf("Build: unexpected nil MsgTxNew")
+	}
+
+	// Transactions without outputs are rejected.
+	_, err = btcutil.NewTxBuilder().AddInput(prevOut, 0).Build()
+	if err != btcutil.ErrNoTxOutputs {
+		t.Errorf("Build: got error %v, want %v", err,
+			btcutil.ErrNoTxOutputs)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// txCacheEntry is a transaction in a TxCache along with its hash.
+type txCacheEntry struct {
+	hash chainhash.Hash
+	tx   *TxNew
+}
+
+// TxCache caches wrapped transactions keyed by their hash, such as those seen
+// by relay or mempool components, so they can be reused along with their
+// memoized hashes and serialization.  When the cache is full, the least
+// recently used transaction is evicted to make room for a new one.
+//
+// It is safe for concurrent access.
+type TxCache struct {
+	mtx        sync.Mutex
+	txns       map[chainhash.Hash]*list.Element
+	lru        *list.List // Most recently used transaction at the front
+	maxEntries int
+}
+
+// NewTxCache returns a new transaction cache which holds up to maxEntries
+// transactions.  A maxEntries of zero disables caching.
+func NewTxCache(maxEntries int) *TxCache {
+	return &TxCache{
+		txns:       make(map[chainhash.Hash]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// Add adds the passed transaction to the cache as the most recently used one,
+// replacing any cached transaction with the same hash.
+func (c *TxCache) Add(tx *TxNew) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	hash := *tx.Hash()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e, ok := c.txns[hash]; ok {
+		e.Value.(*txCacheEntry).tx = tx
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	// Evict the least recently used transaction when the cache is full.
+	if c.lru.Len() >= c.maxEntries {
+		e := c.lru.Back()
+		delete(c.txns, e.Value.(*txCacheEntry).hash)
+		c.lru.Remove(e)
+	}
+	c.txns[hash] = c.lru.PushFront(&txCacheEntry{hash: hash, tx: tx})
+}
+
+// Get returns the cached transaction with the passed hash and marks it as the
+// most recently used one.  False is returned when it isn't cached.
+func (c *TxCache) Get(hash chainhash.Hash) (*TxNew, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.txns[hash]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*txCacheEntry).tx, true
+}
+
+// Len returns the number of transactions in the cache.
+func (c *TxCache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.lru.Len()
+}
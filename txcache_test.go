@@ -0,0 +1,109 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newCacheTestTxns returns n distinct wrapped transactions.
+func newCacheTestTxns(n int) []*btcutil.TxNew {
+	txns := make([]*btcutil.TxNew, n)
+	for i := range txns {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01},
+			Index: uint32(i)}
+		msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+		msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+		txns[i] = btcutil.TstNewTxNew(msgTx)
+	}
+	return txns
+}
+
+// TestTxCache ensures the least recently used transactions are evicted from
+// the cache.
+func TestTxCache(t *testing.T) {
+	t.Parallel()
+
+	txns := newCacheTestTxns(4)
+	cache := btcutil.NewTxCache(3)
+	for _, tx := range txns[:3] {
+		cache.Add(tx)
+	}
+
+	// Use the first transaction so the second one becomes the least
+	// recently used, which is then evicted by adding the fourth.
+	if got, ok := cache.Get(*txns[0].Hash()); !ok || got != txns[0] {
+		t.Fatalf("Get: got %p (%v), want %p", got, ok, txns[0])
+	}
+	cache.Add(txns[3])
+	if cache.Len() != 3 {
+		t.Errorf("Len: got %d, want 3", cache.Len())
+	}
+	if _, ok := cache.Get(*txns[1].Hash()); ok {
+		t.Errorf("Get: least recently used transaction not evicted")
+	}
+
+	// Re-adding a cached transaction marks it as used, so the third
+	// transaction is evicted next.
+	cache.Add(txns[0])
+	cache.Add(txns[1])
+	wantCached := []bool{true, true, false, true}
+	for i, tx := range txns {
+		got, ok := cache.Get(*tx.Hash())
+		if ok != wantCached[i] {
+			t.Errorf("Get #%d: got cached %v, want %v", i, ok,
+				wantCached[i])
+			continue
+		}
+		if ok && got != tx {
+			t.Errorf("Get #%d: got %p, want %p", i, got, tx)
+		}
+	}
+
+	// A zero size cache doesn't cache anything.
+	cache = btcutil.NewTxCache(0)
+	cache.Add(txns[0])
+	if _, ok := cache.Get(*txns[0].Hash()); ok || cache.Len() != 0 {
+		t.Errorf("Get: zero size cache returned a transaction")
+	}
+}
+
+// TestTxCacheConcurrent ensures the cache may be used concurrently.  It is
+// intended to be run with the race detector.
+func TestTxCacheConcurrent(t *testing.T) {
+	t.Parallel()
+
+	// The hashes of the transactions aren't cached up front, so they are
+	// generated by the concurrent adds.
+	txns := newCacheTestTxns(32)
+	cache := btcutil.NewTxCache(len(txns) / 2)
+
+	const workers = 8
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tx := txns[(w*7+i)%len(txns)]
+				cache.Add(tx)
+				if got, ok := cache.Get(*tx.Hash()); ok && got != tx {
+					t.Errorf("Get: got %p, want %p", got, tx)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if cache.Len() != len(txns)/2 {
+		t.Errorf("Len: got %d, want %d", cache.Len(), len(txns)/2)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+// TxMeta bundles a transaction with the bookkeeping information wallets
+// typically track for it, such as the fee it pays and how deeply it is
+// confirmed in the main chain.
+type TxMeta struct {
+	// Tx is the annotated transaction.
+	Tx *TxNew
+
+	// Fee is the fee paid by the transaction.
+	Fee Amount
+
+	// FeeDelta is the prioritization delta applied to the fee when
+	// ranking the transaction, such as for block templates.  See
+	// PrioritiseFee.
+	FeeDelta Amount
+
+	// Confirmations is the number of blocks confirming the transaction,
+	// including the block it is mined in.
+	Confirmations int32
+
+	// BlockHeight is the height of the block the transaction is mined in
+	// or BlockHeightUnknown if it is not mined yet.
+	BlockHeight int32
+}
+
+// FeeRate returns the fee rate paid by the transaction, computed as the fee
+// divided by its virtual size.
+func (m *TxMeta) FeeRate() FeeRate {
+	return NewFeeRate(m.Fee, m.Tx.VirtualSize())
+}
+
+// PrioritiseFee adds the passed delta, which may be negative, to the
+// prioritization delta of the transaction.  Like the prioritisetransaction RPC,
+// this only changes how the transaction is ranked, not the fee it pays, and
+// repeated calls accumulate.
+func (m *TxMeta) PrioritiseFee(delta Amount) {
+	m.FeeDelta += delta
+}
+
+// ModifiedFeeRate returns the fee rate of the transaction used to rank it,
+// computed as the fee adjusted by the prioritization delta divided by its
+// virtual size.  The rate is negative when a negative delta exceeds the fee.
+func (m *TxMeta) ModifiedFeeRate() FeeRate {
+	return NewFeeRate(m.Fee+m.FeeDelta, m.Tx.VirtualSize())
+}
+
+// NewTxMeta returns a new instance of a transaction annotation for the passed
+// transaction.  The annotation starts out unconfirmed with a zero fee.  See
+// TxMeta.
+func NewTxMeta(tx *TxNew) *TxMeta {
+	return &TxMeta{
+		Tx:          tx,
+		BlockHeight: BlockHeightUnknown,
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+)
+
+// TestTxMeta tests the API for TxMeta.
+func TestTxMeta(t *testing.T) {
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	meta := btcutil.NewTxMeta(tx)
+	if meta.Tx != tx {
+		t.Fatalf("NewTxMeta: mismatched transaction")
+	}
+	if meta.BlockHeight != btcutil.BlockHeightUnknown {
+		t.Errorf("NewTxMeta: got block height %d, want %d",
+			meta.BlockHeight, btcutil.BlockHeightUnknown)
+	}
+	if rate := meta.FeeRate(); rate != 0 {
+		t.Errorf("FeeRate: got %v for zero fee, want 0", rate)
+	}
+
+	// Paying exactly 1000 satoshi per virtual byte must yield a rate of
+	// one million satoshi per kvB.
+	vsize := tx.VirtualSize()
+	meta.Fee = btcutil.Amount(vsize * 1000)
+	if rate := meta.FeeRate(); rate != 1000000 {
+		t.Errorf("FeeRate: got %v, want %v", rate, btcutil.FeeRate(1000000))
+	}
+
+	// Fractional rates are truncated.
+	meta.Fee = 1
+	if rate, want := meta.FeeRate(), btcutil.FeeRate(1000/vsize); rate != want {
+		t.Errorf("FeeRate: got %v, want %v", rate, want)
+	}
+}
+
+// TestTxMetaModifiedFeeRate ensures prioritization deltas adjust the modified
+// fee rate without changing the fee rate.
+func TestTxMetaModifiedFeeRate(t *testing.T) {
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	vsize := tx.VirtualSize()
+	meta := btcutil.NewTxMeta(tx)
+	meta.Fee = btcutil.Amount(vsize * 10)
+	if rate := meta.ModifiedFeeRate(); rate != meta.FeeRate() {
+		t.Errorf("ModifiedFeeRate: got %v without delta, want %v", rate,
+			meta.FeeRate())
+	}
+
+	tests := []struct {
+		delta btcutil.Amount
+		want  btcutil.FeeRate
+	}{
+		// Raise the fee to 30 satoshi per virtual byte.
+		{btcutil.Amount(vsize * 20), 30000},
+
+		// Deltas accumulate, so lower it to 5 satoshi per virtual
+		// byte.
+		{btcutil.Amount(vsize * -25), 5000},
+
+		// The modified fee may become negative.
+		{btcutil.Amount(vsize * -10), -5000},
+	}
+
+	for _, test := range tests {
+		meta.PrioritiseFee(test.delta)
+		if rate := meta.ModifiedFeeRate(); rate != test.want {
+			t.Errorf("ModifiedFeeRate after delta %v: got %v, want "+
+				"%v", test.delta, rate, test.want)
+		}
+		if rate := meta.FeeRate(); rate != 10000 {
+			t.Errorf("FeeRate after delta %v: got %v, want 10000",
+				test.delta, rate)
+		}
+	}
+}
@@ -0,0 +1,902 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// WitnessScaleFactor determines the level of "discount" witness data receives
+// compared to "base" data.  It mirrors blockchain.WitnessScaleFactor, which
+// can't be referenced from here without creating an import cycle.
+const WitnessScaleFactor = 4
+
+// lockTimeThreshold is the number below which a lock time is interpreted to be
+// a block height rather than a Unix time.  It mirrors
+// txscript.LockTimeThreshold, which can't be referenced from here without
+// creating an import cycle.
+const lockTimeThreshold = 5e8 // Tue Nov 5 00:53:20 1985 UTC
+
+var (
+	// ErrNotCoinBase describes an error where a coinbase transaction is
+	// required but a different transaction was provided.
+	ErrNotCoinBase = errors.New("transaction is not a coinbase")
+
+	// ErrMalformedCoinbaseHeight describes an error where the signature
+	// script of a coinbase doesn't start with a minimally encoded block
+	// height as required by BIP0034.
+	ErrMalformedCoinbaseHeight = errors.New("malformed coinbase block " +
+		"height")
+
+	// ErrTrailingBytes describes an error where a serialized transaction
+	// is followed by additional bytes.
+	ErrTrailingBytes = errors.New("trailing bytes after transaction")
+
+	// ErrSpuriousWitness describes an error where a serialized
+	// transaction uses the witness encoding even though none of its
+	// inputs have witness data.
+	ErrSpuriousWitness = errors.New("witness encoding used for " +
+		"transaction without witness data")
+)
+
+// TxNew defines a bitcoin transaction in the new experimental format that
+// provides easier and more efficient manipulation of raw transactions.  Much
+// like Block does for wire.MsgBlockNew, it keeps the legacy wire.MsgTx form of
+// the transaction alongside the underlying wire.MsgTxNew so the usual
+// transaction helpers can be used on it.  It also memoizes the hashes for the
+// transaction on their first access so subsequent accesses don't have to
+// repeat the relatively expensive hashing operations.
+type TxNew struct {
+	msgTxNew      *wire.MsgTxNew  // Underlying MsgTxNew
+	msgTx         *wire.MsgTx     // Legacy form of the transaction
+	hashMtx       sync.Mutex      // Protects txHash
+	txHash        *chainhash.Hash // Cached transaction hash
+	txHashWitness *chainhash.Hash // Cached transaction witness hash
+	txHasWitness  *bool           // If the transaction has witness data
+	txIndex       int             // Position within a block or TxIndexUnknown
+	rawBytes      []byte          // Cached serialization of msgTx
+	serializeSize int             // Cached serialized size or 0
+
+	// hasher, when set, replaces double SHA-256 for the memoized hashes.
+	hasher func([]byte) chainhash.Hash
+}
+
+// MsgTxNew returns the underlying wire.MsgTxNew for the transaction.
+func (t *TxNew) MsgTxNew() *wire.MsgTxNew {
+	return t.msgTxNew
+}
+
+// MsgTx returns the legacy wire.MsgTx form of the transaction.
+func (t *TxNew) MsgTx() *wire.MsgTx {
+	return t.msgTx
+}
+
+// Bytes returns the serialized bytes of the transaction, including any witness
+// data.  This is equivalent to calling Serialize on the legacy wire.MsgTx,
+// however it caches the result so subsequent calls are more efficient.
+//
+// The cached bytes are held for as long as the transaction, roughly doubling
+// its memory footprint, which is worthwhile when the same transaction is
+// repeatedly serialized, such as when relaying it to many peers.  The returned
+// slice must not be modified.
+func (t *TxNew) Bytes() ([]byte, error) {
+	// Return the cached serialized bytes if they have already been
+	// generated.
+	if t.rawBytes != nil {
+		return t.rawBytes, nil
+	}
+
+	// Serialize the transaction.
+	w := bytes.NewBuffer(make([]byte, 0, t.msgTx.SerializeSize()))
+	err := t.msgTx.Serialize(w)
+	if err != nil {
+		return nil, err
+	}
+	rawBytes := w.Bytes()
+
+	// Cache the serialized bytes and return them.
+	t.rawBytes = rawBytes
+	return rawBytes, nil
+}
+
+// SerializeSizeCached returns the serialized size of the transaction,
+// including any witness data.  This is equivalent to calling SerializeSize on
+// the legacy wire.MsgTx, however it caches the result so subsequent calls are
+// more efficient.
+func (t *TxNew) SerializeSizeCached() int {
+	// Return the cached size if it has already been computed.
+	if t.serializeSize != 0 {
+		return t.serializeSize
+	}
+
+	// Cache the size and return it.
+	t.serializeSize = t.msgTx.SerializeSize()
+	return t.serializeSize
+}
+
+// InvalidateCache discards the cached serialized bytes, size, and hashes of
+// the transaction.  It must be called after modifying the transaction returned by
+// MsgTx so they are regenerated from the modified transaction.
+func (t *TxNew) InvalidateCache() {
+	t.rawBytes = nil
+	t.serializeSize = 0
+	t.hashMtx.Lock()
+	t.txHash = nil
+	t.hashMtx.Unlock()
+	t.txHashWitness = nil
+	t.txHasWitness = nil
+}
+
+// Hash returns the hash of the transaction.  This is equivalent to
+// calling TxHash on the legacy wire.MsgTx, however it caches the result so
+// subsequent calls are more efficient.
+//
+// It is safe for concurrent access, so a transaction may be hashed by several
+// goroutines, such as when it is added to a TxCache, even when its hash hasn't
+// been cached yet.
+func (t *TxNew) Hash() *chainhash.Hash {
+	t.hashMtx.Lock()
+	defer t.hashMtx.Unlock()
+
+	// Return the cached hash if it has already been generated.
+	if t.txHash != nil {
+		return t.txHash
+	}
+
+	// Cache the hash and return it.
+	var hash chainhash.Hash
+	if t.hasher != nil {
+		var buf bytes.Buffer
+		_ = t.msgTx.SerializeNoWitness(&buf)
+		hash = t.hasher(buf.Bytes())
+	} else {
+		hash = t.msgTx.TxHash()
+	}
+	t.txHash = &hash
+	return &hash
+}
+
+// WitnessHash returns the witness hash (wtxid) of the transaction.  This is
+// equivalent to calling WitnessHash on the legacy wire.MsgTx, however it
+// caches the result so subsequent calls are more efficient.
+func (t *TxNew) WitnessHash() *chainhash.Hash {
+	// Return the cached hash if it has already been generated.
+	if t.txHashWitness != nil {
+		return t.txHashWitness
+	}
+
+	// Transactions without witness data share the same hash for both.
+	if !t.HasWitness() {
+		t.txHashWitness = t.Hash()
+		return t.txHashWitness
+	}
+
+	// Cache the hash and return it.
+	var hash chainhash.Hash
+	if t.hasher != nil {
+		var buf bytes.Buffer
+		_ = t.msgTx.Serialize(&buf)
+		hash = t.hasher(buf.Bytes())
+	} else {
+		hash = t.msgTx.WitnessHash()
+	}
+	t.txHashWitness = &hash
+	return &hash
+}
+
+// Hashes returns both the hash (txid) and the witness hash (wtxid) of the
+// transaction, memoizing them as Hash and WitnessHash do.  Since they are
+// identical for transactions without witness data, the same hash is returned
+// for both in that case without hashing the transaction twice.
+func (t *TxNew) Hashes() (txid, wtxid *chainhash.Hash) {
+	return t.Hash(), t.WitnessHash()
+}
+
+// CacheKey returns the witness hash (wtxid) of the transaction by value so it
+// may be used directly as a map key.  Since the witness hash commits to all of
+// the serialized transaction, distinct transactions have distinct keys.
+func (t *TxNew) CacheKey() [32]byte {
+	return *t.WitnessHash()
+}
+
+// HasWitness returns false if none of the inputs within the transaction
+// contain witness data, true otherwise.  This is equivalent to calling
+// HasWitness on the legacy wire.MsgTx, however it caches the result so
+// subsequent calls are more efficient.
+func (t *TxNew) HasWitness() bool {
+	if t.txHasWitness != nil {
+		return *t.txHasWitness
+	}
+
+	hasWitness := t.msgTx.HasWitness()
+	t.txHasWitness = &hasWitness
+	return hasWitness
+}
+
+// IsCoinBase determines whether or not the transaction is a coinbase.  A
+// coinbase is a special transaction created by miners that has no inputs.  This
+// is represented in the block chain by a transaction with a single input that
+// has a previous output transaction index set to the maximum value along with a
+// zero hash.
+func (t *TxNew) IsCoinBase() bool {
+	// A coin base must only have one transaction input.
+	if len(t.msgTx.TxIn) != 1 {
+		return false
+	}
+
+	// The previous output of a coin base must have a max value index and
+	// a zero hash.
+	prevOut := &t.msgTx.TxIn[0].PreviousOutPoint
+	return prevOut.Index == wire.MaxPrevOutIndex &&
+		prevOut.Hash == chainhash.Hash{}
+}
+
+// ExtractCoinbaseHeight attempts to extract the height of the block from the
+// signature script of the coinbase transaction.  BIP0034 requires it to start
+// with the height pushed as a minimally encoded script number, meaning heights
+// up to 16 are pushed with a small integer opcode and larger ones with the
+// shortest data push of their little-endian encoding.  ErrNotCoinBase is
+// returned for other transactions and ErrMalformedCoinbaseHeight when the
+// height isn't encoded that way.
+func (t *TxNew) ExtractCoinbaseHeight() (int32, error) {
+	if !t.IsCoinBase() {
+		return 0, ErrNotCoinBase
+	}
+
+	sigScript := t.msgTx.TxIn[0].SignatureScript
+	if len(sigScript) < 1 {
+		return 0, ErrMalformedCoinbaseHeight
+	}
+
+	// Detect the case when the block height is a small integer encoded with
+	// a single byte.
+	opcode := sigScript[0]
+	if opcode == op0 {
+		return 0, nil
+	}
+	if opcode >= op1 && opcode <= op16 {
+		return int32(opcode - (op1 - 1)), nil
+	}
+
+	// Otherwise, the opcode must push the up to four bytes which encode the
+	// block height.
+	if opcode < opData1 || opcode > opData4 ||
+		len(sigScript[1:]) < int(opcode) {
+		return 0, ErrMalformedCoinbaseHeight
+	}
+	serializedHeight := sigScript[1 : opcode+1]
+
+	// The most significant byte may only be zero when it is needed for the
+	// sign bit, which must not be set since heights aren't negative.
+	msb := serializedHeight[len(serializedHeight)-1]
+	if msb&0x80 != 0 {
+		return 0, ErrMalformedCoinbaseHeight
+	}
+	if msb == 0 && (len(serializedHeight) == 1 ||
+		serializedHeight[len(serializedHeight)-2]&0x80 == 0) {
+		return 0, ErrMalformedCoinbaseHeight
+	}
+
+	var height int32
+	for i := len(serializedHeight) - 1; i >= 0; i-- {
+		height = height<<8 | int32(serializedHeight[i])
+	}
+
+	// Heights which fit a small integer opcode must use it.
+	if height <= 16 {
+		return 0, ErrMalformedCoinbaseHeight
+	}
+	return height, nil
+}
+
+// WitnessItems returns the witness stack of each input of the transaction.
+// The entry for an input without any witness data is nil.
+func (t *TxNew) WitnessItems() [][][]byte {
+	items := make([][][]byte, len(t.msgTx.TxIn))
+	for i, txIn := range t.msgTx.TxIn {
+		if len(txIn.Witness) == 0 {
+			continue
+		}
+		items[i] = txIn.Witness
+	}
+	return items
+}
+
+// PartitionOutputs splits the output indices of the transaction into those
+// paying to one of the owned scripts and those paying elsewhere.  The owned
+// set is keyed by the hex encoding of the public key scripts.
+func (t *TxNew) PartitionOutputs(ownScripts map[string]struct{}) (mine []int, theirs []int) {
+	for i, txOut := range t.msgTx.TxOut {
+		if _, ok := ownScripts[hex.EncodeToString(txOut.PkScript)]; ok {
+			mine = append(mine, i)
+			continue
+		}
+		theirs = append(theirs, i)
+	}
+	return mine, theirs
+}
+
+// BalanceDelta returns the net change the transaction makes to the balance of
+// the owned scripts, that is the value of its outputs paying to them less the
+// value of the outputs they own which it spends.  The owned set is keyed by the
+// hex encoding of the public key scripts, as for PartitionOutputs, and fetch
+// returns the output spent by an input.
+//
+// Whether an input is owned depends on the output it spends, so
+// ErrMissingTxOut is returned when any of them can't be fetched.  Coinbase
+// transactions don't spend any outputs.
+func (t *TxNew) BalanceDelta(ownScripts map[string]struct{},
+	fetch func(wire.OutPoint) (*wire.TxOut, bool)) (int64, error) {
+
+	var delta int64
+	if !t.IsCoinBase() {
+		for _, txIn := range t.msgTx.TxIn {
+			txOut, ok := fetch(txIn.PreviousOutPoint)
+			if !ok {
+				return 0, ErrMissingTxOut
+			}
+			_, owned := ownScripts[hex.EncodeToString(txOut.PkScript)]
+			if owned {
+				delta -= txOut.Value
+			}
+		}
+	}
+	for _, txOut := range t.msgTx.TxOut {
+		if _, ok := ownScripts[hex.EncodeToString(txOut.PkScript)]; ok {
+			delta += txOut.Value
+		}
+	}
+	return delta, nil
+}
+
+// UnsignedCopy returns a deep copy of the transaction with the signature
+// scripts and witnesses of all of its inputs cleared, that is its unsigned
+// form, such as for comparing transactions regardless of their signatures.
+// The copy starts without any of the cached hashes or serialization of the
+// transaction.
+func (t *TxNew) UnsignedCopy() *TxNew {
+	msgTx := t.msgTx.Copy()
+	for _, txIn := range msgTx.TxIn {
+		txIn.SignatureScript = nil
+		txIn.Witness = nil
+	}
+
+	tx := newTxNewFromMsgTx(msgTx)
+	tx.hasher = t.hasher
+	return tx
+}
+
+// SpendableOutputs returns the indices of the outputs of the transaction which
+// aren't provably unspendable, that is those which belong in the unspent
+// transaction output set.  See UtxoView.AddTxOuts.
+func (t *TxNew) SpendableOutputs() []int {
+	var spendable []int
+	for i, txOut := range t.msgTx.TxOut {
+		if !isUnspendable(txOut.PkScript) {
+			spendable = append(spendable, i)
+		}
+	}
+	return spendable
+}
+
+// BloomFilter is the interface of a BIP0037 bloom filter used to match the
+// data elements of transactions, such as bloom.Filter, which can't be
+// referenced from here without creating an import cycle.
+type BloomFilter interface {
+	// Matches returns whether the filter might contain the passed data.
+	Matches(data []byte) bool
+}
+
+// MatchesBloom returns the indices of the outputs of the transaction with a
+// data element pushed by their public key script which matches the passed
+// bloom filter.  These are the outputs whose outpoints a BIP0037 filter would
+// be updated with, so SPV servers can use it to determine which outputs a
+// client is interested in.  Outputs whose scripts don't parse never match.
+// The filter isn't updated.
+func (t *TxNew) MatchesBloom(f BloomFilter) []int {
+	var matched []int
+	for i, txOut := range t.msgTx.TxOut {
+		data, err := pushedData(txOut.PkScript)
+		if err != nil {
+			continue
+		}
+		for _, d := range data {
+			if f.Matches(d) {
+				matched = append(matched, i)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// OutputAddressStrings returns a string to display for each output of the
+// transaction, such as in a block explorer.  It is the encoded address paid by
+// the output on the passed network, "OP_RETURN" for null data outputs, or
+// "nonstandard" for outputs which don't pay to a single address, including
+// bare multi-signature outputs.
+func (t *TxNew) OutputAddressStrings(net *chaincfg.Params) []string {
+	strs := make([]string, len(t.msgTx.TxOut))
+	for i, txOut := range t.msgTx.TxOut {
+		class, addrs, _ := extractPkScriptAddrs(txOut.PkScript, net)
+		switch {
+		case class == NullDataTy:
+			strs[i] = "OP_RETURN"
+		case class != MultiSigTy && len(addrs) == 1:
+			strs[i] = addrs[0].EncodeAddress()
+		default:
+			strs[i] = "nonstandard"
+		}
+	}
+	return strs
+}
+
+// OutputsWithinCap returns whether the total value of the outputs of the
+// transaction is at most the passed cap, along with the total.  When the total
+// overflows an int64, false is returned along with math.MaxInt64.
+func (t *TxNew) OutputsWithinCap(cap int64) (bool, int64) {
+	var total int64
+	for _, txOut := range t.msgTx.TxOut {
+		if txOut.Value > 0 && total > math.MaxInt64-txOut.Value {
+			return false, math.MaxInt64
+		}
+		total += txOut.Value
+	}
+	return total <= cap, total
+}
+
+// UnspendableValue returns the total value of the outputs of the transaction
+// which are provably unspendable, such as OP_RETURN outputs or those whose
+// scripts exceed the maximum script size.  Since these outputs never enter the
+// unspent transaction output set, their value is effectively destroyed.
+func (t *TxNew) UnspendableValue() int64 {
+	var value int64
+	for _, txOut := range t.msgTx.TxOut {
+		if isUnspendable(txOut.PkScript) {
+			value += txOut.Value
+		}
+	}
+	return value
+}
+
+// Conflicts returns whether the transaction and the passed transaction spend
+// any of the same outputs, in which case at most one of them can be included
+// in the block chain.  Coinbase transactions don't spend any outputs, so they
+// never conflict.
+func (t *TxNew) Conflicts(other *TxNew) bool {
+	if t.IsCoinBase() || other.IsCoinBase() {
+		return false
+	}
+
+	spent := make(map[wire.OutPoint]struct{}, len(t.msgTx.TxIn))
+	for _, txIn := range t.msgTx.TxIn {
+		spent[txIn.PreviousOutPoint] = struct{}{}
+	}
+	for _, txIn := range other.msgTx.TxIn {
+		if _, ok := spent[txIn.PreviousOutPoint]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplacementKey returns a hash which identifies the set of outputs spent by
+// the transaction, regardless of the order of its inputs, their signatures, or
+// its outputs.  Replacements of a transaction which spend the same outputs,
+// such as to pay a higher fee, share the same key, so it may be used to track
+// the versions of a spend seen in the mempool.
+func (t *TxNew) ReplacementKey() chainhash.Hash {
+	outPoints := make([]wire.OutPoint, 0, len(t.msgTx.TxIn))
+	for _, txIn := range t.msgTx.TxIn {
+		outPoints = append(outPoints, txIn.PreviousOutPoint)
+	}
+	sortOutPoints(outPoints)
+
+	const outPointSize = chainhash.HashSize + 4
+	buf := make([]byte, len(outPoints)*outPointSize)
+	for i, outPoint := range outPoints {
+		offset := i * outPointSize
+		copy(buf[offset:], outPoint.Hash[:])
+		binary.LittleEndian.PutUint32(buf[offset+chainhash.HashSize:],
+			outPoint.Index)
+	}
+	return chainhash.DoubleHashH(buf)
+}
+
+// InputsSpendingTx returns the indices of the inputs of the transaction which
+// spend outputs of the transaction with the passed hash, such as when building
+// a graph of the dependencies between transactions.
+func (t *TxNew) InputsSpendingTx(txid chainhash.Hash) []int {
+	var indices []int
+	for i, txIn := range t.msgTx.TxIn {
+		if txIn.PreviousOutPoint.Hash == txid {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// Weight returns the weight of the transaction as defined by BIP141, that is
+// the stripped size scaled by the witness scale factor plus the size of the
+// witness data.
+func (t *TxNew) Weight() int64 {
+	baseSize := t.msgTx.SerializeSizeStripped()
+	totalSize := t.msgTx.SerializeSize()
+	return int64(baseSize*(WitnessScaleFactor-1) + totalSize)
+}
+
+// WeightBreakdown returns the weight of the transaction split into the weight
+// of its base data, that is its stripped size scaled by the witness scale
+// factor, and the weight of its witness data, including the marker and flag
+// bytes, which is not scaled.  The total weight, which is their sum, is also
+// returned.  See Weight.
+func (t *TxNew) WeightBreakdown() (baseWeight, witnessWeight, totalWeight int64) {
+	baseSize := t.msgTx.SerializeSizeStripped()
+	totalSize := t.msgTx.SerializeSize()
+	baseWeight = int64(baseSize * WitnessScaleFactor)
+	witnessWeight = int64(totalSize - baseSize)
+	return baseWeight, witnessWeight, baseWeight + witnessWeight
+}
+
+// ExceedsMaxSize returns whether the stripped size of the transaction, that is
+// its size without witness data, exceeds the passed maximum.  The consensus
+// rules limit transactions to the maximum base size of a block, which was
+// derived from the legacy 1MB block size limit.
+func (t *TxNew) ExceedsMaxSize(maxTxSize int) bool {
+	return t.msgTx.SerializeSizeStripped() > maxTxSize
+}
+
+// IsStandardVersion returns whether the version of the transaction is within
+// the range [1, maxVersion] considered standard by policy.  Transactions with
+// other versions may be valid but aren't relayed.
+func (t *TxNew) IsStandardVersion(maxVersion int32) bool {
+	version := t.msgTx.Version
+	return version >= 1 && version <= maxVersion
+}
+
+// IsFinalByMTP returns whether the transaction is final, and so may be
+// included, in a block at the passed height whose previous blocks have the
+// passed median time past, as returned by MedianTimePast.  Since BIP0113,
+// time-based lock times are evaluated against the median time past rather
+// than the timestamp of the block, which miners can set into the future.
+//
+// A transaction is final when its lock time is zero, is less than the height
+// or median time past it is compared to, or when all of its inputs have the
+// maximum sequence number, which disables the lock time.
+func (t *TxNew) IsFinalByMTP(height int32, mtp int64) bool {
+	msgTx := t.msgTx
+	lockTime := msgTx.LockTime
+	if lockTime == 0 {
+		return true
+	}
+
+	// The lock time is a block height when it's below the threshold and
+	// a Unix time otherwise.
+	blockTimeOrHeight := int64(height)
+	if lockTime >= lockTimeThreshold {
+		blockTimeOrHeight = mtp
+	}
+	if int64(lockTime) < blockTimeOrHeight {
+		return true
+	}
+
+	for _, txIn := range msgTx.TxIn {
+		if txIn.Sequence != wire.MaxTxInSequenceNum {
+			return false
+		}
+	}
+	return true
+}
+
+// ScriptSigSize returns the total serialized size of the signature scripts of
+// all inputs of the transaction, including their length prefixes.  Along with
+// the witness size, this allows the size of a transaction to be broken down
+// into legacy input data and witness data.
+func (t *TxNew) ScriptSigSize() int {
+	var size int
+	for _, txIn := range t.msgTx.TxIn {
+		sigScriptLen := len(txIn.SignatureScript)
+		size += wire.VarIntSerializeSize(uint64(sigScriptLen)) + sigScriptLen
+	}
+	return size
+}
+
+// HasNonPushOnlyScriptSig returns whether the signature script of any input of
+// the transaction contains an opcode other than data pushes and small
+// integers, or is malformed, which makes the transaction nonstandard.  The
+// signature script of a coinbase is arbitrary data, so it is never checked.
+func (t *TxNew) HasNonPushOnlyScriptSig() bool {
+	if t.IsCoinBase() {
+		return false
+	}
+	for _, txIn := range t.msgTx.TxIn {
+		if !isPushOnly(txIn.SignatureScript) {
+			return true
+		}
+	}
+	return false
+}
+
+// WitnessWeightSavings returns the number of weight units saved by the
+// witness discount, that is the difference between the weight of the witness
+// data, including the marker and flag bytes, if it were base data and its
+// actual weight.
+func (t *TxNew) WitnessWeightSavings() int64 {
+	witnessSize := t.msgTx.SerializeSize() - t.msgTx.SerializeSizeStripped()
+	return int64(witnessSize * (WitnessScaleFactor - 1))
+}
+
+// VirtualSize returns the virtual size of the transaction, which is its weight
+// divided by the witness scale factor and rounded up.
+func (t *TxNew) VirtualSize() int64 {
+	return (t.Weight() + (WitnessScaleFactor - 1)) / WitnessScaleFactor
+}
+
+// InvVect returns the inventory vector which announces the transaction.  It is
+// a witness transaction vector when the transaction has witness data.
+func (t *TxNew) InvVect() *wire.InvVect {
+	if t.HasWitness() {
+		return wire.NewInvVect(wire.InvTypeWitnessTx, t.Hash())
+	}
+	return wire.NewInvVect(wire.InvTypeTx, t.Hash())
+}
+
+// addWeight returns the sum of the passed non-negative weights, saturating at
+// math.MaxInt64 instead of overflowing.
+func addWeight(total, weight int64) int64 {
+	if weight > math.MaxInt64-total {
+		return math.MaxInt64
+	}
+	return total + weight
+}
+
+// TotalWeight returns the sum of the weights of the passed transactions, such
+// as for checking the limits of a block template or mempool package.  Rather
+// than overflowing, the result saturates at math.MaxInt64, which exceeds every
+// such limit.
+func TotalWeight(txs []*TxNew) int64 {
+	var total int64
+	for _, tx := range txs {
+		total = addWeight(total, tx.Weight())
+	}
+	return total
+}
+
+// DedupeTxNew returns the passed transactions with those whose hash (txid)
+// was already seen removed, keeping the first occurrence of each, such as for
+// cleaning up inventory lists before relaying them.  Transactions differing
+// only in their witness data share a txid, so only the first of them is kept.
+// The order of the remaining transactions is preserved.
+func DedupeTxNew(txs []*TxNew) []*TxNew {
+	seen := make(map[chainhash.Hash]struct{}, len(txs))
+	deduped := make([]*TxNew, 0, len(txs))
+	for _, tx := range txs {
+		hash := *tx.Hash()
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+		deduped = append(deduped, tx)
+	}
+	return deduped
+}
+
+// Index returns the saved index of the transaction within a block.  This value
+// will be TxIndexUnknown if it hasn't already explicitly been set.
+func (t *TxNew) Index() int {
+	return t.txIndex
+}
+
+// SetIndex sets the index of the transaction in within a block.
+func (t *TxNew) SetIndex(index int) {
+	t.txIndex = index
+}
+
+// NewTxNew returns a new instance of a bitcoin transaction given an
+// underlying wire.MsgTxNew.  See TxNew.
+func NewTxNew(msgTxNew *wire.MsgTxNew) *TxNew {
+	return &TxNew{
+		msgTxNew: msgTxNew,
+		msgTx:    msgTxNew.CreateMsgTx(),
+		txIndex:  TxIndexUnknown,
+	}
+}
+
+// NewTxNewWithHasher returns a new instance of a bitcoin transaction given an
+// underlying wire.MsgTxNew whose memoized hashes are computed by the passed
+// hasher over the serialized transaction instead of double SHA-256.  This is
+// mainly useful for regression testing and chains with alternative hashing.
+// See TxNew.
+func NewTxNewWithHasher(msgTxNew *wire.MsgTxNew, hasher func([]byte) chainhash.Hash) *TxNew {
+	t := NewTxNew(msgTxNew)
+	t.hasher = hasher
+	return t
+}
+
+// NewTxNewFromBytes returns a new instance of a bitcoin transaction given the
+// serialized bytes.  See TxNew.
+func NewTxNewFromBytes(serializedTx []byte) (*TxNew, error) {
+	br := bytes.NewReader(serializedTx)
+	return NewTxNewFromReader(br)
+}
+
+// NewTxFromBytesZeroCopy returns a new instance of a bitcoin transaction given
+// the serialized bytes without copying the scripts and witness items of the
+// legacy wire.MsgTx form of the transaction out of them.  Instead, they alias
+// the passed bytes.  The underlying wire.MsgTxNew is still decoded separately
+// and holds its own copies, so only the allocations of the legacy form are
+// saved, which is typically around a third of the bytes allocated by
+// NewTxNewFromBytes rather than most of them.
+//
+// NOTE: The caller MUST NOT modify the passed bytes for as long as the
+// returned transaction is in use.  See TxNew.
+func NewTxFromBytesZeroCopy(serializedTx []byte) (*TxNew, error) {
+	msgTx, err := decodeMsgTx(serializedTx)
+	if err != nil {
+		return nil, err
+	}
+	msgTxNew, err := decodeMsgTxNew(serializedTx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxNew{
+		msgTxNew: msgTxNew,
+		msgTx:    msgTx,
+		txIndex:  TxIndexUnknown,
+	}, nil
+}
+
+// NewTxFromBytesStrict returns a new instance of a bitcoin transaction given
+// the serialized bytes, which must be exactly one transaction in its canonical
+// encoding.  In addition to the checks done by NewTxNewFromBytes,
+// ErrTrailingBytes is returned when the transaction is followed by additional
+// bytes and ErrSpuriousWitness is returned when it uses the witness encoding
+// without any witness data.  The passed bytes are copied, so the caller is free
+// to modify them afterwards.  See TxNew.
+func NewTxFromBytesStrict(serializedTx []byte) (*TxNew, error) {
+	serializedTx = append([]byte(nil), serializedTx...)
+	d := txDecoder{buf: serializedTx}
+	msgTx, witnessEncoded, err := d.decodeMsgTx()
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(serializedTx) {
+		return nil, ErrTrailingBytes
+	}
+	if witnessEncoded && !msgTx.HasWitness() {
+		return nil, ErrSpuriousWitness
+	}
+	msgTxNew, err := decodeMsgTxNew(serializedTx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxNew{
+		msgTxNew: msgTxNew,
+		msgTx:    msgTx,
+		txIndex:  TxIndexUnknown,
+	}, nil
+}
+
+// decodeMsgTxNew returns the underlying wire.MsgTxNew of the passed serialized
+// transaction.
+func decodeMsgTxNew(serializedTx []byte) (*wire.MsgTxNew, error) {
+	var msgTxNew wire.MsgTxNew
+	err := msgTxNew.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, err
+	}
+	return &msgTxNew, nil
+}
+
+// NewTxNewFromReader returns a new instance of a bitcoin transaction given a
+// Reader to deserialize the transaction.  See TxNew.
+func NewTxNewFromReader(r io.Reader) (*TxNew, error) {
+	// Deserialize the bytes into a MsgTxNew.
+	var msgTxNew wire.MsgTxNew
+	err := msgTxNew.Deserialize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTxNew(&msgTxNew), nil
+}
+
+// NewTxFromHexReader returns a new instance of a bitcoin transaction given a
+// Reader of the hex encoding of the serialized transaction, such as a hex
+// dump being streamed by a tool.  Bytes which aren't valid hex result in a
+// hex.InvalidByteError.  See TxNew.
+func NewTxFromHexReader(r io.Reader) (*TxNew, error) {
+	return NewTxNewFromReader(hex.NewDecoder(r))
+}
+
+// ScanTxNewHexLines returns the transactions read from r, which holds the hex
+// encoding of one serialized transaction per line, such as a file of raw
+// transactions.  Surrounding whitespace and blank lines are ignored.  The
+// error for a line which can't be decoded names its line number.
+func ScanTxNewHexLines(r io.Reader) ([]*TxNew, error) {
+	// Allow lines as long as the hex encoding of the largest transaction
+	// which can fit in a block.
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, hex.EncodedLen(wire.MaxBlockPayload)+1)
+
+	var txns []*TxNew
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		serializedTx := make([]byte, hex.DecodedLen(len(line)))
+		if _, err := hex.Decode(serializedTx, line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		tx, err := NewTxNewFromBytes(serializedTx)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		txns = append(txns, tx)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return txns, nil
+}
+
+// newTxNewFromMsgTx returns a new transaction wrapping the passed legacy form
+// of it, which must not fail to serialize, along with the underlying
+// wire.MsgTxNew decoded from its serialization.  Transactions without inputs
+// can't be decoded from their serialization since it is ambiguous with the
+// witness encoding, so they are left without an underlying wire.MsgTxNew.
+func newTxNewFromMsgTx(msgTx *wire.MsgTx) *TxNew {
+	var buf bytes.Buffer
+	buf.Grow(msgTx.SerializeSize())
+	_ = msgTx.Serialize(&buf)
+	msgTxNew, _ := decodeMsgTxNew(buf.Bytes())
+
+	return &TxNew{
+		msgTxNew: msgTxNew,
+		msgTx:    msgTx,
+		txIndex:  TxIndexUnknown,
+	}
+}
+
+// TxNewFromLegacy returns a new instance of a bitcoin transaction given the
+// legacy wire.MsgTx form of it, that is the inverse of wire.MsgTxNew's
+// CreateMsgTx.  The witness data of the transaction is preserved, and an error
+// is returned if the converted transaction doesn't hash the same as the legacy
+// one.  See TxNew.
+func TxNewFromLegacy(msgTx *wire.MsgTx) (*TxNew, error) {
+	var buf bytes.Buffer
+	buf.Grow(msgTx.SerializeSize())
+	if err := msgTx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+
+	tx, err := NewTxNewFromBytes(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	wantHash := msgTx.TxHash()
+	if !tx.Hash().IsEqual(&wantHash) {
+		return nil, fmt.Errorf("converted transaction hash %v does not "+
+			"match legacy transaction hash %v", tx.Hash(), wantHash)
+	}
+	return tx, nil
+}
@@ -0,0 +1,1429 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/bloom"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestNewTxNewFromBytes tests creation of a TxNew from serialized bytes.
+func TestNewTxNewFromBytes(t *testing.T) {
+	// Serialize the test transaction.
+	testTx := Block100000.Transactions[0]
+	var testTxBuf bytes.Buffer
+	err := testTx.Serialize(&testTxBuf)
+	if err != nil {
+		t.Errorf("Serialize: %v", err)
+	}
+	testTxBytes := testTxBuf.Bytes()
+
+	// Create a new transaction from the serialized bytes.
+	tx, err := btcutil.NewTxNewFromBytes(testTxBytes)
+	if err != nil {
+		t.Errorf("NewTxNewFromBytes: %v", err)
+		return
+	}
+
+	// Ensure the legacy form of the transaction is correct.
+	if msgTx := tx.MsgTx(); !reflect.DeepEqual(msgTx, testTx) {
+		t.Errorf("MsgTx: mismatched MsgTx - got %v, want %v",
+			spew.Sdump(msgTx), spew.Sdump(testTx))
+	}
+	if tx.MsgTxNew() == nil {
+		t.Errorf("MsgTxNew: unexpected nil MsgTxNew")
+	}
+	if gotIndex := tx.Index(); gotIndex != btcutil.TxIndexUnknown {
+		t.Errorf("Index: mismatched index - got %v, want %v",
+			gotIndex, btcutil.TxIndexUnknown)
+	}
+
+	// Hash for block 100,000 transaction 0.
+	wantHashStr := "8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87"
+	wantHash, err := chainhash.NewHashFromStr(wantHashStr)
+	if err != nil {
+		t.Errorf("NewHashFromStr: %v", err)
+	}
+
+	// Request the hashes multiple times to test generation and caching.
+	for i := 0; i < 2; i++ {
+		hash := tx.Hash()
+		if !hash.IsEqual(wantHash) {
+			t.Errorf("Hash #%d mismatched hash - got %v, want %v", i,
+				hash, wantHash)
+		}
+		hash = tx.WitnessHash()
+		if !hash.IsEqual(wantHash) {
+			t.Errorf("WitnessHash #%d mismatched hash - got %v, "+
+				"want %v", i, hash, wantHash)
+		}
+		if tx.HasWitness() {
+			t.Errorf("HasWitness #%d: unexpected witness", i)
+		}
+	}
+
+	// A transaction without witness data weighs four times its size.
+	size := int64(len(testTxBytes))
+	if weight := tx.Weight(); weight != size*btcutil.WitnessScaleFactor {
+		t.Errorf("Weight: got %d, want %d", weight,
+			size*btcutil.WitnessScaleFactor)
+	}
+	if vsize := tx.VirtualSize(); vsize != size {
+		t.Errorf("VirtualSize: got %d, want %d", vsize, size)
+	}
+
+	// Truncate the transaction byte buffer to force errors.
+	_, err = btcutil.NewTxNewFromBytes(testTxBytes[:4])
+	if err != io.EOF {
+		t.Errorf("NewTxNewFromBytes: did not get expected error - "+
+			"got %v, want %v", err, io.EOF)
+	}
+}
+
+// newMixedWitnessMsgTx returns a transaction whose first input carries a
+// P2WPKH-style witness while its second input is a legacy spend.
+func newMixedWitnessMsgTx() *wire.MsgTx {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		Witness: wire.TxWitness{
+			bytes.Repeat([]byte{0x30}, 72),
+			bytes.Repeat([]byte{0x02}, 33),
+		},
+		Sequence: wire.MaxTxInSequenceNum,
+	})
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 1},
+		SignatureScript:  bytes.Repeat([]byte{0x51}, 107),
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	msgTx.AddTxOut(wire.NewTxOut(50000, append([]byte{0x00, 0x14},
+		bytes.Repeat([]byte{0xaa}, 20)...)))
+	return msgTx
+}
+
+// TestTxNewWitnessItems ensures the per-input witness stacks are reported.
+func TestTxNewWitnessItems(t *testing.T) {
+	msgTx := newMixedWitnessMsgTx()
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	items := tx.WitnessItems()
+	if len(items) != len(msgTx.TxIn) {
+		t.Fatalf("WitnessItems: got %d entries, want %d", len(items),
+			len(msgTx.TxIn))
+	}
+	want := [][]byte(msgTx.TxIn[0].Witness)
+	if !reflect.DeepEqual(items[0], want) {
+		t.Errorf("WitnessItems: mismatched witness for input 0 - "+
+			"got %v, want %v", spew.Sdump(items[0]), spew.Sdump(want))
+	}
+	if items[1] != nil {
+		t.Errorf("WitnessItems: expected nil witness for input 1, "+
+			"got %v", spew.Sdump(items[1]))
+	}
+}
+
+// TestTxNewPartitionOutputs ensures outputs are classified by ownership.
+func TestTxNewPartitionOutputs(t *testing.T) {
+	// Transaction 2 of block 100,000 has two outputs paying to different
+	// scripts.
+	msgTx := Block100000.Transactions[2]
+	tx := btcutil.TstNewTxNew(msgTx)
+	script0 := hex.EncodeToString(msgTx.TxOut[0].PkScript)
+	script1 := hex.EncodeToString(msgTx.TxOut[1].PkScript)
+
+	tests := []struct {
+		name       string
+		ownScripts map[string]struct{}
+		mine       []int
+		theirs     []int
+	}{
+		{
+			name: "all mine",
+			ownScripts: map[string]struct{}{
+				script0: {},
+				script1: {},
+			},
+			mine: []int{0, 1},
+		},
+		{
+			name:       "all theirs",
+			ownScripts: map[string]struct{}{},
+			theirs:     []int{0, 1},
+		},
+		{
+			name:       "mixed",
+			ownScripts: map[string]struct{}{script1: {}},
+			mine:       []int{1},
+			theirs:     []int{0},
+		},
+	}
+
+	for _, test := range tests {
+		mine, theirs := tx.PartitionOutputs(test.ownScripts)
+		if !reflect.DeepEqual(mine, test.mine) {
+			t.Errorf("PartitionOutputs #%s: mismatched mine - got %v, "+
+				"want %v", test.name, mine, test.mine)
+		}
+		if !reflect.DeepEqual(theirs, test.theirs) {
+			t.Errorf("PartitionOutputs #%s: mismatched theirs - got %v, "+
+				"want %v", test.name, theirs, test.theirs)
+		}
+	}
+}
+
+// TestTxNewBalanceDelta ensures the net change to the balance of owned scripts
+// is calculated from the outputs a transaction creates and spends.
+func TestTxNewBalanceDelta(t *testing.T) {
+	// Fund the owned P2WPKH script along with a foreign P2PKH script and
+	// spend them in various combinations.
+	funding := wire.NewMsgTx(wire.TxVersion)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		nil, nil))
+	funding.AddTxOut(wire.NewTxOut(50000, p2wpkhScript))
+	funding.AddTxOut(wire.NewTxOut(70000, p2pkhScript))
+	fundingHash := funding.TxHash()
+	ownOutPoint := wire.OutPoint{Hash: fundingHash, Index: 0}
+	foreignOutPoint := wire.OutPoint{Hash: fundingHash, Index: 1}
+	ownScripts := map[string]struct{}{
+		hex.EncodeToString(p2wpkhScript): {},
+	}
+	fetch := func(outPoint wire.OutPoint) (*wire.TxOut, bool) {
+		if outPoint.Hash != fundingHash ||
+			outPoint.Index >= uint32(len(funding.TxOut)) {
+			return nil, false
+		}
+		return funding.TxOut[outPoint.Index], true
+	}
+
+	receive := wire.NewMsgTx(wire.TxVersion)
+	receive.AddTxIn(wire.NewTxIn(&foreignOutPoint, nil, nil))
+	receive.AddTxOut(wire.NewTxOut(60000, p2wpkhScript))
+	receive.AddTxOut(wire.NewTxOut(9000, p2pkhScript))
+
+	send := wire.NewMsgTx(wire.TxVersion)
+	send.AddTxIn(wire.NewTxIn(&ownOutPoint, nil, nil))
+	send.AddTxOut(wire.NewTxOut(30000, p2pkhScript))
+	send.AddTxOut(wire.NewTxOut(19000, p2wpkhScript))
+
+	selfTransfer := wire.NewMsgTx(wire.TxVersion)
+	selfTransfer.AddTxIn(wire.NewTxIn(&ownOutPoint, nil, nil))
+	selfTransfer.AddTxOut(wire.NewTxOut(49000, p2wpkhScript))
+
+	missing := wire.NewMsgTx(wire.TxVersion)
+	missing.AddTxIn(wire.NewTxIn(&ownOutPoint, nil, nil))
+	missing.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: fundingHash,
+		Index: 2}, nil, nil))
+	missing.AddTxOut(wire.NewTxOut(1000, p2wpkhScript))
+
+	tests := []struct {
+		name  string
+		msgTx *wire.MsgTx
+		want  int64
+		err   error
+	}{
+		{"receive", receive, 60000, nil},
+		{"send", send, -31000, nil},
+		{"self transfer", selfTransfer, -1000, nil},
+		{"missing prevout", missing, 0, btcutil.ErrMissingTxOut},
+	}
+
+	for _, test := range tests {
+		tx := btcutil.TstNewTxNew(test.msgTx)
+		got, err := tx.BalanceDelta(ownScripts, fetch)
+		if err != test.err {
+			t.Errorf("BalanceDelta #%s: got error %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("BalanceDelta #%s: got %d, want %d", test.name,
+				got, test.want)
+		}
+	}
+}
+
+// TestTxNewHashes ensures both hashes of a transaction are returned and are
+// shared for transactions without witness data.
+func TestTxNewHashes(t *testing.T) {
+	msgTx := Block100000.Transactions[1]
+	txid, wtxid := btcutil.TstNewTxNew(msgTx).Hashes()
+	wantHash := msgTx.TxHash()
+	if !txid.IsEqual(&wantHash) {
+		t.Errorf("Hashes: got txid %v, want %v", txid, wantHash)
+	}
+	if wtxid != txid {
+		t.Errorf("Hashes: got distinct wtxid %v for transaction "+
+			"without witness", wtxid)
+	}
+
+	msgTx = newMixedWitnessMsgTx()
+	txid, wtxid = btcutil.TstNewTxNew(msgTx).Hashes()
+	wantHash = msgTx.TxHash()
+	wantWitnessHash := msgTx.WitnessHash()
+	if !txid.IsEqual(&wantHash) {
+		t.Errorf("Hashes: got txid %v, want %v", txid, wantHash)
+	}
+	if !wtxid.IsEqual(&wantWitnessHash) {
+		t.Errorf("Hashes: got wtxid %v, want %v", wtxid,
+			wantWitnessHash)
+	}
+	if txid.IsEqual(wtxid) {
+		t.Errorf("Hashes: got same txid and wtxid %v for witness "+
+			"transaction", txid)
+	}
+}
+
+// TestTxNewCacheKey ensures the cache key of a transaction is its witness
+// hash.
+func TestTxNewCacheKey(t *testing.T) {
+	for _, msgTx := range []*wire.MsgTx{Block100000.Transactions[1],
+		newMixedWitnessMsgTx()} {
+
+		tx := btcutil.TstNewTxNew(msgTx)
+		want := msgTx.WitnessHash()
+		if got := tx.CacheKey(); got != want {
+			t.Errorf("CacheKey: got %x, want %x", got, want)
+		}
+	}
+
+	// Transactions which only differ by witness have distinct keys.
+	witnessTx := newMixedWitnessMsgTx()
+	strippedTx := witnessTx.Copy()
+	for _, txIn := range strippedTx.TxIn {
+		txIn.Witness = nil
+	}
+	keys := map[[32]byte]struct{}{
+		btcutil.TstNewTxNew(witnessTx).CacheKey():  {},
+		btcutil.TstNewTxNew(strippedTx).CacheKey(): {},
+	}
+	if len(keys) != 2 {
+		t.Errorf("CacheKey: got %d distinct keys, want 2", len(keys))
+	}
+}
+
+// TestTxNewBytes ensures the serialized bytes of a transaction are cached
+// until the cache is invalidated.
+func TestTxNewBytes(t *testing.T) {
+	msgTx := newMixedWitnessMsgTx()
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	var want bytes.Buffer
+	if err := msgTx.Serialize(&want); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	first, err := tx.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	if !bytes.Equal(first, want.Bytes()) {
+		t.Errorf("Bytes: got %x, want %x", first, want.Bytes())
+	}
+
+	// The second call must return the same backing array.
+	second, err := tx.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	if &first[0] != &second[0] {
+		t.Errorf("Bytes: second call did not return the cached bytes")
+	}
+
+	// Modify the transaction and ensure the bytes and hashes reflect the
+	// modification once the cache is invalidated.
+	oldHash := *tx.Hash()
+	tx.MsgTx().LockTime = 500000
+	tx.InvalidateCache()
+	want.Reset()
+	if err := msgTx.Serialize(&want); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	third, err := tx.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	if !bytes.Equal(third, want.Bytes()) {
+		t.Errorf("Bytes: got %x after invalidation, want %x", third,
+			want.Bytes())
+	}
+	wantHash := msgTx.TxHash()
+	if tx.Hash().IsEqual(&oldHash) || !tx.Hash().IsEqual(&wantHash) {
+		t.Errorf("Hash: got %v after invalidation, want %v", tx.Hash(),
+			wantHash)
+	}
+}
+
+// TestTxNewUnsignedCopy ensures the unsigned copy of a transaction has empty
+// signature scripts and witnesses without modifying the original.
+func TestTxNewUnsignedCopy(t *testing.T) {
+	msgTx := newMixedWitnessMsgTx()
+	tx := btcutil.TstNewTxNew(msgTx)
+	signedHash := *tx.Hash()
+	signedWitnessHash := *tx.WitnessHash()
+
+	unsigned := tx.UnsignedCopy()
+	if unsigned.MsgTx() == msgTx {
+		t.Fatalf("UnsignedCopy: copy shares the original transaction")
+	}
+	for i, txIn := range unsigned.MsgTx().TxIn {
+		if len(txIn.SignatureScript) != 0 || len(txIn.Witness) != 0 {
+			t.Errorf("UnsignedCopy: input %d is not empty", i)
+		}
+	}
+	if unsigned.HasWitness() {
+		t.Errorf("UnsignedCopy: copy has witness")
+	}
+	if unsigned.MsgTxNew() == nil {
+		t.Errorf("UnsignedCopy: unexpected nil MsgTxNew")
+	}
+
+	// The hashes of the copy must be computed from the unsigned form.
+	wantHash := unsigned.MsgTx().TxHash()
+	if !unsigned.Hash().IsEqual(&wantHash) {
+		t.Errorf("UnsignedCopy: got hash %v, want %v", unsigned.Hash(),
+			wantHash)
+	}
+	if unsigned.Hash().IsEqual(&signedHash) {
+		t.Errorf("UnsignedCopy: hash matches the signed transaction")
+	}
+
+	// The original must be left unchanged.
+	if len(msgTx.TxIn[0].Witness) == 0 || len(msgTx.TxIn[1].SignatureScript) == 0 {
+		t.Errorf("UnsignedCopy: original transaction was modified")
+	}
+	if !tx.WitnessHash().IsEqual(&signedWitnessHash) {
+		t.Errorf("UnsignedCopy: original witness hash changed")
+	}
+}
+
+// TestTxNewSpendableOutputs ensures provably unspendable outputs are excluded
+// from the spendable outputs.
+func TestTxNewSpendableOutputs(t *testing.T) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	msgTx.AddTxOut(wire.NewTxOut(0, nullDataScript))
+	msgTx.AddTxOut(wire.NewTxOut(2000, p2wpkhScript))
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	want := []int{0, 2}
+	if got := tx.SpendableOutputs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SpendableOutputs: got %v, want %v", got, want)
+	}
+}
+
+// TestTxNewMatchesBloom ensures the outputs pushing data loaded into a bloom
+// filter are matched without updating the filter.
+func TestTxNewMatchesBloom(t *testing.T) {
+	// The P2PKH and P2WPKH scripts push the same public key hash, which
+	// is only a prefix of the script hash pushed by the P2WSH script.
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	msgTx.AddTxOut(wire.NewTxOut(2000, p2wshScript))
+	msgTx.AddTxOut(wire.NewTxOut(3000, p2wpkhScript))
+	msgTx.AddTxOut(wire.NewTxOut(0, nullDataScript))
+	msgTx.AddTxOut(wire.NewTxOut(4000, []byte{0x4c}))
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	f := bloom.NewFilter(10, 0, 0.000001, wire.BloomUpdateAll)
+	if got := tx.MatchesBloom(f); len(got) != 0 {
+		t.Errorf("MatchesBloom: got %v with empty filter, want none", got)
+	}
+
+	f.Add(p2wpkhScript[2:])
+	want := []int{0, 2}
+	if got := tx.MatchesBloom(f); !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchesBloom: got %v, want %v", got, want)
+	}
+	if f.MatchesOutPoint(wire.NewOutPoint(tx.Hash(), 0)) {
+		t.Errorf("MatchesBloom: filter updated with matched outpoint")
+	}
+}
+
+// TestTxNewOutputAddressStrings ensures the display strings of outputs are
+// their addresses or describe why they don't have one.
+func TestTxNewOutputAddressStrings(t *testing.T) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2wpkhScript))
+	msgTx.AddTxOut(wire.NewTxOut(0, nullDataScript))
+	msgTx.AddTxOut(wire.NewTxOut(2000, multiSigScript))
+	msgTx.AddTxOut(wire.NewTxOut(3000, p2pkhScript))
+	msgTx.AddTxOut(wire.NewTxOut(4000, []byte{0x51}))
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	want := []string{
+		"bc1qdmdud3xnrwhf78xv8pfc5y2t7sk7vh5xcsej79",
+		"OP_RETURN",
+		"nonstandard",
+		"1B7AcSJF7BrQsdYv7fCHsMiozLVCsUDMiY",
+		"nonstandard",
+	}
+	got := tx.OutputAddressStrings(&chaincfg.MainNetParams)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OutputAddressStrings: got %v, want %v", got, want)
+	}
+}
+
+// TestTxNewSerializeSizeCached ensures the serialized size of a transaction
+// is only computed once until the cache is invalidated.
+func TestTxNewSerializeSizeCached(t *testing.T) {
+	msgTx := newMixedWitnessMsgTx()
+	tx := btcutil.TstNewTxNew(msgTx)
+	size := msgTx.SerializeSize()
+	for i := 0; i < 2; i++ {
+		if got := tx.SerializeSizeCached(); got != size {
+			t.Errorf("SerializeSizeCached #%d: got %d, want %d", i,
+				got, size)
+		}
+	}
+
+	// Modify the transaction and ensure the cached size is returned until
+	// the cache is invalidated, after which it reflects the modification.
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	if got := tx.SerializeSizeCached(); got != size {
+		t.Errorf("SerializeSizeCached: got %d before invalidation, "+
+			"want cached %d", got, size)
+	}
+	tx.InvalidateCache()
+	if got, want := tx.SerializeSizeCached(), msgTx.SerializeSize(); got != want {
+		t.Errorf("SerializeSizeCached: got %d after invalidation, want %d",
+			got, want)
+	}
+}
+
+// TestTxNewOutputsWithinCap ensures the total output value of a transaction is
+// compared against a cap without overflowing.
+func TestTxNewOutputsWithinCap(t *testing.T) {
+	// Transaction 1 of block 100,000 pays 556000000 and 4444000000.
+	const total = 556000000 + 4444000000
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	tests := []struct {
+		cap  int64
+		want bool
+	}{
+		{total + 1, true},
+		{total, true},
+		{total - 1, false},
+		{btcutil.MaxSatoshi, true},
+	}
+	for _, test := range tests {
+		ok, got := tx.OutputsWithinCap(test.cap)
+		if ok != test.want || got != total {
+			t.Errorf("OutputsWithinCap(%d): got (%v, %d), want "+
+				"(%v, %d)", test.cap, ok, got, test.want, total)
+		}
+	}
+
+	// Totals which overflow are never within the cap.
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxOut(wire.NewTxOut(math.MaxInt64, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1, nil))
+	ok, got := btcutil.TstNewTxNew(msgTx).OutputsWithinCap(math.MaxInt64)
+	if ok || got != math.MaxInt64 {
+		t.Errorf("OutputsWithinCap: got (%v, %d) for overflowing "+
+			"outputs, want (false, %d)", ok, got,
+			int64(math.MaxInt64))
+	}
+}
+
+// TestTxNewUnspendableValue ensures the value of provably unspendable outputs
+// is totaled.
+func TestTxNewUnspendableValue(t *testing.T) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	msgTx.AddTxOut(wire.NewTxOut(500, nullDataScript))
+	msgTx.AddTxOut(wire.NewTxOut(2000, p2wpkhScript))
+	tx := btcutil.TstNewTxNew(msgTx)
+	if got := tx.UnspendableValue(); got != 500 {
+		t.Errorf("UnspendableValue: got %d, want 500", got)
+	}
+
+	// Outputs with scripts over the maximum script size are also
+	// unspendable, even when they would otherwise parse.
+	msgTx.AddTxOut(wire.NewTxOut(300, bytes.Repeat([]byte{0x51}, 10001)))
+	msgTx.AddTxOut(wire.NewTxOut(100, bytes.Repeat([]byte{0x51}, 10000)))
+	tx = btcutil.TstNewTxNew(msgTx)
+	if got := tx.UnspendableValue(); got != 800 {
+		t.Errorf("UnspendableValue: got %d, want 800", got)
+	}
+	want := []int{0, 2, 4}
+	if got := tx.SpendableOutputs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SpendableOutputs: got %v, want %v", got, want)
+	}
+}
+
+// TestTxNewConflicts ensures transactions spending a common output are
+// detected as conflicting.
+func TestTxNewConflicts(t *testing.T) {
+	// Transaction 1 of block 100,000 spends a single output.  Create a
+	// double spend of it which also spends another output, and a
+	// transaction which only spends the other output.
+	spend := Block100000.Transactions[1]
+	otherOutPoint := wire.OutPoint{Hash: spend.TxHash(), Index: 0}
+	doubleSpend := spend.Copy()
+	doubleSpend.TxOut[0].Value--
+	doubleSpend.AddTxIn(wire.NewTxIn(&otherOutPoint, nil, nil))
+	unrelated := wire.NewMsgTx(1)
+	unrelated.AddTxIn(wire.NewTxIn(&otherOutPoint, nil, nil))
+	unrelated.AddTxOut(wire.NewTxOut(1000, nil))
+
+	tests := []struct {
+		name string
+		a, b *wire.MsgTx
+		want bool
+	}{
+		{"double spend", spend, doubleSpend, true},
+		{"double spend of second input", doubleSpend, unrelated, true},
+		{"disjoint inputs", spend, unrelated, false},
+		{"different spends", spend, Block100000.Transactions[2], false},
+		{"coinbases", Block100000.Transactions[0],
+			Block100000.Transactions[0], false},
+	}
+
+	for _, test := range tests {
+		a := btcutil.TstNewTxNew(test.a)
+		b := btcutil.TstNewTxNew(test.b)
+		if got := a.Conflicts(b); got != test.want {
+			t.Errorf("Conflicts #%s: got %v, want %v", test.name,
+				got, test.want)
+		}
+		if got := b.Conflicts(a); got != test.want {
+			t.Errorf("Conflicts #%s (reversed): got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestTxNewReplacementKey ensures replacements spending the same outputs share
+// a replacement key while transactions spending other outputs don't.
+func TestTxNewReplacementKey(t *testing.T) {
+	// Create a replacement of the mixed witness transaction which pays a
+	// higher fee, has different signatures, and lists its inputs in the
+	// opposite order.
+	msgTx := newMixedWitnessMsgTx()
+	replacement := msgTx.Copy()
+	replacement.TxIn[0], replacement.TxIn[1] = replacement.TxIn[1],
+		replacement.TxIn[0]
+	replacement.TxIn[0].SignatureScript = nil
+	replacement.TxIn[1].Witness = wire.TxWitness{{0x01}}
+	replacement.TxOut[0].Value -= 1000
+
+	// Create a transaction which only spends one of the same outputs.
+	partial := msgTx.Copy()
+	partial.TxIn = partial.TxIn[:1]
+
+	key := btcutil.TstNewTxNew(msgTx).ReplacementKey()
+	replacementKey := btcutil.TstNewTxNew(replacement).ReplacementKey()
+	if key != replacementKey {
+		t.Errorf("ReplacementKey: replacement key %v differs from %v",
+			replacementKey, key)
+	}
+	partialKey := btcutil.TstNewTxNew(partial).ReplacementKey()
+	if partialKey == key {
+		t.Errorf("ReplacementKey: key for different inputs matches %v",
+			key)
+	}
+	otherKey := btcutil.TstNewTxNew(Block100000.Transactions[1]).
+		ReplacementKey()
+	if otherKey == key {
+		t.Errorf("ReplacementKey: key for different inputs matches %v",
+			key)
+	}
+}
+
+// TestTxNewInputsSpendingTx ensures the inputs spending the outputs of a given
+// transaction are found.
+func TestTxNewInputsSpendingTx(t *testing.T) {
+	parent := Block100000.Transactions[1].TxHash()
+	other := Block100000.Transactions[2].TxHash()
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: parent, Index: 0},
+		nil, nil))
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: other, Index: 0},
+		nil, nil))
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: parent, Index: 1},
+		nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	tests := []struct {
+		name string
+		txid chainhash.Hash
+		want []int
+	}{
+		{"two inputs", parent, []int{0, 2}},
+		{"one input", other, []int{1}},
+		{"no inputs", Block100000.Transactions[3].TxHash(), nil},
+	}
+
+	for _, test := range tests {
+		got := tx.InputsSpendingTx(test.txid)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("InputsSpendingTx #%s: got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestNewTxNewWithHasher ensures an injected hasher is used for the memoized
+// transaction hashes.
+func TestNewTxNewWithHasher(t *testing.T) {
+	testTx := Block100000.Transactions[0]
+	var testTxBuf bytes.Buffer
+	if err := testTx.Serialize(&testTxBuf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	tx, err := btcutil.NewTxNewFromBytes(testTxBuf.Bytes())
+	if err != nil {
+		t.Fatalf("NewTxNewFromBytes: %v", err)
+	}
+
+	// The identity-ish hasher simply copies the leading serialized bytes
+	// into the hash and counts its invocations.
+	var calls int
+	hasher := func(b []byte) chainhash.Hash {
+		calls++
+		var hash chainhash.Hash
+		copy(hash[:], b)
+		return hash
+	}
+	hashedTx := btcutil.NewTxNewWithHasher(tx.MsgTxNew(), hasher)
+
+	var want chainhash.Hash
+	copy(want[:], testTxBuf.Bytes())
+	for i := 0; i < 2; i++ {
+		if hash := hashedTx.Hash(); !hash.IsEqual(&want) {
+			t.Errorf("Hash #%d: mismatched hash - got %v, want %v", i,
+				hash, want)
+		}
+		if hash := hashedTx.WitnessHash(); !hash.IsEqual(&want) {
+			t.Errorf("WitnessHash #%d: mismatched hash - got %v, "+
+				"want %v", i, hash, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("hasher: got %d calls, want 1", calls)
+	}
+
+	// The default construction must keep using double SHA-256.
+	if hash, want := tx.Hash(), testTx.TxHash(); !hash.IsEqual(&want) {
+		t.Errorf("Hash: mismatched default hash - got %v, want %v",
+			hash, want)
+	}
+}
+
+// TestNewTxFromHexReader tests creation of a TxNew from a stream of hex.
+func TestNewTxFromHexReader(t *testing.T) {
+	testTx := Block100000.Transactions[1]
+	var testTxBuf bytes.Buffer
+	if err := testTx.Serialize(&testTxBuf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	hexTx := hex.EncodeToString(testTxBuf.Bytes())
+
+	tx, err := btcutil.NewTxFromHexReader(strings.NewReader(hexTx))
+	if err != nil {
+		t.Fatalf("NewTxFromHexReader: %v", err)
+	}
+	if hash, want := tx.Hash(), testTx.TxHash(); !hash.IsEqual(&want) {
+		t.Errorf("NewTxFromHexReader: mismatched hash - got %v, want %v",
+			hash, want)
+	}
+
+	// An odd number of hex characters can't be decoded.
+	oddHex := hexTx[:len(hexTx)/2+1]
+	if len(oddHex)%2 == 0 {
+		oddHex = oddHex[:len(oddHex)-1]
+	}
+	_, err = btcutil.NewTxFromHexReader(strings.NewReader(oddHex))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("NewTxFromHexReader: did not get expected error for "+
+			"odd length hex - got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// Non-hex characters must be reported as such.
+	_, err = btcutil.NewTxFromHexReader(strings.NewReader("01zz"))
+	if _, ok := err.(hex.InvalidByteError); !ok {
+		t.Errorf("NewTxFromHexReader: did not get expected "+
+			"InvalidByteError - got %v (%T)", err, err)
+	}
+}
+
+// TestScanTxNewHexLines ensures transactions are read from lines of hex and
+// malformed lines are reported by number.
+func TestScanTxNewHexLines(t *testing.T) {
+	var hexTxns []string
+	var wantHashes []chainhash.Hash
+	for _, msgTx := range []*wire.MsgTx{Block100000.Transactions[1],
+		newMixedWitnessMsgTx()} {
+
+		var buf bytes.Buffer
+		if err := msgTx.Serialize(&buf); err != nil {
+			t.Fatalf("Serialize: %v", err)
+		}
+		hexTxns = append(hexTxns, hex.EncodeToString(buf.Bytes()))
+		wantHashes = append(wantHashes, msgTx.TxHash())
+	}
+
+	// The transactions are separated by a blank line and the last one
+	// has trailing whitespace but no final newline.
+	input := hexTxns[0] + "\n\n  \n" + hexTxns[1] + " \r\n"
+	txns, err := btcutil.ScanTxNewHexLines(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ScanTxNewHexLines: unexpected error: %v", err)
+	}
+	if len(txns) != len(wantHashes) {
+		t.Fatalf("ScanTxNewHexLines: got %d transactions, want %d",
+			len(txns), len(wantHashes))
+	}
+	for i, tx := range txns {
+		if !tx.Hash().IsEqual(&wantHashes[i]) {
+			t.Errorf("ScanTxNewHexLines: got hash %v for transaction "+
+				"%d, want %v", tx.Hash(), i, wantHashes[i])
+		}
+	}
+
+	// Lines which aren't valid hex or transactions are reported by their
+	// line number.
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"bad hex", hexTxns[0] + "\n\n01zz\n", "line 3: "},
+		{"truncated", hexTxns[0] + "\n" + hexTxns[1][:20], "line 2: "},
+	}
+	for _, test := range tests {
+		_, err := btcutil.ScanTxNewHexLines(strings.NewReader(test.input))
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("ScanTxNewHexLines #%s: got error %v, want "+
+				"prefix %q", test.name, err, test.want)
+		}
+	}
+}
+
+// TestExtractCoinbaseHeight ensures the BIP0034 block height is extracted
+// from coinbase signature scripts and malformed encodings are rejected.
+func TestExtractCoinbaseHeight(t *testing.T) {
+	tests := []struct {
+		name      string
+		sigScript string
+		height    int32
+		err       error
+	}{
+		{
+			// From the coinbase of block 227836 on mainnet, the
+			// first block to enforce BIP0034.
+			name: "block 227836",
+			sigScript: "03fc7903062f503253482f0472d35454085fffed" +
+				"f2400000f90f54696d65202620486561" +
+				"6c7468202120",
+			height: 227836,
+		},
+		{name: "height 0", sigScript: "00", height: 0},
+		{name: "height 16", sigScript: "60", height: 16},
+		{name: "height 17", sigScript: "0111", height: 17},
+		{name: "sign byte needed", sigScript: "028000", height: 128},
+		{name: "empty", sigScript: "", err: btcutil.ErrMalformedCoinbaseHeight},
+		{name: "short push", sigScript: "03fc79", err: btcutil.ErrMalformedCoinbaseHeight},
+		{name: "non-minimal zero byte", sigScript: "03fc7900", err: btcutil.ErrMalformedCoinbaseHeight},
+		{name: "small int pushed as data", sigScript: "0105", err: btcutil.ErrMalformedCoinbaseHeight},
+		{name: "negative", sigScript: "0181", err: btcutil.ErrMalformedCoinbaseHeight},
+		{name: "too long", sigScript: "05fc79030000", err: btcutil.ErrMalformedCoinbaseHeight},
+		{name: "not a push", sigScript: "76", err: btcutil.ErrMalformedCoinbaseHeight},
+	}
+
+	for _, test := range tests {
+		sigScript, err := hex.DecodeString(test.sigScript)
+		if err != nil {
+			t.Fatalf("%s: invalid hex: %v", test.name, err)
+		}
+		msgTx := wire.NewMsgTx(1)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex), sigScript, nil))
+		msgTx.AddTxOut(wire.NewTxOut(2500000000, nil))
+
+		height, err := btcutil.TstNewTxNew(msgTx).ExtractCoinbaseHeight()
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.err)
+			continue
+		}
+		if height != test.height {
+			t.Errorf("%s: got height %d, want %d", test.name,
+				height, test.height)
+		}
+	}
+
+	// Only coinbase transactions have a block height.
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	if _, err := tx.ExtractCoinbaseHeight(); err != btcutil.ErrNotCoinBase {
+		t.Errorf("non-coinbase: got error %v, want %v", err,
+			btcutil.ErrNotCoinBase)
+	}
+}
+
+// aliases returns whether the passed slice shares its backing array with buf,
+// that is whether its first byte is one of the bytes of buf.
+func aliases(buf, b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+	for i := range buf {
+		if &buf[i] == &b[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// TestNewTxFromBytesZeroCopy ensures transactions decoded without copying
+// match those decoded normally and that their scripts and witness items alias
+// the serialized bytes.
+func TestNewTxFromBytesZeroCopy(t *testing.T) {
+	tests := []struct {
+		name  string
+		msgTx *wire.MsgTx
+	}{
+		{"coinbase", Block100000.Transactions[0]},
+		{"legacy", Block100000.Transactions[3]},
+		{"witness", newMixedWitnessMsgTx()},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.msgTx.Serialize(&buf); err != nil {
+			t.Fatalf("%s: Serialize: %v", test.name, err)
+		}
+		serialized := buf.Bytes()
+
+		tx, err := btcutil.NewTxFromBytesZeroCopy(serialized)
+		if err != nil {
+			t.Errorf("%s: NewTxFromBytesZeroCopy: %v", test.name, err)
+			continue
+		}
+
+		// Ensure the transaction hashes and reserializes the same.
+		wantHash := test.msgTx.TxHash()
+		if !tx.Hash().IsEqual(&wantHash) {
+			t.Errorf("%s: hash mismatch - got %v, want %v", test.name,
+				tx.Hash(), wantHash)
+		}
+		var got bytes.Buffer
+		if err := tx.MsgTx().Serialize(&got); err != nil {
+			t.Fatalf("%s: Serialize: %v", test.name, err)
+		}
+		if !bytes.Equal(got.Bytes(), serialized) {
+			t.Errorf("%s: serialized bytes mismatch - got %x, want %x",
+				test.name, got.Bytes(), serialized)
+		}
+
+		// Ensure the scripts and witness items alias the serialized
+		// bytes without being able to grow into the following bytes.
+		for i, txIn := range tx.MsgTx().TxIn {
+			script := txIn.SignatureScript
+			if !aliases(serialized, script) || cap(script) != len(script) {
+				t.Errorf("%s: input %d signature script is not "+
+					"a limited alias", test.name, i)
+			}
+			for j, item := range txIn.Witness {
+				if !aliases(serialized, item) || cap(item) != len(item) {
+					t.Errorf("%s: input %d witness item %d "+
+						"is not a limited alias", test.name,
+						i, j)
+				}
+			}
+		}
+		for i, txOut := range tx.MsgTx().TxOut {
+			if !aliases(serialized, txOut.PkScript) {
+				t.Errorf("%s: output %d public key script is not "+
+					"an alias", test.name, i)
+			}
+		}
+
+		// The new format transaction is decoded too.
+		if tx.MsgTxNew() == nil {
+			t.Errorf("%s: MsgTxNew: unexpected nil MsgTxNew", test.name)
+		}
+
+		// Every truncation of the transaction must be rejected.
+		for i := 0; i < len(serialized); i++ {
+			_, err := btcutil.NewTxFromBytesZeroCopy(serialized[:i])
+			if err != io.ErrUnexpectedEOF {
+				t.Errorf("%s: truncated to %d bytes - got error "+
+					"%v, want %v", test.name, i, err,
+					io.ErrUnexpectedEOF)
+				break
+			}
+		}
+	}
+
+	// Ensure a non-canonical varint for the input count is rejected.
+	_, err := btcutil.NewTxFromBytesZeroCopy([]byte{
+		0x01, 0x00, 0x00, 0x00, 0xfd, 0x01, 0x00,
+	})
+	if err == nil {
+		t.Errorf("NewTxFromBytesZeroCopy: unexpected success with " +
+			"non-canonical varint")
+	}
+}
+
+// TestNewTxFromBytesStrict ensures strict decoding rejects trailing bytes and
+// spurious witness encodings while accepting canonical transactions.
+func TestNewTxFromBytesStrict(t *testing.T) {
+	var legacy, witness bytes.Buffer
+	legacyTx := Block100000.Transactions[1]
+	if err := legacyTx.Serialize(&legacy); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if err := newMixedWitnessMsgTx().Serialize(&witness); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+
+	// Encode the legacy transaction with the witness marker and flag and
+	// an empty witness for its only input.
+	l := legacy.Bytes()
+	var spurious []byte
+	spurious = append(spurious, l[:4]...)
+	spurious = append(spurious, 0x00, 0x01)
+	spurious = append(spurious, l[4:len(l)-4]...)
+	spurious = append(spurious, 0x00)
+	spurious = append(spurious, l[len(l)-4:]...)
+
+	tests := []struct {
+		name       string
+		serialized []byte
+		err        error
+	}{
+		{"legacy", legacy.Bytes(), nil},
+		{"witness", witness.Bytes(), nil},
+		{"trailing bytes", append(legacy.Bytes()[:legacy.Len():legacy.Len()],
+			0x00), btcutil.ErrTrailingBytes},
+		{"spurious witness", spurious, btcutil.ErrSpuriousWitness},
+		{"truncated", legacy.Bytes()[:legacy.Len()-1], io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		tx, err := btcutil.NewTxFromBytesStrict(test.serialized)
+		if err != test.err {
+			t.Errorf("NewTxFromBytesStrict #%s: got error %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got, err := tx.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes: %v", err)
+		}
+		if !bytes.Equal(got, test.serialized) {
+			t.Errorf("NewTxFromBytesStrict #%s: got %x, want %x",
+				test.name, got, test.serialized)
+		}
+		if tx.MsgTxNew() == nil {
+			t.Errorf("NewTxFromBytesStrict #%s: unexpected nil "+
+				"MsgTxNew", test.name)
+		}
+	}
+}
+
+// serializedBenchTx returns the serialization of a transaction from the
+// Block100000 test fixture for benchmarking.
+func serializedBenchTx(b *testing.B) []byte {
+	var buf bytes.Buffer
+	if err := Block100000.Transactions[3].Serialize(&buf); err != nil {
+		b.Fatalf("Serialize: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// BenchmarkNewTxNewFromBytes benchmarks decoding a transaction by copying its
+// scripts.
+func BenchmarkNewTxNewFromBytes(b *testing.B) {
+	serialized := serializedBenchTx(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := btcutil.NewTxNewFromBytes(serialized); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNewTxFromBytesZeroCopy benchmarks decoding a transaction with its
+// scripts aliasing the serialized bytes.
+func BenchmarkNewTxFromBytesZeroCopy(b *testing.B) {
+	serialized := serializedBenchTx(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := btcutil.NewTxFromBytesZeroCopy(serialized); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestTxNewWitnessWeightSavings ensures the weight saved by the witness
+// discount is calculated correctly.
+func TestTxNewWitnessWeightSavings(t *testing.T) {
+	// The witness data of the P2WPKH input consists of the marker and flag
+	// bytes, the item counts of both inputs, and the length-prefixed
+	// signature and public key, for a total of 111 bytes.
+	tx := btcutil.TstNewTxNew(newMixedWitnessMsgTx())
+	if got := tx.WitnessWeightSavings(); got != 333 {
+		t.Errorf("WitnessWeightSavings: got %d, want 333", got)
+	}
+
+	// The savings account for the difference between the weight and the
+	// size when all data is base data.
+	fullWeight := int64(tx.MsgTx().SerializeSize() * btcutil.WitnessScaleFactor)
+	if got := fullWeight - tx.Weight(); got != tx.WitnessWeightSavings() {
+		t.Errorf("WitnessWeightSavings: got %d, want %d",
+			tx.WitnessWeightSavings(), got)
+	}
+
+	// Transactions without witness data don't save anything.
+	tx = btcutil.TstNewTxNew(Block100000.Transactions[1])
+	if got := tx.WitnessWeightSavings(); got != 0 {
+		t.Errorf("WitnessWeightSavings: got %d, want 0", got)
+	}
+}
+
+// TestTxNewWeightBreakdown ensures the weight of transactions is split into
+// the weights of their base and witness data.
+func TestTxNewWeightBreakdown(t *testing.T) {
+	// The witness data of the mixed transaction takes 111 bytes, as in
+	// TestTxNewWitnessWeightSavings, while its base data takes 4 weight
+	// units per byte.
+	msgTx := newMixedWitnessMsgTx()
+	tx := btcutil.TstNewTxNew(msgTx)
+	base, witness, total := tx.WeightBreakdown()
+	wantBase := int64(msgTx.SerializeSizeStripped() * 4)
+	if base != wantBase || witness != 111 || total != wantBase+111 {
+		t.Errorf("WeightBreakdown: got (%d, %d, %d), want (%d, 111, %d)",
+			base, witness, total, wantBase, wantBase+111)
+	}
+	if total != tx.Weight() {
+		t.Errorf("WeightBreakdown: got total %d, want weight %d", total,
+			tx.Weight())
+	}
+
+	// Transactions without witness data only have base data.
+	tx = btcutil.TstNewTxNew(Block100000.Transactions[1])
+	base, witness, total = tx.WeightBreakdown()
+	if base != tx.Weight() || witness != 0 || total != tx.Weight() {
+		t.Errorf("WeightBreakdown: got (%d, %d, %d), want (%d, 0, %d)",
+			base, witness, total, tx.Weight(), tx.Weight())
+	}
+}
+
+// TestTxNewIsStandardVersion ensures versions are only standard within the
+// allowed range.
+func TestTxNewIsStandardVersion(t *testing.T) {
+	tests := []struct {
+		version int32
+		want    bool
+	}{
+		{-1, false},
+		{0, false},
+		{1, true},
+		{2, true},
+		{3, false},
+	}
+
+	for _, test := range tests {
+		msgTx := Block100000.Transactions[1].Copy()
+		msgTx.Version = test.version
+		tx := btcutil.TstNewTxNew(msgTx)
+		if got := tx.IsStandardVersion(2); got != test.want {
+			t.Errorf("IsStandardVersion(2) for version %d: got %v, "+
+				"want %v", test.version, got, test.want)
+		}
+	}
+}
+
+// TestTxNewExceedsMaxSize ensures only the stripped size of a transaction is
+// compared against the maximum size.
+func TestTxNewExceedsMaxSize(t *testing.T) {
+	msgTx := newMixedWitnessMsgTx()
+	strippedSize := msgTx.SerializeSizeStripped()
+	tests := []struct {
+		name      string
+		maxTxSize int
+		want      bool
+	}{
+		{"under", strippedSize + 1, false},
+		{"equal", strippedSize, false},
+		{"over", strippedSize - 1, true},
+		{"witness excluded", msgTx.SerializeSize() - 1, false},
+	}
+
+	tx := btcutil.TstNewTxNew(msgTx)
+	for _, test := range tests {
+		if got := tx.ExceedsMaxSize(test.maxTxSize); got != test.want {
+			t.Errorf("ExceedsMaxSize #%s: got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestTxNewIsFinalByMTP ensures lock times are evaluated against the block
+// height or the median time past, not the block timestamp, and that inputs
+// with the maximum sequence number disable them.
+func TestTxNewIsFinalByMTP(t *testing.T) {
+	// The median time past of the block trails its timestamp, so a lock
+	// time between them is final by the timestamp but not yet by the
+	// median time past.
+	const (
+		height    = 500000
+		mtp       = 1500000000
+		timestamp = mtp + 3600
+		lockTime  = mtp + 1800
+	)
+	newTx := func(lockTime, sequence uint32) *btcutil.TxNew {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+			Sequence:         sequence,
+		})
+		msgTx.AddTxOut(wire.NewTxOut(1000, p2wpkhScript))
+		msgTx.LockTime = lockTime
+		return btcutil.TstNewTxNew(msgTx)
+	}
+	const seq = wire.MaxTxInSequenceNum - 1
+
+	tests := []struct {
+		name  string
+		tx    *btcutil.TxNew
+		mtp   int64
+		final bool
+	}{
+		{"no lock time", newTx(0, seq), mtp, true},
+		{"time before mtp", newTx(mtp-1, seq), mtp, true},
+		{"time equal to mtp", newTx(mtp, seq), mtp, false},
+		{"time between mtp and timestamp", newTx(lockTime, seq), mtp,
+			false},
+		{"time between mtp and timestamp by timestamp",
+			newTx(lockTime, seq), timestamp, true},
+		{"time after mtp with max sequence",
+			newTx(lockTime, wire.MaxTxInSequenceNum), mtp, true},
+		{"height before block", newTx(height-1, seq), mtp, true},
+		{"height of block", newTx(height, seq), mtp, false},
+		{"height ignores mtp", newTx(height-1, seq), 0, true},
+	}
+
+	for _, test := range tests {
+		got := test.tx.IsFinalByMTP(height, test.mtp)
+		if got != test.final {
+			t.Errorf("IsFinalByMTP #%s: got %v, want %v", test.name,
+				got, test.final)
+		}
+	}
+}
+
+// TestTxNewScriptSigSize ensures the size of the signature scripts of a
+// transaction is calculated correctly.
+func TestTxNewScriptSigSize(t *testing.T) {
+	// The P2WPKH input of the mixed transaction has an empty signature
+	// script, which takes only its length prefix, while the legacy input
+	// has a 107 byte signature script along with its prefix.
+	tx := btcutil.TstNewTxNew(newMixedWitnessMsgTx())
+	if got := tx.ScriptSigSize(); got != 1+1+107 {
+		t.Errorf("ScriptSigSize: got %d, want %d", got, 1+1+107)
+	}
+
+	// Transaction 1 of block 100,000 has a single 140 byte signature
+	// script.
+	tx = btcutil.TstNewTxNew(Block100000.Transactions[1])
+	if got := tx.ScriptSigSize(); got != 1+140 {
+		t.Errorf("ScriptSigSize: got %d, want %d", got, 1+140)
+	}
+}
+
+// TestTxNewHasNonPushOnlyScriptSig ensures signature scripts with operations
+// other than data pushes are detected.
+func TestTxNewHasNonPushOnlyScriptSig(t *testing.T) {
+	_, _, p2shSigScript := newP2SHMultiSig(bytes.Repeat([]byte{0x30}, 72))
+
+	tests := []struct {
+		name      string
+		sigScript []byte
+		want      bool
+	}{
+		{"empty", nil, false},
+		{"p2sh multisig", p2shSigScript, false},
+		{"small ints", []byte{0x00, 0x4f, 0x51, 0x60}, false},
+		{"pushdata", []byte{0x4c, 0x02, 0xaa, 0xbb}, false},
+		{"checksig", []byte{0x01, 0xaa, 0xac}, true},
+		{"nop", []byte{0x61}, true},
+		{"malformed", []byte{0x4c, 0x02, 0xaa}, true},
+	}
+
+	for _, test := range tests {
+		msgTx := newMixedWitnessMsgTx()
+		msgTx.TxIn[1].SignatureScript = test.sigScript
+		tx := btcutil.TstNewTxNew(msgTx)
+		if got := tx.HasNonPushOnlyScriptSig(); got != test.want {
+			t.Errorf("HasNonPushOnlyScriptSig #%s: got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+
+	// Coinbase signature scripts aren't checked.
+	coinbase := Block100000.Transactions[0].Copy()
+	coinbase.TxIn[0].SignatureScript = []byte{0xac}
+	tx := btcutil.TstNewTxNew(coinbase)
+	if tx.HasNonPushOnlyScriptSig() {
+		t.Errorf("HasNonPushOnlyScriptSig: got true for coinbase")
+	}
+	tx = btcutil.TstNewTxNew(Block100000.Transactions[1])
+	if tx.HasNonPushOnlyScriptSig() {
+		t.Errorf("HasNonPushOnlyScriptSig: got true for p2pkh spend")
+	}
+}
+
+// TestTxNewFromLegacy ensures converting legacy transactions to the new format
+// and back again preserves them exactly.
+func TestTxNewFromLegacy(t *testing.T) {
+	tests := []struct {
+		name  string
+		msgTx *wire.MsgTx
+	}{
+		{"coinbase", Block100000.Transactions[0]},
+		{"legacy", Block100000.Transactions[1]},
+		{"witness", newMixedWitnessMsgTx()},
+	}
+
+	for _, test := range tests {
+		tx, err := btcutil.TxNewFromLegacy(test.msgTx)
+		if err != nil {
+			t.Errorf("%s: TxNewFromLegacy: %v", test.name, err)
+			continue
+		}
+		if tx.MsgTxNew() == nil {
+			t.Errorf("%s: unexpected nil MsgTxNew", test.name)
+			continue
+		}
+
+		wantHash := test.msgTx.TxHash()
+		if !tx.Hash().IsEqual(&wantHash) {
+			t.Errorf("%s: got hash %v, want %v", test.name,
+				tx.Hash(), wantHash)
+		}
+		wantWitnessHash := test.msgTx.WitnessHash()
+		if !tx.WitnessHash().IsEqual(&wantWitnessHash) {
+			t.Errorf("%s: got witness hash %v, want %v", test.name,
+				tx.WitnessHash(), wantWitnessHash)
+		}
+
+		// Converting back to the legacy form must give identical
+		// bytes.
+		var want, got bytes.Buffer
+		if err := test.msgTx.Serialize(&want); err != nil {
+			t.Fatalf("%s: Serialize: %v", test.name, err)
+		}
+		if err := tx.MsgTxNew().CreateMsgTx().Serialize(&got); err != nil {
+			t.Fatalf("%s: Serialize: %v", test.name, err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%s: round trip mismatch - got %x, want %x",
+				test.name, got.Bytes(), want.Bytes())
+		}
+	}
+}
+
+// TestTotalWeight ensures the total weight of transactions is the sum of their
+// weights and saturates instead of overflowing.
+func TestTotalWeight(t *testing.T) {
+	txs := []*btcutil.TxNew{
+		btcutil.TstNewTxNew(Block100000.Transactions[0]),
+		btcutil.TstNewTxNew(Block100000.Transactions[1]),
+		btcutil.TstNewTxNew(newMixedWitnessMsgTx()),
+	}
+
+	var want int64
+	for _, tx := range txs {
+		want += tx.Weight()
+	}
+	if got := btcutil.TotalWeight(txs); got != want {
+		t.Errorf("TotalWeight: got %d, want %d", got, want)
+	}
+	if got := btcutil.TotalWeight(nil); got != 0 {
+		t.Errorf("TotalWeight: got %d for no transactions, want 0", got)
+	}
+
+	// Sums which would overflow saturate at the max int64.
+	tests := []struct {
+		total, weight, want int64
+	}{
+		{1000, 4000, 5000},
+		{math.MaxInt64 - 1, 1, math.MaxInt64},
+		{math.MaxInt64 - 1, 2, math.MaxInt64},
+		{math.MaxInt64, math.MaxInt64, math.MaxInt64},
+	}
+	for _, test := range tests {
+		got := btcutil.TstAddWeight(test.total, test.weight)
+		if got != test.want {
+			t.Errorf("addWeight(%d, %d): got %d, want %d", test.total,
+				test.weight, got, test.want)
+		}
+	}
+}
+
+// TestDedupeTxNew ensures transactions are deduplicated by txid, keeping the
+// first occurrence of each.
+func TestDedupeTxNew(t *testing.T) {
+	tx0 := btcutil.TstNewTxNew(Block100000.Transactions[0])
+	tx1 := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	tx2 := btcutil.TstNewTxNew(Block100000.Transactions[2])
+	tx1Dup := btcutil.TstNewTxNew(Block100000.Transactions[1].Copy())
+	tx0Dup := btcutil.TstNewTxNew(Block100000.Transactions[0].Copy())
+
+	txs := []*btcutil.TxNew{tx1, tx0, tx1Dup, tx2, tx0Dup, tx1}
+	got := btcutil.DedupeTxNew(txs)
+	want := []*btcutil.TxNew{tx1, tx0, tx2}
+	if len(got) != len(want) {
+		t.Fatalf("DedupeTxNew: got %d transactions, want %d", len(got),
+			len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("DedupeTxNew: transaction %d is %v, want %v", i,
+				got[i].Hash(), want[i].Hash())
+		}
+	}
+
+	// The passed slice must not be modified.
+	if txs[2] != tx1Dup || len(txs) != 6 {
+		t.Errorf("DedupeTxNew: modified the passed transactions")
+	}
+
+	if got := btcutil.DedupeTxNew(nil); len(got) != 0 {
+		t.Errorf("DedupeTxNew: got %d transactions for none, want 0",
+			len(got))
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ErrPackageCycle describes an error where the transactions of a package
+// spend each other in a cycle, which is impossible for valid transactions
+// since each one commits to the hashes of those it spends.
+var ErrPackageCycle = errors.New("transaction package contains a cycle")
+
+// ErrFeeCountMismatch describes an error where the number of fees passed
+// along with a set of transactions doesn't match the number of transactions.
+var ErrFeeCountMismatch = errors.New("number of fees does not match number " +
+	"of transactions")
+
+// BuildPackage returns all of the ancestors of the passed root transaction
+// which are in the pool, that is the transactions it spends, the transactions
+// those spend, and so on.  The pool is keyed by transaction hash, and inputs
+// spending transactions which aren't in it are assumed to be confirmed.
+//
+// The ancestors are ordered such that every transaction comes after all of the
+// transactions it spends, so they may be evaluated, for example for CPFP, or
+// connected in order.  The root itself is not included.  ErrPackageCycle is
+// returned when the transactions spend each other in a cycle.
+func BuildPackage(root *TxNew, pool map[chainhash.Hash]*TxNew) ([]*TxNew, error) {
+	// Perform a depth-first traversal of the in-pool parents, appending
+	// each transaction once all of its parents have been appended.
+	// Transactions which are still being visited are on the current path,
+	// so reaching one of them again means there is a cycle.
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[*TxNew]int)
+	var ancestors []*TxNew
+	var visit func(tx *TxNew) error
+	visit = func(tx *TxNew) error {
+		switch state[tx] {
+		case visiting:
+			return ErrPackageCycle
+		case visited:
+			return nil
+		}
+
+		state[tx] = visiting
+		for _, txIn := range tx.MsgTx().TxIn {
+			parent, ok := pool[txIn.PreviousOutPoint.Hash]
+			if !ok {
+				continue
+			}
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[tx] = visited
+
+		if tx != root {
+			ancestors = append(ancestors, tx)
+		}
+		return nil
+	}
+
+	if err := visit(root); err != nil {
+		return nil, err
+	}
+	return ancestors, nil
+}
+
+// sumFees returns the total fee paid by the passed transactions, which are
+// ordered such that each comes after those it spends.  The outputs they spend
+// are looked up in the overlay view, to which the outputs of each transaction
+// are added at the given height once it is processed, and then in the passed
+// view, which is not modified.
+func sumFees(txs []*TxNew, v, overlay *UtxoView, height int32) (int64, error) {
+	var totalFees int64
+	for _, tx := range txs {
+		var totalIn int64
+		for _, txIn := range tx.MsgTx().TxIn {
+			entry := overlay.LookupEntry(txIn.PreviousOutPoint)
+			if entry == nil {
+				entry = v.LookupEntry(txIn.PreviousOutPoint)
+			}
+			if entry == nil {
+				return 0, ErrMissingTxOut
+			}
+			totalIn += entry.Amount()
+		}
+
+		var totalOut int64
+		for _, txOut := range tx.MsgTx().TxOut {
+			totalOut += txOut.Value
+		}
+		if totalIn < totalOut {
+			return 0, ErrSpendTooHigh
+		}
+		totalFees += totalIn - totalOut
+
+		overlay.AddTxOuts(tx, height)
+	}
+	return totalFees, nil
+}
+
+// PackageFee returns the total fee paid by the passed package of transactions,
+// such as a parent and the child paying for it, along with their total virtual
+// size so the fee rate of the package can be computed as their quotient.  The
+// transactions must be ordered such that each comes after those it spends, as
+// returned by BuildPackage, and they are assumed to be mined at the given
+// height.
+//
+// Outputs spent by the package are looked up in the passed view, which is not
+// modified, unless they are created by the package itself.  Since each fee is
+// the difference between the inputs and outputs of a transaction, the value of
+// an output created and spent within the package cancels out, so it isn't
+// double counted.  ErrMissingTxOut is returned when a spent output can't be
+// found, and ErrSpendTooHigh when a transaction spends more than its inputs.
+func PackageFee(txs []*TxNew, v *UtxoView, height int32) (totalFee int64, totalVSize int64, err error) {
+	totalFee, err = sumFees(txs, v, NewUtxoView(), height)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, tx := range txs {
+		totalVSize += tx.VirtualSize()
+	}
+	return totalFee, totalVSize, nil
+}
+
+// PackGreedyByFeeRate selects transactions to fill a block template of the
+// passed maximum weight, where fees[i] is the fee paid by txs[i].  The
+// transactions are considered in descending order of their fee rate per unit
+// of weight, with ties broken by their position, and each one is selected if
+// it still fits, so smaller transactions may fill the space left by a larger
+// one which doesn't.  The indices of the selected transactions are returned in
+// the order they were selected along with their total fee.
+// ErrFeeCountMismatch is returned when there isn't exactly one fee per
+// transaction.
+//
+// Dependencies between the transactions aren't considered, so callers must
+// only pass transactions which may be included independently of each other.
+func PackGreedyByFeeRate(txs []*TxNew, fees []Amount, maxWeight int64) (selected []int, totalFee Amount, err error) {
+	if len(fees) != len(txs) {
+		return nil, 0, ErrFeeCountMismatch
+	}
+
+	weights := make([]int64, len(txs))
+	feeRates := make([]float64, len(txs))
+	order := make([]int, len(txs))
+	for i, tx := range txs {
+		weights[i] = tx.Weight()
+		feeRates[i] = float64(fees[i]) / float64(weights[i])
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return feeRates[order[i]] > feeRates[order[j]]
+	})
+
+	var totalWeight int64
+	for _, i := range order {
+		if weights[i] > maxWeight-totalWeight {
+			continue
+		}
+		totalWeight += weights[i]
+		totalFee += fees[i]
+		selected = append(selected, i)
+	}
+	return selected, totalFee, nil
+}
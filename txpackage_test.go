@@ -0,0 +1,223 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// spendMsgTx returns a transaction spending the first output of each of the
+// passed transactions.
+func spendMsgTx(parents ...*wire.MsgTx) *wire.MsgTx {
+	msgTx := wire.NewMsgTx(1)
+	for _, parent := range parents {
+		prevOut := wire.OutPoint{Hash: parent.TxHash()}
+		msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(1000, nil))
+	return msgTx
+}
+
+// TestBuildPackage ensures the in-pool ancestors of a transaction are
+// collected in topological order and cycles are rejected.
+func TestBuildPackage(t *testing.T) {
+	// Create three generations of transactions where the grandparent and
+	// one of the parents spend confirmed transactions, the other parent
+	// spends the grandparent, and the child spends both parents.
+	grandparent := spendMsgTx(Block100000.Transactions[1])
+	parent1 := spendMsgTx(grandparent)
+	parent2 := spendMsgTx(Block100000.Transactions[2])
+	child := spendMsgTx(parent2, parent1)
+	unrelated := spendMsgTx(Block100000.Transactions[3])
+
+	pool := make(map[chainhash.Hash]*btcutil.TxNew)
+	txns := make(map[*wire.MsgTx]*btcutil.TxNew)
+	for _, msgTx := range []*wire.MsgTx{grandparent, parent1, parent2,
+		child, unrelated} {
+
+		tx := btcutil.TstNewTxNew(msgTx)
+		pool[*tx.Hash()] = tx
+		txns[msgTx] = tx
+	}
+
+	tests := []struct {
+		name string
+		root *wire.MsgTx
+		want []*wire.MsgTx
+	}{
+		{"child", child, []*wire.MsgTx{parent2, grandparent, parent1}},
+		{"parent", parent1, []*wire.MsgTx{grandparent}},
+		{"no in-pool parents", grandparent, nil},
+	}
+
+	for _, test := range tests {
+		ancestors, err := btcutil.BuildPackage(txns[test.root], pool)
+		if err != nil {
+			t.Errorf("BuildPackage #%s: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		if len(ancestors) != len(test.want) {
+			t.Errorf("BuildPackage #%s: got %d ancestors, want %d",
+				test.name, len(ancestors), len(test.want))
+			continue
+		}
+		for i, tx := range ancestors {
+			if tx != txns[test.want[i]] {
+				t.Errorf("BuildPackage #%s: ancestor %d is %v, "+
+					"want %v", test.name, i, tx.Hash(),
+					test.want[i].TxHash())
+			}
+		}
+	}
+
+	// Valid transactions can't spend each other in a cycle, so key the
+	// pool by made up hashes which the transactions spend instead.
+	hash1 := chainhash.Hash{0x01}
+	hash2 := chainhash.Hash{0x02}
+	cycle1 := wire.NewMsgTx(1)
+	cycle1.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: hash2}, nil, nil))
+	cycle2 := wire.NewMsgTx(1)
+	cycle2.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: hash1}, nil, nil))
+	cycleTx1 := btcutil.TstNewTxNew(cycle1)
+	cyclicPool := map[chainhash.Hash]*btcutil.TxNew{
+		hash1:            cycleTx1,
+		hash2:            btcutil.TstNewTxNew(cycle2),
+		*cycleTx1.Hash(): cycleTx1,
+	}
+	root := btcutil.TstNewTxNew(spendMsgTx(cycle1))
+	_, err := btcutil.BuildPackage(root, cyclicPool)
+	if err != btcutil.ErrPackageCycle {
+		t.Errorf("BuildPackage: got error %v, want %v", err,
+			btcutil.ErrPackageCycle)
+	}
+}
+
+// TestPackageFee ensures the fee and size of a package are totaled without
+// double counting outputs spent within the package.
+func TestPackageFee(t *testing.T) {
+	// The parent spends a confirmed 10000 satoshi output and pays a fee
+	// of 100, and the child spends its output and pays a fee of 2000.
+	confirmed := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	parent := wire.NewMsgTx(wire.TxVersion)
+	parent.AddTxIn(wire.NewTxIn(&confirmed, nil, nil))
+	parent.AddTxOut(wire.NewTxOut(9900, p2pkhScript))
+	child := spendMsgTx(parent)
+	child.TxOut[0].Value = 7900
+	txs := []*btcutil.TxNew{
+		btcutil.TstNewTxNew(parent),
+		btcutil.TstNewTxNew(child),
+	}
+
+	view := btcutil.NewUtxoView()
+	view.AddEntry(confirmed, btcutil.NewUtxoEntry(
+		wire.NewTxOut(10000, p2pkhScript), 99000, false))
+	fee, vsize, err := btcutil.PackageFee(txs, view, 100000)
+	if err != nil {
+		t.Fatalf("PackageFee: unexpected error: %v", err)
+	}
+	if fee != 2100 {
+		t.Errorf("PackageFee: got fee %d, want 2100", fee)
+	}
+	wantVSize := txs[0].VirtualSize() + txs[1].VirtualSize()
+	if vsize != wantVSize {
+		t.Errorf("PackageFee: got vsize %d, want %d", vsize, wantVSize)
+	}
+	if entries := view.Entries(); len(entries) != 1 {
+		t.Errorf("PackageFee: view has %d entries, want 1", len(entries))
+	}
+
+	// The child can't be evaluated without its parent.
+	_, _, err = btcutil.PackageFee(txs[1:], view, 100000)
+	if err != btcutil.ErrMissingTxOut {
+		t.Errorf("PackageFee: got error %v, want %v", err,
+			btcutil.ErrMissingTxOut)
+	}
+}
+
+// TestPackGreedyByFeeRate ensures transactions are selected by descending fee
+// rate without exceeding the weight limit.
+func TestPackGreedyByFeeRate(t *testing.T) {
+	// Transactions spending more parents are heavier.  Their fees are set
+	// to pay the given rates per unit of weight.
+	parents := Block100000.Transactions[1:]
+	tests := []struct {
+		numParents int
+		feeRate    int64
+	}{
+		{1, 1},
+		{3, 5},
+		{1, 3},
+		{2, 2},
+	}
+	txns := make([]*btcutil.TxNew, len(tests))
+	fees := make([]btcutil.Amount, len(tests))
+	for i, test := range tests {
+		txns[i] = btcutil.TstNewTxNew(spendMsgTx(parents[:test.numParents]...))
+		fees[i] = btcutil.Amount(test.feeRate * txns[i].Weight())
+	}
+
+	// Only the three best paying transactions fit, however the one paying
+	// the second lowest rate is heavier than the room left after the two
+	// best paying ones, so the lightest one paying the lowest rate is
+	// selected instead.
+	maxWeight := txns[1].Weight() + txns[2].Weight() + txns[0].Weight()
+	selected, totalFee, err := btcutil.PackGreedyByFeeRate(txns, fees,
+		maxWeight)
+	if err != nil {
+		t.Fatalf("PackGreedyByFeeRate: unexpected error: %v", err)
+	}
+	wantSelected := []int{1, 2, 0}
+	if !reflect.DeepEqual(selected, wantSelected) {
+		t.Errorf("PackGreedyByFeeRate: got %v, want %v", selected,
+			wantSelected)
+	}
+	if want := fees[1] + fees[2] + fees[0]; totalFee != want {
+		t.Errorf("PackGreedyByFeeRate: got total fee %v, want %v",
+			totalFee, want)
+	}
+	var totalWeight int64
+	for _, i := range selected {
+		totalWeight += txns[i].Weight()
+	}
+	if totalWeight > maxWeight {
+		t.Errorf("PackGreedyByFeeRate: total weight %d exceeds %d",
+			totalWeight, maxWeight)
+	}
+
+	// Everything is selected in fee rate order when it all fits, and
+	// nothing is selected when nothing fits.
+	selected, _, err = btcutil.PackGreedyByFeeRate(txns, fees,
+		math.MaxInt64)
+	if err != nil {
+		t.Fatalf("PackGreedyByFeeRate: unexpected error: %v", err)
+	}
+	if want := []int{1, 2, 3, 0}; !reflect.DeepEqual(selected, want) {
+		t.Errorf("PackGreedyByFeeRate: got %v, want %v", selected, want)
+	}
+	selected, totalFee, err = btcutil.PackGreedyByFeeRate(txns, fees,
+		txns[0].Weight()-1)
+	if err != nil {
+		t.Fatalf("PackGreedyByFeeRate: unexpected error: %v", err)
+	}
+	if len(selected) != 0 || totalFee != 0 {
+		t.Errorf("PackGreedyByFeeRate: got %v paying %v, want none",
+			selected, totalFee)
+	}
+
+	// A fee must be passed for each transaction.
+	_, _, err = btcutil.PackGreedyByFeeRate(txns, fees[:len(fees)-1],
+		math.MaxInt64)
+	if err != btcutil.ErrFeeCountMismatch {
+		t.Errorf("PackGreedyByFeeRate: got error %v, want %v", err,
+			btcutil.ErrFeeCountMismatch)
+	}
+}
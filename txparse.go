@@ -0,0 +1,250 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// minTxInSize is the minimum size of a serialized transaction input,
+	// that is the previous outpoint, an empty signature script, and the
+	// sequence number.
+	minTxInSize = chainhash.HashSize + 4 + 1 + 4
+
+	// minTxOutSize is the minimum size of a serialized transaction output,
+	// that is the value and an empty public key script.
+	minTxOutSize = 8 + 1
+
+	// witnessFlag is the flag byte which follows the zero input count
+	// marker of the witness encoding of a transaction.
+	witnessFlag = 0x01
+)
+
+// txDecoder decodes a serialized transaction held in memory.  Rather than
+// copying them, the scripts and witness items of the decoded transaction alias
+// the serialized bytes.
+type txDecoder struct {
+	buf    []byte
+	offset int
+}
+
+// next returns the next n bytes of the buffer and advances past them.  The
+// returned slice has its capacity limited to its length, so appending to it
+// never overwrites the bytes which follow.
+func (d *txDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.offset) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	end := d.offset + int(n)
+	b := d.buf[d.offset:end:end]
+	d.offset = end
+	return b, nil
+}
+
+// readUint32 reads a little-endian uint32 from the buffer.
+func (d *txDecoder) readUint32() (uint32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// readVarInt reads a variable length integer from the buffer, rejecting
+// encodings which aren't canonical the same way wire.ReadVarInt does.
+func (d *txDecoder) readVarInt() (uint64, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	discriminant := b[0]
+	var rv, min uint64
+	switch discriminant {
+	case 0xff:
+		b, err = d.next(8)
+		if err != nil {
+			return 0, err
+		}
+		rv, min = binary.LittleEndian.Uint64(b), 0x100000000
+
+	case 0xfe:
+		b, err = d.next(4)
+		if err != nil {
+			return 0, err
+		}
+		rv, min = uint64(binary.LittleEndian.Uint32(b)), 0x10000
+
+	case 0xfd:
+		b, err = d.next(2)
+		if err != nil {
+			return 0, err
+		}
+		rv, min = uint64(binary.LittleEndian.Uint16(b)), 0xfd
+
+	default:
+		return uint64(discriminant), nil
+	}
+
+	// The encoding is not canonical if the value could have been encoded
+	// using fewer bytes.
+	if rv < min {
+		return 0, fmt.Errorf("non-canonical varint %x - discriminant "+
+			"%x must encode a value greater than %x", rv, discriminant,
+			min)
+	}
+	return rv, nil
+}
+
+// readCount reads a count of items, each of which takes at least minSize
+// bytes, and ensures they can fit in the rest of the buffer.  This prevents
+// huge allocations for counts in malformed transactions.
+func (d *txDecoder) readCount(minSize int) (uint64, error) {
+	count, err := d.readVarInt()
+	if err != nil {
+		return 0, err
+	}
+	if count > uint64((len(d.buf)-d.offset)/minSize) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return count, nil
+}
+
+// readVarBytes reads a variable length byte array from the buffer.
+func (d *txDecoder) readVarBytes() ([]byte, error) {
+	count, err := d.readVarInt()
+	if err != nil {
+		return nil, err
+	}
+	return d.next(count)
+}
+
+// decodeMsgTx decodes the passed serialized transaction, with or without
+// witness data, into a wire.MsgTx whose scripts and witness items alias the
+// serialized bytes.
+func decodeMsgTx(serializedTx []byte) (*wire.MsgTx, error) {
+	d := txDecoder{buf: serializedTx}
+	msgTx, _, err := d.decodeMsgTx()
+	return msgTx, err
+}
+
+// decodeMsgTx decodes a serialized transaction, with or without witness data,
+// from the buffer into a wire.MsgTx whose scripts and witness items alias the
+// buffer.  It also returns whether the transaction used the witness encoding,
+// which it may do even when none of its inputs have witness data.  The buffer
+// is left positioned after the transaction.
+func (d *txDecoder) decodeMsgTx() (*wire.MsgTx, bool, error) {
+	version, err := d.readUint32()
+	if err != nil {
+		return nil, false, err
+	}
+	msgTx := wire.NewMsgTx(int32(version))
+
+	// A count of zero inputs is the marker of the witness encoding, in
+	// which case it is followed by the flag and the real input count.
+	count, err := d.readCount(minTxInSize)
+	if err != nil {
+		return nil, false, err
+	}
+	var hasWitness bool
+	if count == 0 {
+		flag, err := d.next(1)
+		if err != nil {
+			return nil, false, err
+		}
+		if flag[0] != witnessFlag {
+			return nil, false, fmt.Errorf("witness tx but flag "+
+				"byte is %x", flag[0])
+		}
+		hasWitness = true
+
+		count, err = d.readCount(minTxInSize)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Deserialize the inputs.  A single backing array is used for all of
+	// them to reduce the number of allocations.
+	txIns := make([]wire.TxIn, count)
+	msgTx.TxIn = make([]*wire.TxIn, count)
+	for i := range txIns {
+		txIn := &txIns[i]
+		msgTx.TxIn[i] = txIn
+
+		hash, err := d.next(chainhash.HashSize)
+		if err != nil {
+			return nil, false, err
+		}
+		copy(txIn.PreviousOutPoint.Hash[:], hash)
+		txIn.PreviousOutPoint.Index, err = d.readUint32()
+		if err != nil {
+			return nil, false, err
+		}
+		txIn.SignatureScript, err = d.readVarBytes()
+		if err != nil {
+			return nil, false, err
+		}
+		txIn.Sequence, err = d.readUint32()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Deserialize the outputs.
+	count, err = d.readCount(minTxOutSize)
+	if err != nil {
+		return nil, false, err
+	}
+	txOuts := make([]wire.TxOut, count)
+	msgTx.TxOut = make([]*wire.TxOut, count)
+	for i := range txOuts {
+		txOut := &txOuts[i]
+		msgTx.TxOut[i] = txOut
+
+		value, err := d.next(8)
+		if err != nil {
+			return nil, false, err
+		}
+		txOut.Value = int64(binary.LittleEndian.Uint64(value))
+		txOut.PkScript, err = d.readVarBytes()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Deserialize the witness of each input.
+	if hasWitness {
+		for _, txIn := range msgTx.TxIn {
+			witCount, err := d.readCount(1)
+			if err != nil {
+				return nil, false, err
+			}
+			if witCount == 0 {
+				continue
+			}
+
+			txIn.Witness = make(wire.TxWitness, witCount)
+			for j := range txIn.Witness {
+				txIn.Witness[j], err = d.readVarBytes()
+				if err != nil {
+					return nil, false, err
+				}
+			}
+		}
+	}
+
+	msgTx.LockTime, err = d.readUint32()
+	if err != nil {
+		return nil, false, err
+	}
+	return msgTx, hasWitness, nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+// maxFewTxInOuts is the maximum number of inputs or outputs a transaction may
+// have for them to be considered few when classifying its shape.
+const maxFewTxInOuts = 2
+
+// TxShape is an enumeration of the shapes of transactions, as determined by
+// their numbers of inputs and outputs.
+type TxShape byte
+
+// Shapes of transactions.
+const (
+	ShapeSimple        TxShape = iota // Few inputs and few outputs.
+	ShapeConsolidation                // Many inputs and few outputs.
+	ShapeBatch                        // Few inputs and many outputs.
+	ShapeComplex                      // Many inputs and many outputs.
+)
+
+// txShapeToName houses the human-readable strings which describe each
+// transaction shape.
+var txShapeToName = []string{
+	ShapeSimple:        "simple",
+	ShapeConsolidation: "consolidation",
+	ShapeBatch:         "batch",
+	ShapeComplex:       "complex",
+}
+
+// String implements the Stringer interface by returning the name of the enum
+// transaction shape.  If the enum is invalid then "Invalid" will be returned.
+func (s TxShape) String() string {
+	if int(s) >= len(txShapeToName) {
+		return "Invalid"
+	}
+	return txShapeToName[s]
+}
+
+// Shape returns the shape of the transaction.  Transactions with one or two
+// inputs and outputs are simple, those with more inputs only are
+// consolidations, those with more outputs only are batches, and those with
+// more of both are complex.
+func (t *TxNew) Shape() TxShape {
+	fewIn := len(t.msgTx.TxIn) <= maxFewTxInOuts
+	fewOut := len(t.msgTx.TxOut) <= maxFewTxInOuts
+	switch {
+	case fewIn && fewOut:
+		return ShapeSimple
+	case fewOut:
+		return ShapeConsolidation
+	case fewIn:
+		return ShapeBatch
+	}
+	return ShapeComplex
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestTxNewShape ensures transactions are classified by their numbers of
+// inputs and outputs.
+func TestTxNewShape(t *testing.T) {
+	tests := []struct {
+		numIn, numOut int
+		want          btcutil.TxShape
+	}{
+		{1, 1, btcutil.ShapeSimple},
+		{1, 2, btcutil.ShapeSimple},
+		{2, 2, btcutil.ShapeSimple},
+		{3, 1, btcutil.ShapeConsolidation},
+		{50, 2, btcutil.ShapeConsolidation},
+		{1, 3, btcutil.ShapeBatch},
+		{2, 100, btcutil.ShapeBatch},
+		{3, 3, btcutil.ShapeComplex},
+		{20, 30, btcutil.ShapeComplex},
+	}
+
+	for _, test := range tests {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		for i := 0; i < test.numIn; i++ {
+			prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01},
+				Index: uint32(i)}
+			msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+		}
+		for i := 0; i < test.numOut; i++ {
+			msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+		}
+
+		got := btcutil.TstNewTxNew(msgTx).Shape()
+		if got != test.want {
+			t.Errorf("Shape for %d inputs and %d outputs: got %v, "+
+				"want %v", test.numIn, test.numOut, got,
+				test.want)
+		}
+	}
+}
+
+// TestTxShapeStringer tests the stringized output for the TxShape type.
+func TestTxShapeStringer(t *testing.T) {
+	tests := []struct {
+		in   btcutil.TxShape
+		want string
+	}{
+		{btcutil.ShapeSimple, "simple"},
+		{btcutil.ShapeConsolidation, "consolidation"},
+		{btcutil.ShapeBatch, "batch"},
+		{btcutil.ShapeComplex, "complex"},
+		{0xff, "Invalid"},
+	}
+
+	for _, test := range tests {
+		if got := test.in.String(); got != test.want {
+			t.Errorf("String: got %q, want %q", got, test.want)
+		}
+	}
+}
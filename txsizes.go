@@ -0,0 +1,215 @@
+// Copyright (c) 2016-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Worst case script and witness sizes used to estimate the size of inputs
+// before they are signed.  Signatures are assumed to be 72 bytes DER encoded
+// with the sighash type byte, and public keys are assumed to be compressed.
+const (
+	// redeemP2PKSigScriptSize is the size of a signature script spending
+	// a pay-to-pubkey output.  It is the signature push.
+	redeemP2PKSigScriptSize = 1 + 72
+
+	// redeemP2PKHSigScriptSize is the size of a signature script spending
+	// a pay-to-pubkey-hash output.  It is the signature push followed by
+	// the public key push.
+	redeemP2PKHSigScriptSize = 1 + 72 + 1 + 33
+
+	// redeemNestedP2WPKHSigScriptSize is the size of a signature script
+	// spending a pay-to-script-hash output with a nested P2WPKH program.
+	// It is the push of the 22 byte witness program.
+	redeemNestedP2WPKHSigScriptSize = 1 + 22
+
+	// redeemP2WPKHWitnessSize is the size of the witness spending a P2WPKH
+	// output.  It is the item count followed by the length-prefixed
+	// signature and public key.
+	redeemP2WPKHWitnessSize = 1 + 1 + 72 + 1 + 33
+
+	// p2wpkhChangeOutputSize is the serialized size of a change output
+	// paying to a P2WPKH script.
+	p2wpkhChangeOutputSize = 8 + 1 + 22
+)
+
+// estimateInputSize returns the estimated serialized size of the signature
+// script and the witness of an input spending an output of the passed class
+// once signed.  Pay-to-script-hash outputs are assumed to be nested P2WPKH.
+// False is returned for classes whose size can't be estimated without knowing
+// more about the script.
+func estimateInputSize(class ScriptClass) (sigScriptSize, witnessSize int, ok bool) {
+	switch class {
+	case PubKeyTy:
+		return redeemP2PKSigScriptSize, 0, true
+	case PubKeyHashTy:
+		return redeemP2PKHSigScriptSize, 0, true
+	case ScriptHashTy:
+		return redeemNestedP2WPKHSigScriptSize, redeemP2WPKHWitnessSize, true
+	case WitnessV0PubKeyHashTy:
+		return 0, redeemP2WPKHWitnessSize, true
+	}
+	return 0, 0, false
+}
+
+// estimateVSize returns the virtual size of a transaction with inputs of the
+// passed signature script and witness sizes and outputs of the passed
+// serialized sizes.
+func estimateVSize(sigScriptSizes, witnessSizes []int, outputSizes []int) int64 {
+	baseSize := 4 + wire.VarIntSerializeSize(uint64(len(sigScriptSizes))) +
+		wire.VarIntSerializeSize(uint64(len(outputSizes))) + 4
+	witnessSize := 0
+	for i, sigScriptSize := range sigScriptSizes {
+		baseSize += 32 + 4 + wire.VarIntSerializeSize(uint64(sigScriptSize)) +
+			sigScriptSize + 4
+		witnessSize += witnessSizes[i]
+	}
+	for _, outputSize := range outputSizes {
+		baseSize += outputSize
+	}
+
+	// When any input has a witness, the marker and flag bytes are added
+	// and every other input needs an empty witness item count.
+	if witnessSize > 0 {
+		witnessSize += 2
+		for _, size := range witnessSizes {
+			if size == 0 {
+				witnessSize++
+			}
+		}
+	}
+
+	weight := int64(baseSize*WitnessScaleFactor + witnessSize)
+	return (weight + (WitnessScaleFactor - 1)) / WitnessScaleFactor
+}
+
+// EstimateTxVSize returns the estimated virtual size of a signed transaction
+// with numInputs inputs spending outputs of the passed classes and outputs
+// paying to the passed scripts, along with a P2WPKH change output when
+// hasChange is set.  This allows coin selection to account for the fee of the
+// change output before deciding whether to add it.
+//
+// Inputs are assumed to be spent by typical signatures and pay-to-script-hash
+// inputs are assumed to be nested P2WPKH.  An error is returned when the number
+// of classes doesn't match the number of inputs or the size of an input of the
+// passed class can't be estimated.
+func EstimateTxVSize(numInputs int, inputTypes []ScriptClass,
+	outputScripts [][]byte, hasChange bool) (int64, error) {
+
+	if len(inputTypes) != numInputs {
+		return 0, fmt.Errorf("got %d input types for %d inputs",
+			len(inputTypes), numInputs)
+	}
+
+	sigScriptSizes := make([]int, numInputs)
+	witnessSizes := make([]int, numInputs)
+	for i, class := range inputTypes {
+		sigScriptSize, witnessSize, ok := estimateInputSize(class)
+		if !ok {
+			return 0, fmt.Errorf("unable to estimate size of input "+
+				"%d spending %v output", i, class)
+		}
+		sigScriptSizes[i] = sigScriptSize
+		witnessSizes[i] = witnessSize
+	}
+
+	outputSizes := make([]int, 0, len(outputScripts)+1)
+	for _, pkScript := range outputScripts {
+		txOut := wire.TxOut{PkScript: pkScript}
+		outputSizes = append(outputSizes, txOut.SerializeSize())
+	}
+	if hasChange {
+		outputSizes = append(outputSizes, p2wpkhChangeOutputSize)
+	}
+
+	return estimateVSize(sigScriptSizes, witnessSizes, outputSizes), nil
+}
+
+// EstimateSignedVSize returns the projected virtual size of the transaction
+// once its inputs, which spend outputs of the passed classes, are signed.  The
+// signature scripts and witnesses of the inputs are replaced by ones of typical
+// size for their class, so the transaction may be unsigned or partially
+// signed.  Pay-to-script-hash inputs are assumed to be nested P2WPKH.
+//
+// An error is returned when the number of classes doesn't match the number of
+// inputs or the size of an input of the passed class can't be estimated.
+func (t *TxNew) EstimateSignedVSize(inputTypes []ScriptClass) (int64, error) {
+	numInputs := len(t.msgTx.TxIn)
+	if len(inputTypes) != numInputs {
+		return 0, fmt.Errorf("got %d input types for %d inputs",
+			len(inputTypes), numInputs)
+	}
+
+	sigScriptSizes := make([]int, numInputs)
+	witnessSizes := make([]int, numInputs)
+	for i, class := range inputTypes {
+		sigScriptSize, witnessSize, ok := estimateInputSize(class)
+		if !ok {
+			return 0, fmt.Errorf("unable to estimate size of input "+
+				"%d spending %v output", i, class)
+		}
+		sigScriptSizes[i] = sigScriptSize
+		witnessSizes[i] = witnessSize
+	}
+
+	outputSizes := make([]int, len(t.msgTx.TxOut))
+	for i, txOut := range t.msgTx.TxOut {
+		outputSizes[i] = txOut.SerializeSize()
+	}
+
+	return estimateVSize(sigScriptSizes, witnessSizes, outputSizes), nil
+}
+
+// SkeletonTxNew returns a transaction with the passed numbers of inputs and
+// outputs filled with placeholder data of typical sizes, which is only meant
+// for estimating the size of a transaction of the same shape before its real
+// data exists.  The outputs pay nothing to P2WPKH scripts.  When
+// witnessPerInput is zero, the inputs have signature scripts the size of those
+// spending P2PKH outputs, otherwise they have empty signature scripts and
+// witnesses which serialize to witnessPerInput bytes, such as
+// redeemP2WPKHWitnessSize for P2WPKH inputs.  Witnesses are at least 2 bytes,
+// that is a single empty item.
+func SkeletonTxNew(numInputs, numOutputs int, witnessPerInput int) *TxNew {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for i := 0; i < numInputs; i++ {
+		prevOut := wire.OutPoint{Index: uint32(i)}
+		txIn := wire.NewTxIn(&prevOut, nil, nil)
+		if witnessPerInput == 0 {
+			txIn.SignatureScript = make([]byte,
+				redeemP2PKHSigScriptSize)
+		} else {
+			txIn.Witness = wire.TxWitness{
+				make([]byte, skeletonWitnessItemSize(witnessPerInput)),
+			}
+		}
+		msgTx.AddTxIn(txIn)
+	}
+	for i := 0; i < numOutputs; i++ {
+		msgTx.AddTxOut(wire.NewTxOut(0, make([]byte, 22)))
+	}
+	return newTxNewFromMsgTx(msgTx)
+}
+
+// skeletonWitnessItemSize returns the size of the single item of a witness
+// which serializes to the passed number of bytes, including the item count and
+// the length prefix of the item.  Since the prefix grows with the item, some
+// sizes can't be hit exactly, in which case the largest smaller one is used.
+func skeletonWitnessItemSize(witnessSize int) int {
+	// The item count takes a single byte, and the length prefix of the
+	// item grows with its size.
+	itemSize := witnessSize - 2
+	for itemSize > 0 &&
+		1+wire.VarIntSerializeSize(uint64(itemSize))+itemSize > witnessSize {
+
+		itemSize--
+	}
+	if itemSize < 0 {
+		return 0
+	}
+	return itemSize
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2016-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestEstimateTxVSize ensures the estimated virtual sizes of transactions
+// match known sizes.
+func TestEstimateTxVSize(t *testing.T) {
+	p2wpkh := []btcutil.ScriptClass{btcutil.WitnessV0PubKeyHashTy}
+	p2pkh := []btcutil.ScriptClass{btcutil.PubKeyHashTy}
+
+	tests := []struct {
+		name          string
+		numInputs     int
+		inputTypes    []btcutil.ScriptClass
+		outputScripts [][]byte
+		hasChange     bool
+		want          int64
+	}{
+		{
+			// A P2WPKH spend to a single P2WPKH output is
+			// 110 vbytes.
+			name:          "p2wpkh to p2wpkh",
+			numInputs:     1,
+			inputTypes:    p2wpkh,
+			outputScripts: [][]byte{p2wpkhScript},
+			want:          110,
+		},
+		{
+			// Adding a P2WPKH change output adds 31 bytes.
+			name:          "p2wpkh to p2wpkh with change",
+			numInputs:     1,
+			inputTypes:    p2wpkh,
+			outputScripts: [][]byte{p2wpkhScript},
+			hasChange:     true,
+			want:          141,
+		},
+		{
+			// A P2PKH spend to a single P2PKH output is 192 bytes.
+			name:          "p2pkh to p2pkh",
+			numInputs:     1,
+			inputTypes:    p2pkh,
+			outputScripts: [][]byte{p2pkhScript},
+			want:          192,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := btcutil.EstimateTxVSize(test.numInputs,
+			test.inputTypes, test.outputScripts, test.hasChange)
+		if err != nil {
+			t.Errorf("EstimateTxVSize #%s: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("EstimateTxVSize #%s: got %d, want %d",
+				test.name, got, test.want)
+		}
+	}
+
+	// Ensure inputs without a class or of a class whose size can't be
+	// estimated are rejected.
+	_, err := btcutil.EstimateTxVSize(1, nil, [][]byte{p2pkhScript}, false)
+	if err == nil {
+		t.Errorf("EstimateTxVSize: expected error for missing input " +
+			"types")
+	}
+	_, err = btcutil.EstimateTxVSize(1,
+		[]btcutil.ScriptClass{btcutil.MultiSigTy},
+		[][]byte{p2pkhScript}, false)
+	if err == nil {
+		t.Errorf("EstimateTxVSize: expected error for multisig input")
+	}
+
+	// Ensure the estimates match signed transactions of the same shape.
+	sig := bytes.Repeat([]byte{0x30}, 72)
+	pubKey := bytes.Repeat([]byte{0x02}, 33)
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		Witness:          wire.TxWitness{sig, pubKey},
+	})
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2wpkhScript))
+	tx := btcutil.TstNewTxNew(msgTx)
+	if tx.VirtualSize() != 110 {
+		t.Errorf("VirtualSize: got %d, want 110", tx.VirtualSize())
+	}
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2wpkhScript))
+	tx = btcutil.TstNewTxNew(msgTx)
+	if tx.VirtualSize() != 141 {
+		t.Errorf("VirtualSize: got %d, want 141", tx.VirtualSize())
+	}
+}
+
+// TestEstimateSignedVSize ensures the projected sizes of unsigned transactions
+// match the sizes of the same transactions once signed.
+func TestEstimateSignedVSize(t *testing.T) {
+	sig := bytes.Repeat([]byte{0x30}, 72)
+	pubKey := bytes.Repeat([]byte{0x02}, 33)
+	p2pkhSigScript := append(append([]byte{0x48}, sig...), 0x21)
+	p2pkhSigScript = append(p2pkhSigScript, pubKey...)
+
+	tests := []struct {
+		name       string
+		inputTypes []btcutil.ScriptClass
+	}{
+		{"p2wpkh", []btcutil.ScriptClass{btcutil.WitnessV0PubKeyHashTy}},
+		{"p2pkh", []btcutil.ScriptClass{btcutil.PubKeyHashTy}},
+		{"p2wpkh and p2pkh", []btcutil.ScriptClass{
+			btcutil.WitnessV0PubKeyHashTy, btcutil.PubKeyHashTy,
+			btcutil.WitnessV0PubKeyHashTy}},
+	}
+
+	for _, test := range tests {
+		unsigned := wire.NewMsgTx(wire.TxVersion)
+		signed := wire.NewMsgTx(wire.TxVersion)
+		for i, class := range test.inputTypes {
+			prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01},
+				Index: uint32(i)}
+			unsigned.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+			switch class {
+			case btcutil.WitnessV0PubKeyHashTy:
+				signed.AddTxIn(wire.NewTxIn(&prevOut, nil,
+					wire.TxWitness{sig, pubKey}))
+			case btcutil.PubKeyHashTy:
+				signed.AddTxIn(wire.NewTxIn(&prevOut,
+					p2pkhSigScript, nil))
+			}
+		}
+		for _, msgTx := range []*wire.MsgTx{unsigned, signed} {
+			msgTx.AddTxOut(wire.NewTxOut(1000, p2wpkhScript))
+			msgTx.AddTxOut(wire.NewTxOut(2000, p2pkhScript))
+		}
+
+		tx := btcutil.TstNewTxNew(unsigned)
+		got, err := tx.EstimateSignedVSize(test.inputTypes)
+		if err != nil {
+			t.Errorf("EstimateSignedVSize #%s: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		want := btcutil.TstNewTxNew(signed).VirtualSize()
+		if got != want {
+			t.Errorf("EstimateSignedVSize #%s: got %d, want %d",
+				test.name, got, want)
+		}
+	}
+
+	// The number of input types must match the number of inputs.
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	_, err := tx.EstimateSignedVSize(nil)
+	if err == nil {
+		t.Errorf("EstimateSignedVSize: expected error for missing " +
+			"input types")
+	}
+
+	// Inputs whose size depends on their scripts are rejected.
+	_, err = tx.EstimateSignedVSize([]btcutil.ScriptClass{btcutil.MultiSigTy})
+	if err == nil {
+		t.Errorf("EstimateSignedVSize: expected error for multisig input")
+	}
+}
+
+// TestSkeletonTxNew ensures the sizes of skeleton transactions closely match
+// the sizes of real transactions of the same shape.
+func TestSkeletonTxNew(t *testing.T) {
+	sig := bytes.Repeat([]byte{0x30}, 71)
+	pubKey := bytes.Repeat([]byte{0x02}, 33)
+	p2pkhSigScript := append(append([]byte{0x47}, sig...), 0x21)
+	p2pkhSigScript = append(p2pkhSigScript, pubKey...)
+
+	tests := []struct {
+		name            string
+		numInputs       int
+		numOutputs      int
+		witnessPerInput int
+		witness         bool
+	}{
+		{"p2wpkh", 1, 2, 1 + 1 + 72 + 1 + 33, true},
+		{"p2wpkh batch", 3, 10, 1 + 1 + 72 + 1 + 33, true},
+		{"p2pkh", 2, 1, 0, false},
+		{"no outputs", 1, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		real := wire.NewMsgTx(wire.TxVersion)
+		for i := 0; i < test.numInputs; i++ {
+			prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01},
+				Index: uint32(i)}
+			if test.witness {
+				real.AddTxIn(wire.NewTxIn(&prevOut, nil,
+					wire.TxWitness{sig, pubKey}))
+			} else {
+				real.AddTxIn(wire.NewTxIn(&prevOut,
+					p2pkhSigScript, nil))
+			}
+		}
+		for i := 0; i < test.numOutputs; i++ {
+			real.AddTxOut(wire.NewTxOut(int64(i+1)*1000,
+				p2wpkhScript))
+		}
+
+		skeleton := btcutil.SkeletonTxNew(test.numInputs,
+			test.numOutputs, test.witnessPerInput)
+		msgTx := skeleton.MsgTx()
+		if len(msgTx.TxIn) != test.numInputs ||
+			len(msgTx.TxOut) != test.numOutputs {
+
+			t.Errorf("SkeletonTxNew #%s: got %d inputs and %d "+
+				"outputs, want %d and %d", test.name,
+				len(msgTx.TxIn), len(msgTx.TxOut), test.numInputs,
+				test.numOutputs)
+			continue
+		}
+		if skeleton.MsgTxNew() == nil {
+			t.Errorf("SkeletonTxNew #%s: missing MsgTxNew", test.name)
+		}
+
+		// Signatures vary in size by a byte, so allow a byte of
+		// difference per input.
+		got := skeleton.VirtualSize()
+		want := btcutil.TstNewTxNew(real).VirtualSize()
+		if got < want || got > want+int64(test.numInputs) {
+			t.Errorf("SkeletonTxNew #%s: got vsize %d, want %d",
+				test.name, got, want)
+		}
+	}
+
+	// Witnesses are sized exactly, including the length prefixes of their
+	// items, and are never smaller than a single empty item.
+	for _, size := range []int{2, 108, 300, 1000} {
+		msgTx := btcutil.SkeletonTxNew(1, 1, size).MsgTx()
+		got := msgTx.SerializeSize() - msgTx.SerializeSizeStripped() - 2
+		if got != size {
+			t.Errorf("SkeletonTxNew: got witness size %d, want %d",
+				got, size)
+		}
+	}
+	msgTx := btcutil.SkeletonTxNew(1, 1, 1).MsgTx()
+	if len(msgTx.TxIn[0].Witness) != 1 {
+		t.Errorf("SkeletonTxNew: got %d witness items, want 1",
+			len(msgTx.TxIn[0].Witness))
+	}
+}
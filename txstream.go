@@ -0,0 +1,236 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// maxStreamCount is the maximum count of inputs, outputs, witness items, or
+// bytes of a script which is accepted while streaming a transaction.  No
+// transaction which fits in a message can exceed it.
+const maxStreamCount = wire.MaxMessagePayload
+
+// txStream reads a serialized transaction from a stream piece by piece,
+// passing the bytes read through to a writer when one is set.  This allows
+// transactions to be examined or transformed without decoding them into a
+// wire.MsgTx.
+type txStream struct {
+	r   io.Reader
+	w   io.Writer // nil when the bytes read are discarded
+	buf [4]byte
+}
+
+// pass reads the next n bytes from the stream and writes them to the writer,
+// if any.
+func (s *txStream) pass(n uint64) error {
+	w := s.w
+	if w == nil {
+		w = ioutil.Discard
+	}
+	_, err := io.CopyN(w, s.r, int64(n))
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readUint32 reads a little-endian uint32 from the stream and writes it to the
+// writer, if any.
+func (s *txStream) readUint32() (uint32, error) {
+	if _, err := io.ReadFull(s.r, s.buf[:]); err != nil {
+		return 0, err
+	}
+	if s.w != nil {
+		if _, err := s.w.Write(s.buf[:]); err != nil {
+			return 0, err
+		}
+	}
+	return binary.LittleEndian.Uint32(s.buf[:]), nil
+}
+
+// readVarInt reads a variable length integer, which must not exceed
+// maxStreamCount, from the stream and writes it to the writer, if any.  Since
+// wire.ReadVarInt rejects encodings which aren't canonical, the bytes written
+// are the same as those read.
+func (s *txStream) readVarInt() (uint64, error) {
+	count, err := wire.ReadVarInt(s.r, 0)
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, err
+	}
+	if count > maxStreamCount {
+		return 0, fmt.Errorf("count %d exceeds max %d", count,
+			maxStreamCount)
+	}
+	if s.w != nil {
+		if err := wire.WriteVarInt(s.w, 0, count); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// readHeader reads the version of a transaction, along with the marker and
+// flag of the witness encoding when they are present, followed by its input
+// count.  Only the version is written to the writer, if any.  It returns the
+// input count and whether the transaction used the witness encoding.
+func (s *txStream) readHeader() (uint64, bool, error) {
+	if _, err := s.readUint32(); err != nil {
+		return 0, false, err
+	}
+
+	// A count of zero inputs is the marker of the witness encoding, in
+	// which case it is followed by the flag and the real input count.
+	w := s.w
+	s.w = nil
+	defer func() { s.w = w }()
+	count, err := s.readVarInt()
+	if err != nil {
+		return 0, false, err
+	}
+	if count != 0 {
+		return count, false, nil
+	}
+	if _, err := io.ReadFull(s.r, s.buf[:1]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, false, err
+	}
+	if s.buf[0] != witnessFlag {
+		return 0, false, fmt.Errorf("witness tx but flag byte is %x",
+			s.buf[0])
+	}
+	count, err = s.readVarInt()
+	return count, true, err
+}
+
+// passTxIns reads the passed number of inputs from the stream and writes them
+// to the writer, if any.
+func (s *txStream) passTxIns(count uint64) error {
+	for i := uint64(0); i < count; i++ {
+		// Previous outpoint.
+		if err := s.pass(chainhash.HashSize + 4); err != nil {
+			return err
+		}
+		scriptLen, err := s.readVarInt()
+		if err != nil {
+			return err
+		}
+		// Signature script and sequence number.
+		if err := s.pass(scriptLen + 4); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// passTxOuts reads the passed number of outputs from the stream and writes
+// them to the writer, if any.
+func (s *txStream) passTxOuts(count uint64) error {
+	for i := uint64(0); i < count; i++ {
+		// Value.
+		if err := s.pass(8); err != nil {
+			return err
+		}
+		scriptLen, err := s.readVarInt()
+		if err != nil {
+			return err
+		}
+		if err := s.pass(scriptLen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// passWitnesses reads the witnesses of the passed number of inputs from the
+// stream and writes them to the writer, if any.
+func (s *txStream) passWitnesses(count uint64) error {
+	for i := uint64(0); i < count; i++ {
+		witCount, err := s.readVarInt()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < witCount; j++ {
+			itemLen, err := s.readVarInt()
+			if err != nil {
+				return err
+			}
+			if err := s.pass(itemLen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// StripWitness reads a serialized transaction, with or without witness data,
+// from r and writes it to w without witness data, as expected by peers which
+// don't support segregated witness.  The transaction is streamed from r to w
+// rather than decoded, so w may have been partially written when an error is
+// returned.
+func StripWitness(r io.Reader, w io.Writer) error {
+	s := txStream{r: r, w: w}
+	numTxIn, hasWitness, err := s.readHeader()
+	if err != nil {
+		return err
+	}
+	if err := wire.WriteVarInt(w, 0, numTxIn); err != nil {
+		return err
+	}
+	if err := s.passTxIns(numTxIn); err != nil {
+		return err
+	}
+	numTxOut, err := s.readVarInt()
+	if err != nil {
+		return err
+	}
+	if err := s.passTxOuts(numTxOut); err != nil {
+		return err
+	}
+
+	// Discard the witnesses.
+	if hasWitness {
+		s.w = nil
+		if err := s.passWitnesses(numTxIn); err != nil {
+			return err
+		}
+		s.w = w
+	}
+
+	// Lock time.
+	return s.pass(4)
+}
+
+// CountInputsOutputs returns the number of inputs and outputs of the
+// serialized transaction, with or without witness data, read from r.  Only as
+// much of the transaction as is needed is read, and the inputs are skipped
+// rather than decoded, which makes it suitable as a fast filter, such as for
+// indexers.  The rest of the transaction is left unread.
+func CountInputsOutputs(r io.Reader) (nIn, nOut int, err error) {
+	s := txStream{r: r}
+	numTxIn, _, err := s.readHeader()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := s.passTxIns(numTxIn); err != nil {
+		return 0, 0, err
+	}
+	numTxOut, err := s.readVarInt()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(numTxIn), int(numTxOut), nil
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestStripWitness ensures transactions are streamed without their witness
+// data.
+func TestStripWitness(t *testing.T) {
+	tests := []struct {
+		name  string
+		msgTx *wire.MsgTx
+	}{
+		{"witness", newMixedWitnessMsgTx()},
+		{"legacy", Block100000.Transactions[1]},
+	}
+
+	for _, test := range tests {
+		var buf, stripped bytes.Buffer
+		if err := test.msgTx.Serialize(&buf); err != nil {
+			t.Fatalf("Serialize #%s: %v", test.name, err)
+		}
+		err := btcutil.StripWitness(bytes.NewReader(buf.Bytes()),
+			&stripped)
+		if err != nil {
+			t.Errorf("StripWitness #%s: %v", test.name, err)
+			continue
+		}
+
+		var want bytes.Buffer
+		if err := test.msgTx.SerializeNoWitness(&want); err != nil {
+			t.Fatalf("SerializeNoWitness #%s: %v", test.name, err)
+		}
+		if !bytes.Equal(stripped.Bytes(), want.Bytes()) {
+			t.Errorf("StripWitness #%s: got %x, want %x",
+				test.name, stripped.Bytes(), want.Bytes())
+			continue
+		}
+
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(stripped.Bytes()))
+		if err != nil {
+			t.Errorf("Deserialize #%s: %v", test.name, err)
+			continue
+		}
+		if msgTx.HasWitness() {
+			t.Errorf("Deserialize #%s: stripped tx has witness",
+				test.name)
+		}
+		if got, want := msgTx.TxHash(), test.msgTx.TxHash(); got != want {
+			t.Errorf("TxHash #%s: got %v, want %v", test.name,
+				got, want)
+		}
+
+		// Truncating the transaction anywhere after its version must
+		// fail.
+		for _, n := range []int{5, buf.Len() / 2, buf.Len() - 1} {
+			r := bytes.NewReader(buf.Bytes()[:n])
+			err := btcutil.StripWitness(r, &bytes.Buffer{})
+			if err != io.ErrUnexpectedEOF {
+				t.Errorf("StripWitness #%s truncated to %d: "+
+					"got %v, want %v", test.name, n, err,
+					io.ErrUnexpectedEOF)
+			}
+		}
+	}
+}
+
+// TestCountInputsOutputs ensures the number of inputs and outputs of
+// serialized transactions are counted correctly.
+func TestCountInputsOutputs(t *testing.T) {
+	tests := []struct {
+		name      string
+		msgTx     *wire.MsgTx
+		nIn, nOut int
+	}{
+		{"coinbase", Block100000.Transactions[0], 1, 1},
+		{"legacy", Block100000.Transactions[1], 1, 2},
+		{"witness", newMixedWitnessMsgTx(), 2, 1},
+		{"many", spendMsgTx(Block100000.Transactions[1:]...), 3, 1},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.msgTx.Serialize(&buf); err != nil {
+			t.Fatalf("Serialize #%s: %v", test.name, err)
+		}
+		nIn, nOut, err := btcutil.CountInputsOutputs(&buf)
+		if err != nil {
+			t.Errorf("CountInputsOutputs #%s: %v", test.name, err)
+			continue
+		}
+		if nIn != test.nIn || nOut != test.nOut {
+			t.Errorf("CountInputsOutputs #%s: got (%d, %d), want "+
+				"(%d, %d)", test.name, nIn, nOut, test.nIn,
+				test.nOut)
+		}
+	}
+
+	// The output count must be present.
+	var buf bytes.Buffer
+	if err := Block100000.Transactions[1].Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	nOutOffset := 4 + 1 + 36 + 1 + 140 + 4
+	r := bytes.NewReader(buf.Bytes()[:nOutOffset])
+	_, _, err := btcutil.CountInputsOutputs(r)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("CountInputsOutputs truncated: got %v, want %v", err,
+			io.ErrUnexpectedEOF)
+	}
+}
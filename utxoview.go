@@ -0,0 +1,675 @@
+// Copyright (c) 2015-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	// ErrMissingTxOut describes an error where a transaction references
+	// an output which is not in the view, either because it never existed
+	// or because it has already been spent.
+	ErrMissingTxOut = errors.New("referenced transaction output is " +
+		"missing or spent")
+
+	// ErrImmatureSpend describes an error where a transaction spends a
+	// coinbase output before it has reached the required maturity.
+	ErrImmatureSpend = errors.New("coinbase output spent before " +
+		"maturity")
+
+	// ErrBadTxOutValue describes an error where the value of a spent
+	// output, or the total value of the inputs of a transaction, is
+	// negative or more than the max allowed.
+	ErrBadTxOutValue = errors.New("transaction input value out of range")
+
+	// ErrSpendTooHigh describes an error where a transaction spends more
+	// than the value of its inputs.
+	ErrSpendTooHigh = errors.New("transaction spends more than the " +
+		"value of its inputs")
+)
+
+// UtxoEntry houses details about an individual unspent transaction output in a
+// UtxoView such as its amount, public key script, and the height of the block
+// containing it.
+type UtxoEntry struct {
+	amount      int64
+	pkScript    []byte // The public key script for the output.
+	blockHeight int32  // Height of block containing tx.
+	isCoinBase  bool   // Whether the containing tx is a coinbase.
+}
+
+// Amount returns the amount of the output.
+func (entry *UtxoEntry) Amount() int64 {
+	return entry.amount
+}
+
+// PkScript returns the public key script for the output.
+func (entry *UtxoEntry) PkScript() []byte {
+	return entry.pkScript
+}
+
+// BlockHeight returns the height of the block containing the output.
+func (entry *UtxoEntry) BlockHeight() int32 {
+	return entry.blockHeight
+}
+
+// IsCoinBase returns whether or not the output was contained in a coinbase
+// transaction.
+func (entry *UtxoEntry) IsCoinBase() bool {
+	return entry.isCoinBase
+}
+
+// NewUtxoEntry returns a new unspent output entry for the passed transaction
+// output contained in a block at the given height.
+func NewUtxoEntry(txOut *wire.TxOut, blockHeight int32, isCoinBase bool) *UtxoEntry {
+	return &UtxoEntry{
+		amount:      txOut.Value,
+		pkScript:    txOut.PkScript,
+		blockHeight: blockHeight,
+		isCoinBase:  isCoinBase,
+	}
+}
+
+// Clone returns a deep copy of the entry, including its public key script.
+func (entry *UtxoEntry) Clone() *UtxoEntry {
+	if entry == nil {
+		return nil
+	}
+
+	newEntry := *entry
+	newEntry.pkScript = make([]byte, len(entry.pkScript))
+	copy(newEntry.pkScript, entry.pkScript)
+	return &newEntry
+}
+
+// UtxoView represents a view into the set of unspent transaction outputs from
+// a specific point of view in the chain.  Unlike the view maintained by the
+// blockchain package, it is purely in memory, so outputs are removed from the
+// view as soon as they are spent.  Spent outputs can be restored from the
+// SpentTxOut entries collected when connecting transactions.
+type UtxoView struct {
+	entries map[wire.OutPoint]*UtxoEntry
+}
+
+// NewUtxoView returns a new empty unspent transaction output view.
+func NewUtxoView() *UtxoView {
+	return &UtxoView{
+		entries: make(map[wire.OutPoint]*UtxoEntry),
+	}
+}
+
+// LookupEntry returns information about a given transaction output according
+// to the current state of the view.  It will return nil if the passed output
+// does not exist in the view or has been spent.
+func (v *UtxoView) LookupEntry(outpoint wire.OutPoint) *UtxoEntry {
+	return v.entries[outpoint]
+}
+
+// AddEntry adds the passed entry for the given outpoint to the view,
+// overwriting any existing entry.
+func (v *UtxoView) AddEntry(outpoint wire.OutPoint, entry *UtxoEntry) {
+	v.entries[outpoint] = entry
+}
+
+// Entries returns the underlying map that stores of all the utxo entries.
+func (v *UtxoView) Entries() map[wire.OutPoint]*UtxoEntry {
+	return v.entries
+}
+
+// Clone returns an independent deep copy of the view, such as for attempting
+// to connect transactions speculatively without affecting the view itself.
+func (v *UtxoView) Clone() *UtxoView {
+	view := &UtxoView{
+		entries: make(map[wire.OutPoint]*UtxoEntry, len(v.entries)),
+	}
+	for outpoint, entry := range v.entries {
+		view.entries[outpoint] = entry.Clone()
+	}
+	return view
+}
+
+// sortOutPoints sorts the passed outpoints in place by hash and then by
+// output index.
+func sortOutPoints(outpoints []wire.OutPoint) {
+	sort.Slice(outpoints, func(i, j int) bool {
+		cmp := bytes.Compare(outpoints[i].Hash[:], outpoints[j].Hash[:])
+		if cmp != 0 {
+			return cmp < 0
+		}
+		return outpoints[i].Index < outpoints[j].Index
+	})
+}
+
+// Diff returns the outpoints of the unspent outputs which are in the view but
+// not in the other one, along with those which are in the other view but not
+// in this one.  When the other view represents an earlier point in the chain,
+// they are the outputs created and spent since, respectively.  Both are
+// sorted by hash and then by output index.
+func (v *UtxoView) Diff(other *UtxoView) (added, spent []wire.OutPoint) {
+	for outpoint := range v.entries {
+		if _, ok := other.entries[outpoint]; !ok {
+			added = append(added, outpoint)
+		}
+	}
+	for outpoint := range other.entries {
+		if _, ok := v.entries[outpoint]; !ok {
+			spent = append(spent, outpoint)
+		}
+	}
+
+	sortOutPoints(added)
+	sortOutPoints(spent)
+	return added, spent
+}
+
+// isOpReturn returns whether the passed public key script starts with
+// OP_RETURN.
+func isOpReturn(pkScript []byte) bool {
+	return len(pkScript) > 0 && pkScript[0] == opReturn
+}
+
+// isUnspendable returns whether the passed public key script is provably
+// unspendable, meaning it starts with OP_RETURN, exceeds the maximum script
+// size, or fails to parse.  Such outputs are never added to the view.
+func isUnspendable(pkScript []byte) bool {
+	if isOpReturn(pkScript) {
+		return true
+	}
+	if len(pkScript) > maxScriptSize {
+		return true
+	}
+	_, err := parseScript(pkScript)
+	return err != nil
+}
+
+// AddTxOuts adds all outputs in the passed transaction which are not provably
+// unspendable to the view.  When the view already has entries for any of the
+// outputs, they are simply overwritten.
+func (v *UtxoView) AddTxOuts(tx *TxNew, blockHeight int32) {
+	isCoinBase := tx.IsCoinBase()
+	prevOut := wire.OutPoint{Hash: *tx.Hash()}
+	for txOutIdx, txOut := range tx.MsgTx().TxOut {
+		if isUnspendable(txOut.PkScript) {
+			continue
+		}
+
+		prevOut.Index = uint32(txOutIdx)
+		v.entries[prevOut] = NewUtxoEntry(txOut, blockHeight, isCoinBase)
+	}
+}
+
+// ConnectTransaction updates the view by removing all of the outputs spent by
+// the passed transaction and adding all of its newly created outputs.  When
+// the stxos argument is not nil, it is appended with an entry for each spent
+// output in the order they are spent.  ErrMissingTxOut is returned, and the
+// view left unchanged, when an input references an output which isn't in the
+// view.
+func (v *UtxoView) ConnectTransaction(tx *TxNew, blockHeight int32, stxos *[]SpentTxOut) error {
+	// Coinbase transactions don't have any inputs to spend.
+	if tx.IsCoinBase() {
+		v.AddTxOuts(tx, blockHeight)
+		return nil
+	}
+
+	// Ensure every referenced output is available, and not spent twice by
+	// the transaction, before modifying the view.
+	txIns := tx.MsgTx().TxIn
+	spent := make(map[wire.OutPoint]struct{}, len(txIns))
+	for _, txIn := range txIns {
+		_, isDuplicate := spent[txIn.PreviousOutPoint]
+		if isDuplicate || v.entries[txIn.PreviousOutPoint] == nil {
+			return ErrMissingTxOut
+		}
+		spent[txIn.PreviousOutPoint] = struct{}{}
+	}
+
+	// Spend the referenced outputs, recording them when requested.
+	for _, txIn := range txIns {
+		entry := v.entries[txIn.PreviousOutPoint]
+		if stxos != nil {
+			*stxos = append(*stxos, SpentTxOut{
+				Amount:     entry.Amount(),
+				PkScript:   entry.PkScript(),
+				Height:     entry.BlockHeight(),
+				IsCoinBase: entry.IsCoinBase(),
+			})
+		}
+		delete(v.entries, txIn.PreviousOutPoint)
+	}
+
+	// Add the transaction's outputs as available utxos.
+	v.AddTxOuts(tx, blockHeight)
+	return nil
+}
+
+// ConnectTransactions updates the view by connecting each of the passed
+// transactions, such as those of a block, in order.  The view is left with
+// the transactions preceding a failing one connected.  See ConnectTransaction.
+func (v *UtxoView) ConnectTransactions(txs []*TxNew, blockHeight int32, stxos *[]SpentTxOut) error {
+	for _, tx := range txs {
+		err := v.ConnectTransaction(tx, blockHeight, stxos)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisconnectTransactions updates the view by undoing the connection of the
+// passed transactions, such as those of a block being disconnected.  The
+// outputs they created are removed and the outputs they spent are restored
+// from the passed spent outputs, which must be those collected when the
+// transactions were connected.
+func (v *UtxoView) DisconnectTransactions(txs []*TxNew, stxos []SpentTxOut) error {
+	// Sanity check the correct number of stxos are provided.
+	var numSpent int
+	for _, tx := range txs {
+		if !tx.IsCoinBase() {
+			numSpent += len(tx.MsgTx().TxIn)
+		}
+	}
+	if len(stxos) != numSpent {
+		return fmt.Errorf("transactions spend %d outputs, but %d spent "+
+			"outputs were provided", numSpent, len(stxos))
+	}
+
+	// Undo the transactions in reverse order since later transactions
+	// may spend the outputs of earlier ones.
+	stxoIdx := len(stxos) - 1
+	for txIdx := len(txs) - 1; txIdx >= 0; txIdx-- {
+		tx := txs[txIdx]
+
+		prevOut := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx := range tx.MsgTx().TxOut {
+			prevOut.Index = uint32(txOutIdx)
+			delete(v.entries, prevOut)
+		}
+
+		if tx.IsCoinBase() {
+			continue
+		}
+
+		// Restore the spent outputs in the reverse order they were
+		// spent.
+		txIns := tx.MsgTx().TxIn
+		for txInIdx := len(txIns) - 1; txInIdx >= 0; txInIdx-- {
+			stxo := &stxos[stxoIdx]
+			stxoIdx--
+
+			v.entries[txIns[txInIdx].PreviousOutPoint] = &UtxoEntry{
+				amount:      stxo.Amount,
+				pkScript:    stxo.PkScript,
+				blockHeight: stxo.Height,
+				isCoinBase:  stxo.IsCoinBase,
+			}
+		}
+	}
+
+	return nil
+}
+
+// TotalInputValue returns the total value of the outputs in the view which are
+// spent by the passed transaction.  ErrMissingTxOut is returned when any of
+// them is not in the view.  Coinbase transactions have no inputs, so their
+// total is zero.
+//
+// The values are summed without checking their ranges, see
+// CheckTransactionInputs for that.
+func (v *UtxoView) TotalInputValue(tx *TxNew) (int64, error) {
+	if tx.IsCoinBase() {
+		return 0, nil
+	}
+
+	var total int64
+	for _, txIn := range tx.MsgTx().TxIn {
+		entry := v.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil {
+			return 0, ErrMissingTxOut
+		}
+		total += entry.Amount()
+	}
+	return total, nil
+}
+
+// InputAgeSum returns the sum over the inputs of the passed transaction of the
+// value of the output each one spends multiplied by its age, that is the number
+// of blocks between its height in the view and atHeight, as used for coin age
+// based priority.  Outputs at or above atHeight, such as those created in the
+// same block, have no age.  The sum saturates at math.MaxInt64 instead of
+// overflowing.
+//
+// Coinbase transactions have no inputs, so their sum is zero.
+// ErrMissingTxOut is returned when any spent output is not in the view.
+func (v *UtxoView) InputAgeSum(tx *TxNew, atHeight int32) (int64, error) {
+	if tx.IsCoinBase() {
+		return 0, nil
+	}
+
+	var sum int64
+	for _, txIn := range tx.MsgTx().TxIn {
+		entry := v.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil {
+			return 0, ErrMissingTxOut
+		}
+		age := int64(atHeight) - int64(entry.BlockHeight())
+		value := entry.Amount()
+		if age <= 0 || value <= 0 {
+			continue
+		}
+		if value > (math.MaxInt64-sum)/age {
+			sum = math.MaxInt64
+			continue
+		}
+		sum += value * age
+	}
+	return sum, nil
+}
+
+// CheckTransactionInputs performs a series of checks on the inputs to the
+// passed transaction, as it would be included in a block at the given height,
+// to ensure they are valid according to the consensus rules.  An example of
+// some of the checks include verifying all inputs exist, ensuring the coinbase
+// seasoning requirements are met, and ensuring the transaction does not spend
+// more than its inputs.  The fee paid by the transaction is returned on
+// success.
+//
+// NOTE: The transaction MUST have already been sanity checked, such as by
+// blockchain.CheckTransactionSanity, since its output values are not checked
+// here.
+func (v *UtxoView) CheckTransactionInputs(tx *TxNew, height int32, params *chaincfg.Params) (int64, error) {
+	// Coinbase transactions have no inputs.
+	if tx.IsCoinBase() {
+		return 0, nil
+	}
+
+	var totalSatoshiIn int64
+	for _, txIn := range tx.MsgTx().TxIn {
+		// Ensure the referenced input transaction is available.
+		utxo := v.LookupEntry(txIn.PreviousOutPoint)
+		if utxo == nil {
+			return 0, ErrMissingTxOut
+		}
+
+		// Ensure the transaction is not spending coins which have not
+		// yet reached the required coinbase maturity.
+		if utxo.IsCoinBase() {
+			blocksSincePrev := height - utxo.BlockHeight()
+			if blocksSincePrev < int32(params.CoinbaseMaturity) {
+				return 0, ErrImmatureSpend
+			}
+		}
+
+		// Ensure the transaction amounts are in range.  Each of the
+		// output values of the input transactions must not be negative
+		// or more than the max allowed per transaction.
+		originTxSatoshi := utxo.Amount()
+		if originTxSatoshi < 0 || originTxSatoshi > MaxSatoshi {
+			return 0, ErrBadTxOutValue
+		}
+
+		// The total of all outputs must not be more than the max
+		// allowed per transaction.  Also, we could potentially overflow
+		// the accumulator so check for overflow.
+		lastSatoshiIn := totalSatoshiIn
+		totalSatoshiIn += originTxSatoshi
+		if totalSatoshiIn < lastSatoshiIn || totalSatoshiIn > MaxSatoshi {
+			return 0, ErrBadTxOutValue
+		}
+	}
+
+	// Calculate the total output amount for this transaction.  It is safe
+	// to ignore overflow and out of range errors here because those error
+	// conditions would have already been caught by the sanity checks.
+	var totalSatoshiOut int64
+	for _, txOut := range tx.MsgTx().TxOut {
+		totalSatoshiOut += txOut.Value
+	}
+
+	// Ensure the transaction does not spend more than its inputs.
+	if totalSatoshiIn < totalSatoshiOut {
+		return 0, ErrSpendTooHigh
+	}
+
+	return totalSatoshiIn - totalSatoshiOut, nil
+}
+
+// -----------------------------------------------------------------------------
+// The undo data for a disconnected block consists of the transaction outputs
+// it spent.  Each of them is serialized as follows:
+//
+//   <header code><compressed txout>
+//
+//   Field                Type     Size
+//   header code          VLQ      variable
+//   compressed txout
+//     compressed amount  VLQ      variable
+//     script size        VLQ      variable
+//     script             []byte   variable
+//
+// The serialized header code format is:
+//   bit 0 - containing transaction is a coinbase
+//   bits 1-x - height of the block that contains the spent txout
+// -----------------------------------------------------------------------------
+
+// SpentTxOut contains a spent transaction output along with the contextual
+// information needed to restore it to a UtxoView, namely whether or not it was
+// contained in a coinbase transaction and which block height the containing
+// transaction was included in.
+type SpentTxOut struct {
+	// Amount is the amount of the output.
+	Amount int64
+
+	// PkScript is the public key script for the output.
+	PkScript []byte
+
+	// Height is the height of the block containing the creating tx.
+	Height int32
+
+	// Denotes if the creating tx is a coinbase.
+	IsCoinBase bool
+}
+
+// spentTxOutHeaderCode returns the calculated header code to be used when
+// serializing the provided stxo entry.
+func spentTxOutHeaderCode(stxo *SpentTxOut) uint64 {
+	// As described in the serialization format comments, the header code
+	// encodes the height shifted over one bit and the coinbase flag in the
+	// lowest bit.
+	headerCode := uint64(uint32(stxo.Height)) << 1
+	if stxo.IsCoinBase {
+		headerCode |= 0x01
+	}
+
+	return headerCode
+}
+
+// SerializeSpentTxOut returns the passed spent output serialized according to
+// the format described above.  Serialized entries may be concatenated since
+// DeserializeSpentTxOut reports the number of bytes each one occupies.
+func SerializeSpentTxOut(stxo *SpentTxOut) []byte {
+	headerCode := spentTxOutHeaderCode(stxo)
+	size := serializeSizeVLQ(headerCode) +
+		compressedTxOutSize(uint64(stxo.Amount), stxo.PkScript)
+
+	serialized := make([]byte, size)
+	offset := putVLQ(serialized, headerCode)
+	putCompressedTxOut(serialized[offset:], uint64(stxo.Amount),
+		stxo.PkScript)
+	return serialized
+}
+
+// DeserializeSpentTxOut decodes the passed serialized spent output, possibly
+// followed by other data, according to the format described above.  It also
+// returns the number of bytes read.  io.ErrUnexpectedEOF is returned when the
+// data ends before the spent output does.
+func DeserializeSpentTxOut(serialized []byte) (*SpentTxOut, int, error) {
+	// Deserialize the header code.
+	code, offset := deserializeVLQ(serialized)
+	if offset >= len(serialized) {
+		return nil, offset, io.ErrUnexpectedEOF
+	}
+
+	// Decode the compressed txout.
+	amount, pkScript, bytesRead, err := decodeCompressedTxOut(
+		serialized[offset:])
+	offset += bytesRead
+	if err != nil {
+		return nil, offset, err
+	}
+
+	// Bit 0 indicates containing transaction is a coinbase.
+	// Bits 1-x encode height of containing transaction.
+	stxo := &SpentTxOut{
+		Amount:     int64(amount),
+		PkScript:   pkScript,
+		Height:     int32(code >> 1),
+		IsCoinBase: code&0x01 != 0,
+	}
+	return stxo, offset, nil
+}
+
+// -----------------------------------------------------------------------------
+// A snapshot of a view consists of the number of entries followed by the
+// entries themselves, sorted by hash and then by output index.  Each entry is
+// serialized as follows:
+//
+//   <hash><output index><header code><compressed txout>
+//
+//   Field                Type             Size
+//   hash                 chainhash.Hash   chainhash.HashSize
+//   output index         VLQ              variable
+//   header code          VLQ              variable
+//   compressed txout
+//     compressed amount  VLQ              variable
+//     script size        VLQ              variable
+//     script             []byte           variable
+//
+// The header code and compressed txout are the same as those of a spent output
+// described above.
+// -----------------------------------------------------------------------------
+
+// minSnapshotEntrySize is the minimum size of a serialized snapshot entry, that
+// is a hash, a single byte output index and header code, and a zero amount
+// with an empty script.
+const minSnapshotEntrySize = chainhash.HashSize + 1 + 1 + 2
+
+// Serialize writes a snapshot of the unspent outputs in the view to w in the
+// format described above, such as for persisting the view or sending it to a
+// peer.  See DeserializeUtxoView.
+func (v *UtxoView) Serialize(w io.Writer) error {
+	outpoints := make([]wire.OutPoint, 0, len(v.entries))
+	for outpoint, entry := range v.entries {
+		if entry != nil {
+			outpoints = append(outpoints, outpoint)
+		}
+	}
+	sortOutPoints(outpoints)
+
+	count := uint64(len(outpoints))
+	serializedCount := make([]byte, serializeSizeVLQ(count))
+	putVLQ(serializedCount, count)
+	if _, err := w.Write(serializedCount); err != nil {
+		return err
+	}
+	for _, outpoint := range outpoints {
+		entry := v.entries[outpoint]
+		stxo := SpentTxOut{
+			Amount:     entry.amount,
+			PkScript:   entry.pkScript,
+			Height:     entry.blockHeight,
+			IsCoinBase: entry.isCoinBase,
+		}
+		index := uint64(outpoint.Index)
+		serialized := make([]byte, chainhash.HashSize+
+			serializeSizeVLQ(index))
+		copy(serialized, outpoint.Hash[:])
+		putVLQ(serialized[chainhash.HashSize:], index)
+		serialized = append(serialized, SerializeSpentTxOut(&stxo)...)
+		if _, err := w.Write(serialized); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeserializeUtxoView reads a snapshot of a view written by Serialize from r
+// and returns a view holding its unspent outputs.  All of r is read, and
+// io.ErrUnexpectedEOF is returned when it ends before the snapshot does.
+func DeserializeUtxoView(r io.Reader) (*UtxoView, error) {
+	serialized, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deserialize the number of entries and ensure they can fit in the
+	// rest of the data to prevent huge allocations.
+	count, offset := deserializeVLQ(serialized)
+	if offset == 0 ||
+		count > uint64((len(serialized)-offset)/minSnapshotEntrySize) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	view := &UtxoView{
+		entries: make(map[wire.OutPoint]*UtxoEntry, count),
+	}
+	for i := uint64(0); i < count; i++ {
+		var outpoint wire.OutPoint
+		if len(serialized)-offset < chainhash.HashSize {
+			return nil, io.ErrUnexpectedEOF
+		}
+		copy(outpoint.Hash[:], serialized[offset:])
+		offset += chainhash.HashSize
+
+		index, bytesRead := deserializeVLQ(serialized[offset:])
+		offset += bytesRead
+		if offset >= len(serialized) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		outpoint.Index = uint32(index)
+
+		stxo, bytesRead, err := DeserializeSpentTxOut(
+			serialized[offset:])
+		offset += bytesRead
+		if err != nil {
+			return nil, err
+		}
+		view.entries[outpoint] = &UtxoEntry{
+			amount:      stxo.Amount,
+			pkScript:    stxo.PkScript,
+			blockHeight: stxo.Height,
+			isCoinBase:  stxo.IsCoinBase,
+		}
+	}
+
+	if offset != len(serialized) {
+		return nil, fmt.Errorf("%d trailing bytes after utxo view "+
+			"snapshot", len(serialized)-offset)
+	}
+	return view, nil
+}
+
+// CommitmentHash returns the double SHA-256 hash of the snapshot of the view
+// written by Serialize, which commits to all of its unspent outputs.  Since the
+// entries of the snapshot are sorted by outpoint, views holding the same
+// outputs have the same commitment regardless of how they were built, so nodes
+// may compare their views by it.
+func (v *UtxoView) CommitmentHash() chainhash.Hash {
+	// Writing to a hash never fails.
+	h := sha256.New()
+	_ = v.Serialize(h)
+	return chainhash.HashH(h.Sum(nil))
+}
@@ -0,0 +1,659 @@
+// Copyright (c) 2015-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcutil_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// hexToBytes converts the passed hex string into bytes and will panic if there
+// is an error.  This is only provided for the hard-coded constants so errors in
+// the source code can be detected.  It will only (and must only) be called with
+// hard-coded values.
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	return b
+}
+
+// TestSpentTxOutSerialization ensures serializing and deserializing spent
+// outputs works as expected.
+func TestSpentTxOutSerialization(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		stxo       btcutil.SpentTxOut
+		serialized []byte
+	}{
+		{
+			name: "Coinbase, 50 BTC, height 9",
+			stxo: btcutil.SpentTxOut{
+				Amount:     5000000000,
+				PkScript:   hexToBytes("51"),
+				Height:     9,
+				IsCoinBase: true,
+			},
+			serialized: hexToBytes("13320151"),
+		},
+		{
+			name: "Not coinbase, 344.05 BTC, height 100024",
+			stxo: btcutil.SpentTxOut{
+				Amount:     34405000000,
+				PkScript:   hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac"),
+				Height:     100024,
+				IsCoinBase: false,
+			},
+			serialized: hexToBytes("8b997091f20f1976a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac"),
+		},
+		{
+			name: "Zero amount, empty script",
+			stxo: btcutil.SpentTxOut{
+				PkScript: []byte{},
+				Height:   1,
+			},
+			serialized: hexToBytes("020000"),
+		},
+	}
+
+	for _, test := range tests {
+		gotBytes := btcutil.SerializeSpentTxOut(&test.stxo)
+		if !bytes.Equal(gotBytes, test.serialized) {
+			t.Errorf("SerializeSpentTxOut (%s): mismatched bytes - "+
+				"got %x, want %x", test.name, gotBytes,
+				test.serialized)
+			continue
+		}
+
+		// Deserialize with trailing data to ensure only the entry is
+		// consumed.
+		withTrailing := append(append([]byte{}, gotBytes...), 0xff)
+		stxo, n, err := btcutil.DeserializeSpentTxOut(withTrailing)
+		if err != nil {
+			t.Errorf("DeserializeSpentTxOut (%s): unexpected error: "+
+				"%v", test.name, err)
+			continue
+		}
+		if n != len(test.serialized) {
+			t.Errorf("DeserializeSpentTxOut (%s): read %d bytes, "+
+				"want %d", test.name, n, len(test.serialized))
+		}
+		if !reflect.DeepEqual(*stxo, test.stxo) {
+			t.Errorf("DeserializeSpentTxOut (%s): mismatched entry "+
+				"- got %+v, want %+v", test.name, *stxo,
+				test.stxo)
+		}
+
+		// Every truncation of the entry must be rejected.
+		for i := 0; i < len(test.serialized); i++ {
+			_, _, err := btcutil.DeserializeSpentTxOut(test.serialized[:i])
+			if err != io.ErrUnexpectedEOF {
+				t.Errorf("DeserializeSpentTxOut (%s): truncated "+
+					"to %d bytes - got error %v, want %v",
+					test.name, i, err, io.ErrUnexpectedEOF)
+			}
+		}
+	}
+}
+
+// TestUtxoViewDisconnect ensures a view is restored to its prior state by
+// disconnecting a block using the undo data collected when connecting it.
+func TestUtxoViewDisconnect(t *testing.T) {
+	t.Parallel()
+
+	txs := make([]*btcutil.TxNew, 0, len(Block100000.Transactions))
+	for _, msgTx := range Block100000.Transactions {
+		txs = append(txs, btcutil.TstNewTxNew(msgTx))
+	}
+
+	// Populate a view with the outputs spent by the block.
+	view := btcutil.NewUtxoView()
+	for i, tx := range txs[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			txOut := wire.NewTxOut(int64(i+1)*100000000,
+				hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac"))
+			view.AddEntry(txIn.PreviousOutPoint,
+				btcutil.NewUtxoEntry(txOut, 99000, i == 0))
+		}
+	}
+	before := make(map[wire.OutPoint]btcutil.UtxoEntry)
+	for outpoint, entry := range view.Entries() {
+		before[outpoint] = *entry
+	}
+
+	var stxos []btcutil.SpentTxOut
+	if err := view.ConnectTransactions(txs, 100000, &stxos); err != nil {
+		t.Fatalf("ConnectTransactions: unexpected error: %v", err)
+	}
+	if len(stxos) != len(before) {
+		t.Fatalf("ConnectTransactions: got %d spent outputs, want %d",
+			len(stxos), len(before))
+	}
+	for outpoint := range before {
+		if view.LookupEntry(outpoint) != nil {
+			t.Errorf("ConnectTransactions: spent output %v still in "+
+				"view", outpoint)
+		}
+	}
+
+	// Round trip the undo data through its serialized form as it would be
+	// when stored.
+	var undo []byte
+	for i := range stxos {
+		undo = append(undo, btcutil.SerializeSpentTxOut(&stxos[i])...)
+	}
+	var restored []btcutil.SpentTxOut
+	for len(undo) > 0 {
+		stxo, n, err := btcutil.DeserializeSpentTxOut(undo)
+		if err != nil {
+			t.Fatalf("DeserializeSpentTxOut: unexpected error: %v",
+				err)
+		}
+		restored = append(restored, *stxo)
+		undo = undo[n:]
+	}
+
+	// Disconnecting with too few spent outputs must fail.
+	err := view.DisconnectTransactions(txs, restored[1:])
+	if err == nil {
+		t.Fatal("DisconnectTransactions: unexpected success with " +
+			"missing spent outputs")
+	}
+
+	if err := view.DisconnectTransactions(txs, restored); err != nil {
+		t.Fatalf("DisconnectTransactions: unexpected error: %v", err)
+	}
+	after := make(map[wire.OutPoint]btcutil.UtxoEntry)
+	for outpoint, entry := range view.Entries() {
+		after[outpoint] = *entry
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("DisconnectTransactions: view not restored - got %d "+
+			"entries, want %d", len(after), len(before))
+	}
+}
+
+// TestUtxoViewConnectMissing ensures connecting a transaction which spends an
+// output not in the view fails without modifying the view.
+func TestUtxoViewConnectMissing(t *testing.T) {
+	t.Parallel()
+
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	view := btcutil.NewUtxoView()
+	err := view.ConnectTransaction(tx, 100000, nil)
+	if err != btcutil.ErrMissingTxOut {
+		t.Fatalf("ConnectTransaction: got error %v, want %v", err,
+			btcutil.ErrMissingTxOut)
+	}
+	if len(view.Entries()) != 0 {
+		t.Errorf("ConnectTransaction: view modified on failure")
+	}
+}
+
+// TestUtxoViewTotalInputValue ensures the values of the outputs spent by a
+// transaction are summed.
+func TestUtxoViewTotalInputValue(t *testing.T) {
+	t.Parallel()
+
+	// Spend two outputs of transaction 1 of block 100,000.
+	prevTx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for i := range prevTx.MsgTx().TxOut {
+		prevOut := wire.OutPoint{Hash: *prevTx.Hash(), Index: uint32(i)}
+		msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	view := btcutil.NewUtxoView()
+	view.AddTxOuts(prevTx, 100000)
+	total, err := view.TotalInputValue(tx)
+	if err != nil {
+		t.Fatalf("TotalInputValue: unexpected error: %v", err)
+	}
+	if want := int64(556000000 + 4444000000); total != want {
+		t.Errorf("TotalInputValue: got %d, want %d", total, want)
+	}
+
+	// Spending an output which isn't in the view is an error.
+	prevOut := msgTx.TxIn[0].PreviousOutPoint
+	entry := view.LookupEntry(prevOut)
+	view = btcutil.NewUtxoView()
+	view.AddEntry(prevOut, entry)
+	_, err = view.TotalInputValue(tx)
+	if err != btcutil.ErrMissingTxOut {
+		t.Errorf("TotalInputValue: got error %v, want %v", err,
+			btcutil.ErrMissingTxOut)
+	}
+}
+
+// TestUtxoViewInputAgeSum ensures the value of the outputs spent by a
+// transaction is weighted by their age.
+func TestUtxoViewInputAgeSum(t *testing.T) {
+	t.Parallel()
+
+	// Spend three outputs created at different heights.
+	outPoints := []wire.OutPoint{
+		{Hash: chainhash.Hash{0x01}},
+		{Hash: chainhash.Hash{0x02}},
+		{Hash: chainhash.Hash{0x03}},
+	}
+	view := btcutil.NewUtxoView()
+	view.AddEntry(outPoints[0], btcutil.NewUtxoEntry(
+		wire.NewTxOut(1000, p2pkhScript), 90, false))
+	view.AddEntry(outPoints[1], btcutil.NewUtxoEntry(
+		wire.NewTxOut(5000, p2pkhScript), 99, true))
+	view.AddEntry(outPoints[2], btcutil.NewUtxoEntry(
+		wire.NewTxOut(7000, p2pkhScript), 100, false))
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for i := range outPoints {
+		msgTx.AddTxIn(wire.NewTxIn(&outPoints[i], nil, nil))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	tx := btcutil.TstNewTxNew(msgTx)
+
+	// The output created at the height itself has no age.
+	tests := []struct {
+		atHeight int32
+		want     int64
+	}{
+		{100, 1000*10 + 5000*1},
+		{110, 1000*20 + 5000*11 + 7000*10},
+		{90, 0},
+	}
+	for _, test := range tests {
+		got, err := view.InputAgeSum(tx, test.atHeight)
+		if err != nil {
+			t.Errorf("InputAgeSum(%d): unexpected error: %v",
+				test.atHeight, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("InputAgeSum(%d): got %d, want %d",
+				test.atHeight, got, test.want)
+		}
+	}
+
+	// The sum saturates rather than overflowing.
+	view.AddEntry(outPoints[0], btcutil.NewUtxoEntry(
+		wire.NewTxOut(btcutil.MaxSatoshi, p2pkhScript), 0, false))
+	got, err := view.InputAgeSum(tx, math.MaxInt32)
+	if err != nil {
+		t.Fatalf("InputAgeSum: unexpected error: %v", err)
+	}
+	if got != math.MaxInt64 {
+		t.Errorf("InputAgeSum: got %d, want %d", got,
+			int64(math.MaxInt64))
+	}
+
+	// Coinbases have no inputs, and missing inputs are an error.
+	coinbase := btcutil.TstNewTxNew(Block100000.Transactions[0])
+	if got, err := view.InputAgeSum(coinbase, 100); got != 0 || err != nil {
+		t.Errorf("InputAgeSum: got %d (%v) for coinbase, want 0", got,
+			err)
+	}
+	view = btcutil.NewUtxoView()
+	if _, err := view.InputAgeSum(tx, 100); err != btcutil.ErrMissingTxOut {
+		t.Errorf("InputAgeSum: got error %v, want %v", err,
+			btcutil.ErrMissingTxOut)
+	}
+}
+
+// TestCheckTransactionInputs ensures the consensus checks on the inputs of a
+// transaction spending outputs from a view work as expected.
+func TestCheckTransactionInputs(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	tx := btcutil.TstNewTxNew(Block100000.Transactions[1])
+	prevOut := tx.MsgTx().TxIn[0].PreviousOutPoint
+	var totalOut int64
+	for _, txOut := range tx.MsgTx().TxOut {
+		totalOut += txOut.Value
+	}
+
+	tests := []struct {
+		name   string
+		entry  *btcutil.UtxoEntry
+		height int32
+		fee    int64
+		err    error
+	}{
+		{
+			name:   "valid",
+			entry:  btcutil.NewUtxoEntry(wire.NewTxOut(totalOut+1000, nil), 99000, false),
+			height: 100000,
+			fee:    1000,
+		},
+		{
+			name:   "exact spend",
+			entry:  btcutil.NewUtxoEntry(wire.NewTxOut(totalOut, nil), 99000, false),
+			height: 100000,
+		},
+		{
+			name:   "missing input",
+			height: 100000,
+			err:    btcutil.ErrMissingTxOut,
+		},
+		{
+			name:   "mature coinbase",
+			entry:  btcutil.NewUtxoEntry(wire.NewTxOut(totalOut+1000, nil), 99900, true),
+			height: 100000,
+			fee:    1000,
+		},
+		{
+			name:   "immature coinbase",
+			entry:  btcutil.NewUtxoEntry(wire.NewTxOut(totalOut+1000, nil), 99901, true),
+			height: 100000,
+			err:    btcutil.ErrImmatureSpend,
+		},
+		{
+			name:   "negative input value",
+			entry:  btcutil.NewUtxoEntry(wire.NewTxOut(-1, nil), 99000, false),
+			height: 100000,
+			err:    btcutil.ErrBadTxOutValue,
+		},
+		{
+			name:   "input value over max",
+			entry:  btcutil.NewUtxoEntry(wire.NewTxOut(btcutil.MaxSatoshi+1, nil), 99000, false),
+			height: 100000,
+			err:    btcutil.ErrBadTxOutValue,
+		},
+		{
+			name:   "overspend",
+			entry:  btcutil.NewUtxoEntry(wire.NewTxOut(totalOut-1, nil), 99000, false),
+			height: 100000,
+			err:    btcutil.ErrSpendTooHigh,
+		},
+	}
+
+	for _, test := range tests {
+		view := btcutil.NewUtxoView()
+		if test.entry != nil {
+			view.AddEntry(prevOut, test.entry)
+		}
+
+		fee, err := view.CheckTransactionInputs(tx, test.height, params)
+		if err != test.err {
+			t.Errorf("CheckTransactionInputs (%s): got error %v, "+
+				"want %v", test.name, err, test.err)
+			continue
+		}
+		if fee != test.fee {
+			t.Errorf("CheckTransactionInputs (%s): got fee %d, want "+
+				"%d", test.name, fee, test.fee)
+		}
+	}
+
+	// Coinbase transactions have no inputs to check.
+	coinbase := btcutil.TstNewTxNew(Block100000.Transactions[0])
+	view := btcutil.NewUtxoView()
+	fee, err := view.CheckTransactionInputs(coinbase, 100000, params)
+	if err != nil || fee != 0 {
+		t.Errorf("CheckTransactionInputs (coinbase): got fee %d, error "+
+			"%v, want fee 0, no error", fee, err)
+	}
+}
+
+// TestUtxoViewDiff ensures the difference between two views which connected
+// different transactions is reported.
+func TestUtxoViewDiff(t *testing.T) {
+	t.Parallel()
+
+	// Create the outputs funding the transactions and the transactions
+	// spending them.
+	p2pkh := hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac")
+	funding := []wire.OutPoint{
+		{Hash: chainhash.Hash{0x01}, Index: 0},
+		{Hash: chainhash.Hash{0x01}, Index: 1},
+		{Hash: chainhash.Hash{0x02}, Index: 0},
+	}
+	spendTx := func(prevOut wire.OutPoint, numOutputs int) *btcutil.TxNew {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+		for i := 0; i < numOutputs; i++ {
+			msgTx.AddTxOut(wire.NewTxOut(int64(1000*(i+1)), p2pkh))
+		}
+		return btcutil.TstNewTxNew(msgTx)
+	}
+	tx1 := spendTx(funding[0], 1)
+	tx2 := spendTx(funding[1], 2)
+
+	newView := func(tx *btcutil.TxNew) *btcutil.UtxoView {
+		view := btcutil.NewUtxoView()
+		for _, outpoint := range funding {
+			view.AddEntry(outpoint, btcutil.NewUtxoEntry(
+				wire.NewTxOut(5000, p2pkh), 1000, false))
+		}
+		if err := view.ConnectTransaction(tx, 1001, nil); err != nil {
+			t.Fatalf("ConnectTransaction: unexpected error: %v", err)
+		}
+		return view
+	}
+	view1 := newView(tx1)
+	view2 := newView(tx2)
+
+	sortOutPoints := func(outpoints []wire.OutPoint) []wire.OutPoint {
+		sort.Slice(outpoints, func(i, j int) bool {
+			cmp := bytes.Compare(outpoints[i].Hash[:],
+				outpoints[j].Hash[:])
+			if cmp != 0 {
+				return cmp < 0
+			}
+			return outpoints[i].Index < outpoints[j].Index
+		})
+		return outpoints
+	}
+	wantAdded := sortOutPoints([]wire.OutPoint{
+		funding[1],
+		{Hash: *tx1.Hash(), Index: 0},
+	})
+	wantSpent := sortOutPoints([]wire.OutPoint{
+		funding[0],
+		{Hash: *tx2.Hash(), Index: 0},
+		{Hash: *tx2.Hash(), Index: 1},
+	})
+
+	added, spent := view1.Diff(view2)
+	if !reflect.DeepEqual(added, wantAdded) {
+		t.Errorf("Diff: mismatched added outpoints - got %v, want %v",
+			added, wantAdded)
+	}
+	if !reflect.DeepEqual(spent, wantSpent) {
+		t.Errorf("Diff: mismatched spent outpoints - got %v, want %v",
+			spent, wantSpent)
+	}
+
+	// The diff in the other direction is reversed.
+	added, spent = view2.Diff(view1)
+	if !reflect.DeepEqual(added, wantSpent) ||
+		!reflect.DeepEqual(spent, wantAdded) {
+		t.Errorf("Diff: reversed diff mismatch - got added %v, spent "+
+			"%v", added, spent)
+	}
+
+	// Identical views have no differences.
+	added, spent = view1.Diff(newView(tx1))
+	if len(added) != 0 || len(spent) != 0 {
+		t.Errorf("Diff: unexpected differences between identical "+
+			"views - added %v, spent %v", added, spent)
+	}
+}
+
+// TestUtxoViewClone ensures modifying a clone of a view, including the scripts
+// of its entries, leaves the source view unchanged.
+func TestUtxoViewClone(t *testing.T) {
+	t.Parallel()
+
+	prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	otherOut := wire.OutPoint{Hash: chainhash.Hash{0x02}}
+	pkScript := hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac")
+	view := btcutil.NewUtxoView()
+	view.AddEntry(prevOut, btcutil.NewUtxoEntry(
+		wire.NewTxOut(5000, pkScript), 1000, true))
+
+	clone := view.Clone()
+	entry := clone.LookupEntry(prevOut)
+	if entry == nil {
+		t.Fatalf("Clone: missing entry for %v", prevOut)
+	}
+	if !reflect.DeepEqual(entry, view.LookupEntry(prevOut)) {
+		t.Errorf("Clone: got entry %+v, want %+v", entry,
+			view.LookupEntry(prevOut))
+	}
+
+	// Modify the clone by spending its entry, adding another, and
+	// altering the script of the entry.
+	entry.PkScript()[0] = 0x00
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(4000, pkScript))
+	err := clone.ConnectTransaction(btcutil.TstNewTxNew(msgTx), 1001, nil)
+	if err != nil {
+		t.Fatalf("ConnectTransaction: unexpected error: %v", err)
+	}
+	clone.AddEntry(otherOut, btcutil.NewUtxoEntry(
+		wire.NewTxOut(1000, pkScript), 1001, false))
+
+	entries := view.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("Clone: source view has %d entries, want 1",
+			len(entries))
+	}
+	source := view.LookupEntry(prevOut)
+	if source == nil || !bytes.Equal(source.PkScript(), pkScript) {
+		t.Errorf("Clone: source entry was modified")
+	}
+}
+
+// TestUtxoViewSerialize ensures a view survives a round trip through a
+// snapshot and truncated snapshots are rejected.
+func TestUtxoViewSerialize(t *testing.T) {
+	t.Parallel()
+
+	pkScript := hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac")
+	view := btcutil.NewUtxoView()
+	view.AddEntry(wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 300},
+		btcutil.NewUtxoEntry(wire.NewTxOut(34405000000, pkScript),
+			100024, false))
+	view.AddEntry(wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		btcutil.NewUtxoEntry(wire.NewTxOut(5000000000,
+			hexToBytes("51")), 9, true))
+	view.AddEntry(wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 1},
+		btcutil.NewUtxoEntry(wire.NewTxOut(0, []byte{}), 1, false))
+
+	var buf bytes.Buffer
+	if err := view.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: unexpected error: %v", err)
+	}
+	serialized := buf.Bytes()
+
+	got, err := btcutil.DeserializeUtxoView(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatalf("DeserializeUtxoView: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.Entries(), view.Entries()) {
+		t.Errorf("DeserializeUtxoView: got entries %v, want %v",
+			got.Entries(), view.Entries())
+	}
+
+	// Serializing again must give the same snapshot regardless of the
+	// order of the entries in the map.
+	var buf2 bytes.Buffer
+	if err := got.Serialize(&buf2); err != nil {
+		t.Fatalf("Serialize: unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf2.Bytes(), serialized) {
+		t.Errorf("Serialize: got %x, want %x", buf2.Bytes(), serialized)
+	}
+
+	// An empty view is just a zero count.
+	var emptyBuf bytes.Buffer
+	if err := btcutil.NewUtxoView().Serialize(&emptyBuf); err != nil {
+		t.Fatalf("Serialize: unexpected error: %v", err)
+	}
+	if !bytes.Equal(emptyBuf.Bytes(), []byte{0x00}) {
+		t.Errorf("Serialize: got %x for empty view, want 00",
+			emptyBuf.Bytes())
+	}
+
+	// Every truncation of the snapshot must be rejected.
+	for i := 0; i < len(serialized); i++ {
+		r := bytes.NewReader(serialized[:i])
+		_, err := btcutil.DeserializeUtxoView(r)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("DeserializeUtxoView: truncated to %d bytes - "+
+				"got error %v, want %v", i, err,
+				io.ErrUnexpectedEOF)
+		}
+	}
+
+	// Trailing data must be rejected too.
+	withTrailing := append(append([]byte{}, serialized...), 0x00)
+	_, err = btcutil.DeserializeUtxoView(bytes.NewReader(withTrailing))
+	if err == nil {
+		t.Errorf("DeserializeUtxoView: accepted trailing data")
+	}
+}
+
+// TestUtxoViewCommitmentHash ensures views holding the same outputs have the
+// same commitment regardless of the order they were added in.
+func TestUtxoViewCommitmentHash(t *testing.T) {
+	t.Parallel()
+
+	// Add the outputs of block 100,000 to one view in order and to the
+	// other in reverse.
+	var txns []*btcutil.TxNew
+	for _, msgTx := range Block100000.Transactions {
+		txns = append(txns, btcutil.TstNewTxNew(msgTx))
+	}
+	view := btcutil.NewUtxoView()
+	for _, tx := range txns {
+		view.AddTxOuts(tx, 100000)
+	}
+	reversed := btcutil.NewUtxoView()
+	for i := len(txns) - 1; i >= 0; i-- {
+		reversed.AddTxOuts(txns[i], 100000)
+	}
+
+	commitment := view.CommitmentHash()
+	if got := reversed.CommitmentHash(); got != commitment {
+		t.Errorf("CommitmentHash: got %v for reversed view, want %v",
+			got, commitment)
+	}
+
+	// The commitment is the hash of the snapshot.
+	var buf bytes.Buffer
+	if err := view.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: unexpected error: %v", err)
+	}
+	if want := chainhash.DoubleHashH(buf.Bytes()); commitment != want {
+		t.Errorf("CommitmentHash: got %v, want %v", commitment, want)
+	}
+
+	// Spending an output must change the commitment.
+	err := reversed.ConnectTransaction(
+		btcutil.TstNewTxNew(spendMsgTx(Block100000.Transactions[1])),
+		100001, nil)
+	if err != nil {
+		t.Fatalf("ConnectTransaction: unexpected error: %v", err)
+	}
+	if got := reversed.CommitmentHash(); got == commitment {
+		t.Errorf("CommitmentHash: unchanged after spending an output")
+	}
+}